@@ -0,0 +1,249 @@
+package accesslog
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fanonwue/go-short-link/internal/reqctx"
+)
+
+type (
+	// Logger writes one line per request to its output, using the configured format.
+	Logger struct {
+		format Format
+		out    io.Writer
+		// file is the file opened by [OpenFile]. Writers passed to [New] are owned by the caller and never closed.
+		file   *RotatingFile
+		redact []string
+		filter EntryFilter
+		mutex  sync.Mutex
+	}
+
+	// EntryFilter may modify an entry before it is logged, e.g. to anonymize client information.
+	EntryFilter func(r *http.Request, entry *Entry)
+
+	// Entry contains everything that is known about a handled request.
+	Entry struct {
+		Time       time.Time `json:"time"`
+		RemoteAddr string    `json:"remote_addr"`
+		User       string    `json:"user,omitempty"`
+		Method     string    `json:"method"`
+		Uri        string    `json:"uri"`
+		Proto      string    `json:"proto"`
+		Host       string    `json:"host"`
+		Status     int       `json:"status"`
+		Size       int64     `json:"size"`
+		Duration   float64   `json:"duration_ms"`
+		Referer    string    `json:"referer,omitempty"`
+		UserAgent  string    `json:"user_agent,omitempty"`
+		Key        string    `json:"key,omitempty"`
+		Target     string    `json:"target,omitempty"`
+		MatchType  string    `json:"match_type,omitempty"`
+		// Bot is the category of automated clients the request has been classified as
+		Bot       string `json:"bot,omitempty"`
+		RequestId string `json:"request_id,omitempty"`
+	}
+
+	responseRecorder struct {
+		http.ResponseWriter
+		status int
+		size   int64
+	}
+)
+
+const (
+	// Redacted replaces the value of redacted fields
+	Redacted = "REDACTED"
+	// FieldQuery is a pseudo field, redacting it removes the query string from the URI
+	FieldQuery = "query"
+)
+
+// RedactableFields lists the field names that can be redacted.
+var RedactableFields = []string{"remote_addr", "user", "uri", FieldQuery, "host", "referer", "user_agent", "key", "target"}
+
+// New creates a logger writing to out. The logger does not close out.
+func New(format Format, out io.Writer, redact []string) *Logger {
+	return &Logger{
+		format: format,
+		out:    out,
+		redact: redact,
+	}
+}
+
+// OpenFile creates a logger writing to a [RotatingFile] at path, which is closed by [Logger.Close].
+func OpenFile(format Format, path string, maxSize int64, maxBackups int, redact []string) (*Logger, error) {
+	file, err := OpenRotatingFile(path, maxSize, maxBackups)
+	if err != nil {
+		return nil, err
+	}
+	l := New(format, file, redact)
+	l.file = file
+	return l, nil
+}
+
+// SetFilter sets a filter applied to every entry logged by [Logger.Middleware].
+func (l *Logger) SetFilter(filter EntryFilter) {
+	l.filter = filter
+}
+
+// Middleware logs every request handled by next.
+func (l *Logger) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		startTime := time.Now()
+		ctx, info := reqctx.WithInfo(r.Context())
+		recorder := &responseRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		key, target, matchType := info.Match()
+		user := info.User()
+		if len(user) == 0 {
+			user, _, _ = r.BasicAuth()
+		}
+		entry := Entry{
+			Time:       startTime,
+			RemoteAddr: remoteHost(r.RemoteAddr),
+			User:       user,
+			Method:     r.Method,
+			Uri:        r.RequestURI,
+			Proto:      r.Proto,
+			Host:       r.Host,
+			Status:     recorder.Status(),
+			Size:       recorder.size,
+			Duration:   float64(time.Since(startTime).Microseconds()) / 1000,
+			Referer:    r.Referer(),
+			UserAgent:  r.UserAgent(),
+			Key:        key,
+			Target:     target,
+			MatchType:  string(matchType),
+			RequestId:  reqctx.RequestId(r.Context()),
+		}
+		if l.filter != nil {
+			l.filter(r, &entry)
+		}
+		l.Log(entry)
+	})
+}
+
+// Log writes a single entry. Redaction is applied before formatting.
+func (l *Logger) Log(entry Entry) {
+	redactEntry(&entry, l.redact)
+
+	buffer := &bytes.Buffer{}
+	formatEntry(buffer, l.format, &entry)
+	buffer.WriteByte('\n')
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	_, _ = l.out.Write(buffer.Bytes())
+}
+
+// PurgeBackups removes rotated log files that have last been written to before cutoff. It does nothing if the
+// logger does not write to a file.
+func (l *Logger) PurgeBackups(cutoff time.Time) (int, error) {
+	if l.file == nil {
+		return 0, nil
+	}
+	return l.file.PurgeBackups(cutoff)
+}
+
+// Close closes the file opened by [OpenFile]. Outputs passed to [New] are left open.
+func (l *Logger) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// ValidateFields returns an error naming the first field that cannot be redacted.
+func ValidateFields(fields []string) error {
+	for _, field := range fields {
+		if !slices.Contains(RedactableFields, field) {
+			return fmt.Errorf("unknown field '%s', allowed fields are: %s", field, strings.Join(RedactableFields, ", "))
+		}
+	}
+	return nil
+}
+
+func redactEntry(entry *Entry, fields []string) {
+	for _, field := range fields {
+		switch field {
+		case "remote_addr":
+			entry.RemoteAddr = Redacted
+		case "user":
+			if len(entry.User) > 0 {
+				entry.User = Redacted
+			}
+		case "uri":
+			entry.Uri = Redacted
+		case FieldQuery:
+			if index := strings.IndexByte(entry.Uri, '?'); index >= 0 {
+				entry.Uri = entry.Uri[:index+1] + Redacted
+			}
+		case "host":
+			entry.Host = Redacted
+		case "referer":
+			if len(entry.Referer) > 0 {
+				entry.Referer = Redacted
+			}
+		case "user_agent":
+			if len(entry.UserAgent) > 0 {
+				entry.UserAgent = Redacted
+			}
+		case "key":
+			if len(entry.Key) > 0 {
+				entry.Key = Redacted
+			}
+		case "target":
+			if len(entry.Target) > 0 {
+				entry.Target = Redacted
+			}
+		}
+	}
+}
+
+func remoteHost(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	if rr.status == 0 {
+		rr.status = status
+	}
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *responseRecorder) Write(p []byte) (int, error) {
+	if rr.status == 0 {
+		rr.status = http.StatusOK
+	}
+	n, err := rr.ResponseWriter.Write(p)
+	rr.size += int64(n)
+	return n, err
+}
+
+// Status returns the status code sent to the client. Handlers not writing anything implicitly respond with 200.
+func (rr *responseRecorder) Status() int {
+	if rr.status == 0 {
+		return http.StatusOK
+	}
+	return rr.status
+}
+
+// Unwrap allows http.ResponseController to access the underlying ResponseWriter.
+func (rr *responseRecorder) Unwrap() http.ResponseWriter {
+	return rr.ResponseWriter
+}
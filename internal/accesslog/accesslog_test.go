@@ -0,0 +1,133 @@
+package accesslog
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testEntry() Entry {
+	return Entry{
+		Time:       time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+		RemoteAddr: "192.0.2.1",
+		Method:     "GET",
+		Uri:        "/docs?utm=x",
+		Proto:      "HTTP/1.1",
+		Host:       "redirect.example.com",
+		Status:     307,
+		Size:       60,
+		Duration:   0.25,
+		UserAgent:  "curl/8.0",
+		Key:        "docs",
+		Target:     "https://example.com/docs",
+		MatchType:  "path",
+		RequestId:  "abc123",
+	}
+}
+
+func TestFormats(t *testing.T) {
+	tests := []struct {
+		format   Format
+		expected string
+	}{
+		{FormatCommon, `192.0.2.1 - - [02/Jan/2025:03:04:05 +0000] "GET /docs?utm=x HTTP/1.1" 307 60 "docs" "https://example.com/docs" path 0.250 "abc123"`},
+		{FormatCombined, `192.0.2.1 - - [02/Jan/2025:03:04:05 +0000] "GET /docs?utm=x HTTP/1.1" 307 60 "-" "curl/8.0" "docs" "https://example.com/docs" path 0.250 "abc123"`},
+		{FormatLogfmt, `time=2025-01-02T03:04:05.000Z remote_addr=192.0.2.1 method=GET uri="/docs?utm=x" proto=HTTP/1.1 host=redirect.example.com status=307 size=60 duration_ms=0.250 user_agent=curl/8.0 key=docs target=https://example.com/docs match_type=path request_id=abc123`},
+		{FormatJson, `{"time":"2025-01-02T03:04:05Z","remote_addr":"192.0.2.1","method":"GET","uri":"/docs?utm=x","proto":"HTTP/1.1","host":"redirect.example.com","status":307,"size":60,"duration_ms":0.25,"user_agent":"curl/8.0","key":"docs","target":"https://example.com/docs","match_type":"path","request_id":"abc123"}`},
+	}
+
+	for _, test := range tests {
+		out := &bytes.Buffer{}
+		New(test.format, out, nil).Log(testEntry())
+		if actual := strings.TrimSuffix(out.String(), "\n"); actual != test.expected {
+			t.Errorf("format %s:\nexpected %s\nactual   %s", test.format, test.expected, actual)
+		}
+	}
+}
+
+func TestRedaction(t *testing.T) {
+	out := &bytes.Buffer{}
+	New(FormatLogfmt, out, []string{"remote_addr", FieldQuery, "referer"}).Log(testEntry())
+
+	line := out.String()
+	if !strings.Contains(line, "remote_addr=REDACTED") || !strings.Contains(line, "uri=/docs?REDACTED") {
+		t.Errorf("expected remote address and query to be redacted: %s", line)
+	}
+	// Empty fields stay empty, so it is still visible that there was no referer
+	if strings.Contains(line, "referer=") {
+		t.Errorf("expected empty referer to be omitted: %s", line)
+	}
+
+	if err := ValidateFields([]string{"remote_addr", "password"}); err == nil {
+		t.Error("expected unknown field to be rejected")
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	file, err := OpenRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err = file.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		path:        "fourth\n",
+		path + ".1": "third\n",
+		path + ".2": "second\n",
+	}
+	for filePath, content := range expected {
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != content {
+			t.Errorf("%s: expected %q, got %q", filePath, content, data)
+		}
+	}
+	if _, err = os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected at most 2 backups")
+	}
+}
+
+type closeRecorder struct {
+	strings.Builder
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestCloseKeepsCallerOutput(t *testing.T) {
+	out := &closeRecorder{}
+	if err := New(FormatJson, out, nil).Close(); err != nil {
+		t.Fatal(err)
+	}
+	if out.closed {
+		t.Error("expected output passed to New not to be closed")
+	}
+
+	logger, err := OpenFile(FormatJson, filepath.Join(t.TempDir(), "access.log"), 0, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = logger.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = logger.file.Write([]byte("x")); err == nil {
+		t.Error("expected file opened by OpenFile to be closed")
+	}
+}
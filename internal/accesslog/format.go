@@ -0,0 +1,136 @@
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type Format string
+
+const (
+	FormatJson     Format = "json"
+	FormatCommon   Format = "common"
+	FormatCombined Format = "combined"
+	FormatLogfmt   Format = "logfmt"
+	// FormatDisabled disables access logging
+	FormatDisabled Format = ""
+)
+
+const clfTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+func ParseFormat(value string) (Format, error) {
+	format := Format(strings.ToLower(strings.TrimSpace(value)))
+	switch format {
+	case FormatJson, FormatCommon, FormatCombined, FormatLogfmt, FormatDisabled:
+		return format, nil
+	}
+	return FormatDisabled, fmt.Errorf("unknown access log format '%s'", value)
+}
+
+func formatEntry(buffer *bytes.Buffer, format Format, entry *Entry) {
+	switch format {
+	case FormatCommon, FormatCombined:
+		formatClf(buffer, entry, format == FormatCombined)
+	case FormatLogfmt:
+		formatLogfmt(buffer, entry)
+	default:
+		jsonBytes, _ := json.Marshal(entry)
+		buffer.Write(jsonBytes)
+	}
+}
+
+// formatClf writes the entry in the Common (or Combined) Log Format. The resolved key, target, match type and
+// the duration in milliseconds and the request ID are appended as additional fields, which most log processors
+// simply ignore.
+func formatClf(buffer *bytes.Buffer, entry *Entry, combined bool) {
+	fmt.Fprintf(buffer, "%s - %s [%s] %s %d %s",
+		clfValue(entry.RemoteAddr),
+		clfValue(entry.User),
+		entry.Time.Format(clfTimeLayout),
+		clfQuote(entry.Method+" "+entry.Uri+" "+entry.Proto),
+		entry.Status,
+		clfSize(entry.Size),
+	)
+	if combined {
+		fmt.Fprintf(buffer, " %s %s", clfQuote(entry.Referer), clfQuote(entry.UserAgent))
+	}
+	fmt.Fprintf(buffer, " %s %s %s %s %s",
+		clfQuote(entry.Key),
+		clfQuote(entry.Target),
+		clfValue(entry.MatchType),
+		strconv.FormatFloat(entry.Duration, 'f', 3, 64),
+		clfQuote(entry.RequestId),
+	)
+}
+
+func clfValue(value string) string {
+	if len(value) == 0 {
+		return "-"
+	}
+	return value
+}
+
+func clfSize(size int64) string {
+	if size == 0 {
+		return "-"
+	}
+	return strconv.FormatInt(size, 10)
+}
+
+func clfQuote(value string) string {
+	if len(value) == 0 {
+		return `"-"`
+	}
+	return `"` + clfEscaper.Replace(value) + `"`
+}
+
+var clfEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+
+func formatLogfmt(buffer *bytes.Buffer, entry *Entry) {
+	pairs := []struct {
+		key   string
+		value string
+	}{
+		{"time", entry.Time.Format("2006-01-02T15:04:05.000Z07:00")},
+		{"remote_addr", entry.RemoteAddr},
+		{"user", entry.User},
+		{"method", entry.Method},
+		{"uri", entry.Uri},
+		{"proto", entry.Proto},
+		{"host", entry.Host},
+		{"status", strconv.Itoa(entry.Status)},
+		{"size", strconv.FormatInt(entry.Size, 10)},
+		{"duration_ms", strconv.FormatFloat(entry.Duration, 'f', 3, 64)},
+		{"referer", entry.Referer},
+		{"user_agent", entry.UserAgent},
+		{"key", entry.Key},
+		{"target", entry.Target},
+		{"match_type", entry.MatchType},
+		{"bot", entry.Bot},
+		{"request_id", entry.RequestId},
+	}
+
+	first := true
+	for _, pair := range pairs {
+		if len(pair.value) == 0 {
+			continue
+		}
+		if !first {
+			buffer.WriteByte(' ')
+		}
+		first = false
+		buffer.WriteString(pair.key)
+		buffer.WriteByte('=')
+		buffer.WriteString(logfmtValue(pair.value))
+	}
+}
+
+func logfmtValue(value string) string {
+	if strings.ContainsAny(value, " =\"\\\n\r\t") {
+		return strconv.Quote(value)
+	}
+	return value
+}
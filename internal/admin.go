@@ -0,0 +1,150 @@
+package internal
+
+import (
+	"cmp"
+	"errors"
+	"html/template"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/fanonwue/go-short-link/internal/auth"
+	"github.com/fanonwue/go-short-link/internal/conf"
+	"github.com/fanonwue/go-short-link/internal/repo"
+	"github.com/fanonwue/go-short-link/internal/reqctx"
+	"github.com/fanonwue/go-short-link/internal/reqlog"
+	"github.com/fanonwue/go-short-link/internal/srv"
+	"github.com/fanonwue/go-short-link/internal/tmpl"
+	"github.com/fanonwue/go-short-link/internal/util"
+	"github.com/fanonwue/goutils/logging"
+)
+
+type (
+	AdminTemplateData struct {
+		Principal auth.Principal
+		Links     []AdminLink
+		CsrfToken string
+	}
+
+	AdminLink struct {
+		Key    string
+		Target string
+	}
+)
+
+const (
+	adminPath         = "/_admin"
+	adminLoginPath    = adminPath + "/login"
+	adminCallbackPath = adminPath + "/callback"
+	adminLogoutPath   = adminPath + "/logout"
+	csrfFormField     = "csrf_token"
+	maxLogoutFormSize = 4 * 1024
+)
+
+var adminTemplate *template.Template
+
+// setupAdmin parses the template of the admin UI. The admin UI is only available if the OpenID Connect login is
+// configured.
+func setupAdmin(tpc *tmpl.TemplateParserContext) {
+	if auth.OIDC() == nil {
+		return
+	}
+	adminTemplate = template.Must(tpc.ParseTemplateFile(tmpl.TemplatePath("admin.gohtml")))
+}
+
+// addAdminHandlers registers the handlers of the admin UI, if it is enabled.
+func addAdminHandlers(mux *http.ServeMux) {
+	if adminTemplate == nil {
+		return
+	}
+	mux.Handle(adminPath, timeoutHandler(wrapHandlerMethods(AdminHandler, []srv.HttpMethod{srv.GET, srv.HEAD})))
+	mux.Handle(adminLoginPath, timeoutHandler(wrapHandlerMethods(AdminLoginHandler, []srv.HttpMethod{srv.GET})))
+	mux.Handle(adminCallbackPath, timeoutHandler(wrapHandlerMethods(AdminCallbackHandler, []srv.HttpMethod{srv.GET})))
+	mux.Handle(adminLogoutPath, timeoutHandler(wrapHandlerMethods(AdminLogoutHandler, []srv.HttpMethod{srv.POST})))
+	logging.Infof("Admin UI available at %s", adminPath)
+}
+
+// AdminHandler shows the links to users logged in using the identity provider, and redirects everyone else to the
+// login.
+func AdminHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.OIDC().Session(r)
+	if !ok {
+		http.Redirect(w, r, adminLoginPath, http.StatusSeeOther)
+		return
+	}
+	reqctx.FromContext(r.Context()).SetUser(principal.Name)
+
+	mapping := repo.RedirectState().CurrentMapping()
+	links := make([]AdminLink, 0, len(mapping))
+	for key, target := range mapping {
+		links = append(links, AdminLink{Key: key, Target: target})
+	}
+	slices.SortFunc(links, func(a, b AdminLink) int { return cmp.Compare(a.Key, b.Key) })
+
+	renderedBuf := util.NewBuffer(conf.DefaultBufferSize)
+	if err := adminTemplate.Execute(renderedBuf, &AdminTemplateData{
+		Principal: principal,
+		Links:     links,
+		CsrfToken: auth.OIDC().CsrfToken(r),
+	}); err != nil {
+		reqlog.FromRequest(r).Errorf("Could not render admin template: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// The page is specific to the user, so it must not be cached
+	header := w.Header()
+	srv.AddDefaultHeaders(header)
+	header.Set("Cache-Control", "no-store")
+	header.Set("Content-Type", "text/html; charset=utf-8")
+	header.Set("Content-Length", strconv.Itoa(renderedBuf.Len()))
+	w.WriteHeader(http.StatusOK)
+	if srv.WithBodyRequest(r) {
+		_, _ = renderedBuf.WriteTo(w)
+	}
+}
+
+// AdminLoginHandler redirects the user to the login page of the identity provider.
+func AdminLoginHandler(w http.ResponseWriter, r *http.Request) {
+	loginUrl, err := auth.OIDC().StartLogin(w, r, adminPath)
+	if err != nil {
+		reqlog.FromRequest(r).Errorf("Could not start login: %v", err)
+		http.Error(w, "Identity provider unavailable", http.StatusBadGateway)
+		return
+	}
+	http.Redirect(w, r, loginUrl, http.StatusFound)
+}
+
+// AdminCallbackHandler completes the login when the identity provider redirects the user back.
+func AdminCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	principal, returnTo, err := auth.OIDC().FinishLogin(w, r)
+	switch {
+	case errors.Is(err, auth.ErrNoRole):
+		reqlog.FromRequest(r).Warnf("Rejected login: %v", err)
+		http.Error(w, "Forbidden - no role has been assigned to you", http.StatusForbidden)
+		return
+	case errors.Is(err, auth.ErrLoginFailed):
+		reqlog.FromRequest(r).Infof("Login failed: %v", err)
+		http.Error(w, "Login failed", http.StatusBadRequest)
+		return
+	case err != nil:
+		reqlog.FromRequest(r).Errorf("Could not complete login: %v", err)
+		http.Error(w, "Identity provider unavailable", http.StatusBadGateway)
+		return
+	}
+
+	reqctx.FromContext(r.Context()).SetUser(principal.Name)
+	reqlog.FromRequest(r).Infof("%s logged in with roles %v", principal.Name, principal.Roles)
+	http.Redirect(w, r, returnTo, http.StatusSeeOther)
+}
+
+// AdminLogoutHandler ends the session. The logout form carries the CSRF token, so other sites cannot log users out.
+func AdminLogoutHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxLogoutFormSize)
+	if !auth.OIDC().VerifyCsrf(r, r.PostFormValue(csrfFormField)) {
+		http.Error(w, "Forbidden - missing or invalid CSRF token", http.StatusForbidden)
+		return
+	}
+	auth.OIDC().Logout(w)
+	http.Redirect(w, r, adminLoginPath, http.StatusSeeOther)
+}
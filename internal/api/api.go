@@ -1,15 +1,24 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"slices"
+	"strings"
 	"time"
 
+	"github.com/fanonwue/go-short-link/internal/auth"
 	"github.com/fanonwue/go-short-link/internal/conf"
+	"github.com/fanonwue/go-short-link/internal/metrics"
 	"github.com/fanonwue/go-short-link/internal/repo"
+	"github.com/fanonwue/go-short-link/internal/reqctx"
+	"github.com/fanonwue/go-short-link/internal/reqlog"
 	"github.com/fanonwue/go-short-link/internal/srv"
 	"github.com/fanonwue/go-short-link/internal/state"
+	"github.com/fanonwue/go-short-link/internal/stats"
 )
 
 type (
@@ -18,40 +27,81 @@ type (
 		Pattern string
 		// Handler the handler that can handle the incoming request
 		Handler http.HandlerFunc
-		// Anonymous specifies whether anonymous (unauthenticated) access to this endpoint is allowed
-		Anonymous bool
+		// Role is the role required to access this endpoint, [auth.RoleViewer] if empty. [auth.RoleAnonymous] allows
+		// unauthenticated access. GET and HEAD requests to endpoints requiring [auth.RoleEditor] only need
+		// [auth.RoleViewer]. The admin credentials grant all roles.
+		Role auth.Role
+		// Methods lists the HTTP methods this endpoint accepts. If empty, the server's default methods are allowed.
+		Methods []srv.HttpMethod
+		// MaxBodySize limits the size of request bodies, defaultMaxBodySize if 0
+		MaxBodySize int64
+		// UnsafeGet marks endpoints changing data on GET requests as well. Such requests are protected against
+		// cross-site request forgery like requests using other methods.
+		UnsafeGet bool
 	}
 
 	StatusHealthcheck struct {
 		MappingSize int        `json:"mappingSize"`
 		Running     bool       `json:"running"`
 		Healthy     bool       `json:"healthy"`
+		Degraded    bool       `json:"degraded"`
 		LastUpdate  *time.Time `json:"lastUpdate"`
 	}
 
 	StatusInfo struct {
-		Mapping       state.RedirectMap `json:"mapping"`
-		SpreadsheetId string            `json:"spreadsheetId"`
-		LastUpdate    *time.Time        `json:"lastUpdate"`
-		LastModified  *time.Time        `json:"lastModified"`
-		LastError     string            `json:"lastError,omitempty"`
+		Mapping       state.RedirectMap     `json:"mapping"`
+		SpreadsheetId string                `json:"spreadsheetId"`
+		LastUpdate    *time.Time            `json:"lastUpdate"`
+		LastModified  *time.Time            `json:"lastModified"`
+		LastError     string                `json:"lastError,omitempty"`
+		Rejected      []state.RejectedEntry `json:"rejected,omitempty"`
+		PendingUpdate *repo.PendingUpdate   `json:"pendingUpdate,omitempty"`
+	}
+
+	StatusDiagnostics struct {
+		Source      string             `json:"source"`
+		CreatedAt   *time.Time         `json:"createdAt"`
+		Skipped     int                `json:"skipped"`
+		Collisions  int                `json:"collisions"`
+		Rejected    int                `json:"rejected"`
+		Warnings    int                `json:"warnings"`
+		Diagnostics []state.Diagnostic `json:"diagnostics"`
+	}
+
+	StatusStats struct {
+		Since       *time.Time        `json:"since"`
+		TotalClicks uint64            `json:"totalClicks"`
+		Clicks      map[string]uint64 `json:"clicks"`
 	}
 )
 
 const (
 	Prefix = "/_api"
+	// maxStatsBuckets limits the number of buckets returned by a single analytics request
+	maxStatsBuckets = 1000
 	// StatusPrefix is the prefix used for the old status endpoints.
 	StatusPrefix = "/_status"
+	// defaultMaxBodySize limits the size of request bodies of endpoints not declaring a limit of their own
+	defaultMaxBodySize     = 64 * 1024
+	requestTooLargeMessage = "Request body too large"
 )
 
 func createEndpoints() []Endpoint {
 	var apiEndpoints []Endpoint
 	var statusEndpoints []Endpoint
+	var metricsEndpoints []Endpoint
 
 	if conf.Config().ApiEnabled {
 		apiEndpoints = []Endpoint{
-			{Pattern: Prefix + "/update-mapping", Handler: UpdateMappingHandler},
+			{Pattern: Prefix + "/update-mapping", Handler: UpdateMappingHandler, Methods: updateMappingMethods(), Role: auth.RoleAdmin, UnsafeGet: true},
+			{Pattern: Prefix + "/pending-update", Handler: PendingUpdateHandler},
+			{Pattern: Prefix + "/pending-update/approve", Handler: ApprovePendingUpdateHandler, Methods: []srv.HttpMethod{srv.POST}, Role: auth.RoleAdmin},
+			{Pattern: Prefix + "/pending-update/discard", Handler: DiscardPendingUpdateHandler, Methods: []srv.HttpMethod{srv.POST}, Role: auth.RoleAdmin},
 		}
+		apiEndpoints = append(apiEndpoints, historyEndpoints()...)
+		apiEndpoints = append(apiEndpoints, linkEndpoints()...)
+		apiEndpoints = append(apiEndpoints, transferEndpoints()...)
+		apiEndpoints = append(apiEndpoints, tokenEndpoints()...)
 	}
 
 	if conf.Config().StatusEndpointEnabled {
@@ -63,13 +113,47 @@ func createEndpoints() []Endpoint {
 				Handler: StatusInfoHandler,
 			})
 			statusEndpoints = append(statusEndpoints, Endpoint{
-				Pattern:   prefix + "/health",
-				Handler:   StatusHealthHandler,
-				Anonymous: true,
+				Pattern: prefix + "/health",
+				Handler: StatusHealthHandler,
+				Role:    auth.RoleAnonymous,
 			})
 		}
+		statusEndpoints = append(statusEndpoints, Endpoint{
+			Pattern: Prefix + "/diagnostics",
+			Handler: StatusDiagnosticsHandler,
+		})
+		if stats.Enabled() {
+			statusEndpoints = append(statusEndpoints, Endpoint{
+				Pattern: Prefix + "/stats",
+				Handler: StatusStatsHandler,
+			})
+		}
+		if stats.AnalyticsEnabled() {
+			statusEndpoints = append(statusEndpoints, Endpoint{
+				Pattern: Prefix + "/stats/{key}",
+				Handler: StatusKeyStatsHandler,
+			})
+		}
+		statusEndpoints = append(statusEndpoints, reportEndpoints()...)
 	}
-	return slices.Concat(apiEndpoints, statusEndpoints)
+
+	if conf.Config().MetricsEnabled {
+		metricsEndpoint := Endpoint{Pattern: Prefix + "/metrics", Handler: MetricsHandler}
+		if conf.Config().MetricsAnonymous {
+			metricsEndpoint.Role = auth.RoleAnonymous
+		}
+		metricsEndpoints = []Endpoint{metricsEndpoint}
+	}
+	return slices.Concat(apiEndpoints, statusEndpoints, metricsEndpoints)
+}
+
+// updateMappingMethods returns the methods accepted by the update endpoint. Outside production, GET is accepted as well
+// for backwards compatibility.
+func updateMappingMethods() []srv.HttpMethod {
+	if conf.IsProd() {
+		return []srv.HttpMethod{srv.POST}
+	}
+	return []srv.HttpMethod{srv.GET, srv.POST}
 }
 
 func Endpoints() []Endpoint {
@@ -94,27 +178,159 @@ func isMethod(method srv.HttpMethod, r *http.Request) bool {
 	return srv.HttpMethod(r.Method) == method
 }
 
-func isAuthenticated(r *http.Request) bool {
-	creds := conf.Config().AdminCredentials
-	if creds == nil {
-		return false
+func forbiddenHandler(w http.ResponseWriter, r *http.Request) {
+	_ = srv.TextResponse(w, r, "Forbidden", http.StatusForbidden)
+}
+
+func crossOriginHandler(w http.ResponseWriter, r *http.Request) {
+	_ = srv.TextResponse(w, r, "Forbidden - cross-origin request", http.StatusForbidden)
+}
+
+func invalidCsrfTokenHandler(w http.ResponseWriter, r *http.Request) {
+	_ = srv.TextResponse(w, r, "Forbidden - missing or invalid CSRF token", http.StatusForbidden)
+}
+
+// invalidBodyResponse answers requests whose body could not be read or decoded. Bodies exceeding the size limit of
+// the endpoint are answered with 413, as the limit is only noticed while reading bodies without a Content-Length.
+func invalidBodyResponse(w http.ResponseWriter, r *http.Request, message string, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		_ = srv.TextResponse(w, r, requestTooLargeMessage, http.StatusRequestEntityTooLarge)
+		return
+	}
+	_ = srv.TextResponse(w, r, fmt.Sprintf("%s: %v", message, err), http.StatusBadRequest)
+}
+
+func invalidTokenHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="api", error="invalid_token"`)
+	_ = srv.TextResponse(w, r, "Unauthorized", http.StatusUnauthorized)
+}
+
+// authenticateBasic authenticates the admin credentials or a user of the users file, if configured. Recently verified
+// users are checked first, so they do not have to wait for the admin credentials to be compared using bcrypt.
+func authenticateBasic(r *http.Request) (auth.Principal, bool) {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		return auth.Principal{}, false
 	}
-	return srv.CheckCredentials(r, creds)
+	if auth.Users() != nil {
+		if principal, ok := auth.Users().AuthenticateCached(user, pass); ok {
+			return principal, true
+		}
+	}
+	if creds := conf.Config().AdminCredentials; creds != nil && srv.CheckCredentials(r, creds) {
+		return auth.AdminPrincipal(user), true
+	}
+	if auth.Users() == nil {
+		return auth.Principal{}, false
+	}
+	return auth.Users().Authenticate(user, pass)
 }
 
-func requireAuthenticated(r *http.Request, next http.HandlerFunc) http.HandlerFunc {
-	if isAuthenticated(r) {
-		return next
+// requiredRole returns the role needed for the request.
+func requiredRole(endpoint *Endpoint, r *http.Request) auth.Role {
+	switch {
+	case len(endpoint.Role) == 0:
+		return auth.RoleViewer
+	case endpoint.Role == auth.RoleEditor && (isMethod(srv.GET, r) || isMethod(srv.HEAD, r)):
+		return auth.RoleViewer
 	}
-	return unauthorizedHandler
+	return endpoint.Role
+}
+
+// requireAuthenticated accepts requests authenticated using the admin credentials, a user of the users file, an API
+// token, a JSON Web Token or the session of the admin UI, if the principal has been granted the required role. The
+// principal is added to the context of the request passed on.
+func requireAuthenticated(endpoint *Endpoint, r *http.Request, next http.HandlerFunc) (http.HandlerFunc, *http.Request) {
+	header := r.Header.Get("Authorization")
+	value, isBearer := strings.CutPrefix(header, "Bearer ")
+	var principal auth.Principal
+	switch {
+	case isBearer:
+		var ok bool
+		if principal, ok = authenticateBearer(r, strings.TrimSpace(value)); !ok {
+			return invalidTokenHandler, r
+		}
+	case len(header) > 0 || auth.OIDC() == nil:
+		var ok bool
+		if principal, ok = authenticateBasic(r); !ok {
+			return unauthorizedHandler, r
+		}
+		// Browsers send cached credentials along with forged requests as well
+		if isUnsafeRequest(endpoint, r) && isCrossOrigin(r) {
+			return crossOriginHandler, r
+		}
+	default:
+		var ok bool
+		if principal, ok = auth.OIDC().Session(r); !ok {
+			return unauthorizedHandler, r
+		}
+		if isUnsafeRequest(endpoint, r) && (isCrossOrigin(r) || !auth.OIDC().VerifyCsrf(r, r.Header.Get(auth.CsrfHeader))) {
+			return invalidCsrfTokenHandler, r
+		}
+	}
+
+	reqctx.FromContext(r.Context()).SetUser(principal.Name)
+	if !principal.Grants(requiredRole(endpoint, r)) {
+		return forbiddenHandler, r
+	}
+	return next, r.WithContext(auth.WithPrincipal(r.Context(), principal))
+}
+
+// authenticateBearer authenticates an API token or, if they are accepted, a JSON Web Token.
+func authenticateBearer(r *http.Request, value string) (auth.Principal, bool) {
+	if auth.IsToken(value) {
+		if auth.Tokens() == nil {
+			return auth.Principal{}, false
+		}
+		token, ok := auth.Tokens().Authenticate(value)
+		return token.Principal(), ok
+	}
+
+	principal, err := auth.AuthenticateJwt(r.Context(), value)
+	if err != nil {
+		if !errors.Is(err, auth.ErrJwtDisabled) {
+			reqlog.FromRequest(r).Debugf("Rejected JSON Web Token: %v", err)
+		}
+		return auth.Principal{}, false
+	}
+	return principal, true
+}
+
+// isUnsafeRequest reports whether the request may change data and has to be protected against cross-site request
+// forgery.
+func isUnsafeRequest(endpoint *Endpoint, r *http.Request) bool {
+	safeMethod := isMethod(srv.GET, r) || isMethod(srv.HEAD, r) || isMethod(srv.OPTIONS, r)
+	return !safeMethod || endpoint.UnsafeGet
+}
+
+// isCrossOrigin reports whether the request has been sent by a page of another origin. Browsers send the Origin header
+// with all requests changing data, so requests without it have not been sent by another page.
+func isCrossOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if len(origin) == 0 {
+		return false
+	}
+	parsed, err := url.Parse(origin)
+	return err != nil || !strings.EqualFold(parsed.Host, r.Host)
 }
 
 func wrapMiddleware(endpoint *Endpoint) http.HandlerFunc {
 	originalHandler := endpoint.Handler
+	maxBodySize := endpoint.MaxBodySize
+	if maxBodySize == 0 {
+		maxBodySize = defaultMaxBodySize
+	}
 	return func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > maxBodySize {
+			_ = srv.TextResponse(w, r, requestTooLargeMessage, http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+
 		newHandler := originalHandler
-		if !endpoint.Anonymous {
-			newHandler = requireAuthenticated(r, originalHandler)
+		if endpoint.Role != auth.RoleAnonymous {
+			newHandler, r = requireAuthenticated(endpoint, r, originalHandler)
 		}
 		newHandler(w, r)
 	}
@@ -132,6 +348,7 @@ func StatusHealthHandler(w http.ResponseWriter, r *http.Request) {
 		MappingSize: repo.RedirectState().MappingSize(),
 		Running:     true, // FIXME this is hardcoded for now, but if the server isn't running... this will not get executed
 		Healthy:     healthy,
+		Degraded:    repo.HasPendingUpdate(),
 		LastUpdate:  srv.StatusResponseTimeMapper(repo.DataSource().LastUpdate()),
 	}, status)
 }
@@ -149,6 +366,89 @@ func StatusInfoHandler(w http.ResponseWriter, r *http.Request) {
 		LastUpdate:    srv.StatusResponseTimeMapper(repo.DataSource().LastUpdate()),
 		LastModified:  srv.StatusResponseTimeMapper(repo.DataSource().LastModified()),
 		LastError:     errorString,
+		Rejected:      repo.RedirectState().Rejected(),
+		PendingUpdate: repo.PendingMappingUpdate(),
+	}, http.StatusOK)
+}
+
+func StatusDiagnosticsHandler(w http.ResponseWriter, r *http.Request) {
+	report := repo.RedirectState().Report()
+	if report == nil {
+		_ = srv.TextResponse(w, r, "No update has been performed yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	_ = srv.JsonResponse(w, r, StatusDiagnostics{
+		Source:      report.Source,
+		CreatedAt:   srv.StatusResponseTimeMapper(report.CreatedAt),
+		Skipped:     report.Count(state.ActionSkipped),
+		Collisions:  report.Count(state.ActionCollision),
+		Rejected:    report.Count(state.ActionRejected),
+		Warnings:    report.Count(state.ActionWarning),
+		Diagnostics: report.Diagnostics,
+	}, http.StatusOK)
+}
+
+// StatusKeyStatsHandler returns the time-bucketed analytics of a single key. The range is given by the
+// optional "from" and "to" parameters (RFC 3339 timestamps or dates), the bucket size by "bucket" (hour or day).
+func StatusKeyStatsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	granularity, err := stats.ParseGranularity(query.Get("bucket"))
+	if err != nil {
+		_ = srv.TextResponse(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	to, err := parseTimeParam(query.Get("to"), time.Now())
+	if err != nil {
+		_ = srv.TextResponse(w, r, fmt.Sprintf("Invalid value for parameter 'to': %v", err), http.StatusBadRequest)
+		return
+	}
+	from, err := parseTimeParam(query.Get("from"), to.Add(-granularity.DefaultRange()))
+	if err != nil {
+		_ = srv.TextResponse(w, r, fmt.Sprintf("Invalid value for parameter 'from': %v", err), http.StatusBadRequest)
+		return
+	}
+	if !from.Before(to) {
+		_ = srv.TextResponse(w, r, "Parameter 'from' must be before 'to'", http.StatusBadRequest)
+		return
+	}
+	if to.Sub(from)/granularity.Duration() > maxStatsBuckets {
+		_ = srv.TextResponse(w, r, fmt.Sprintf("The range must not exceed %d buckets", maxStatsBuckets), http.StatusBadRequest)
+		return
+	}
+
+	// Clicks are recorded with the key of the mapping, so the key has to be normalized like the redirect path
+	key, err := repo.NormalizeKey(r.PathValue("key"))
+	if err != nil {
+		_ = srv.TextResponse(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	_ = srv.JsonResponse(w, r, stats.Analytics().Query(key, from, to, granularity), http.StatusOK)
+}
+
+// parseTimeParam parses an RFC 3339 timestamp or a date. If value is empty, defaultValue is returned.
+func parseTimeParam(value string, defaultValue time.Time) (time.Time, error) {
+	if len(value) == 0 {
+		return defaultValue, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
+
+func StatusStatsHandler(w http.ResponseWriter, r *http.Request) {
+	clicks := stats.Clicks().Counts()
+	var total uint64
+	for _, count := range clicks {
+		total += count
+	}
+
+	_ = srv.JsonResponse(w, r, StatusStats{
+		Since:       srv.StatusResponseTimeMapper(stats.Clicks().Since()),
+		TotalClicks: total,
+		Clicks:      clicks,
 	}, http.StatusOK)
 }
 
@@ -158,7 +458,12 @@ func UpdateMappingHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	newMap, err := repo.UpdateRedirectMappingDefault(true)
+	// The update must not be aborted if the client disconnects, the trace is kept though
+	newMap, err := repo.UpdateRedirectMappingDefault(context.WithoutCancel(r.Context()), true)
+	if errors.Is(err, repo.ErrUpdateHeld) || errors.Is(err, repo.ErrMappingPinned) {
+		_ = srv.TextResponse(w, r, err.Error(), http.StatusConflict)
+		return
+	}
 	if err != nil {
 		_ = srv.TextResponse(w, r, err.Error(), http.StatusInternalServerError)
 		return
@@ -166,3 +471,45 @@ func UpdateMappingHandler(w http.ResponseWriter, r *http.Request) {
 	responseText := fmt.Sprintf("Update OK, mapping size: %d", len(newMap))
 	_ = srv.TextResponse(w, r, responseText, http.StatusOK)
 }
+
+func PendingUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	pending := repo.PendingMappingUpdate()
+	if pending == nil {
+		_ = srv.TextResponse(w, r, repo.ErrNoPendingUpdate.Error(), http.StatusNotFound)
+		return
+	}
+	_ = srv.JsonResponse(w, r, pending, http.StatusOK)
+}
+
+func ApprovePendingUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	newMap, err := repo.ApprovePendingUpdate(r.Context())
+	if errors.Is(err, repo.ErrNoPendingUpdate) {
+		_ = srv.TextResponse(w, r, err.Error(), http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, repo.ErrMappingPinned) {
+		_ = srv.TextResponse(w, r, err.Error(), http.StatusConflict)
+		return
+	}
+	responseText := fmt.Sprintf("Update approved, mapping size: %d", len(newMap))
+	_ = srv.TextResponse(w, r, responseText, http.StatusOK)
+}
+
+func DiscardPendingUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	err := repo.DiscardPendingUpdate(r.Context())
+	if errors.Is(err, repo.ErrNoPendingUpdate) {
+		_ = srv.TextResponse(w, r, err.Error(), http.StatusNotFound)
+		return
+	}
+	_ = srv.TextResponse(w, r, "Pending update discarded", http.StatusOK)
+}
+
+// MetricsHandler exposes all metrics in the Prometheus text exposition format.
+func MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", metrics.ContentType)
+	w.WriteHeader(http.StatusOK)
+	if srv.NoBodyRequest(r) {
+		return
+	}
+	_, _ = metrics.Default().WriteTo(w)
+}
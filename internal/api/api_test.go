@@ -0,0 +1,122 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fanonwue/go-short-link/internal/auth"
+	"github.com/fanonwue/go-short-link/internal/conf"
+	"github.com/fanonwue/go-short-link/internal/util"
+)
+
+const testSessionSecret = "0123456789abcdef0123456789abcdef"
+
+// setupTestAuth configures the admin credentials admin:password and the login to the admin UI, returning a request
+// authenticated by a session of an admin.
+func setupTestAuth(t *testing.T) *http.Request {
+	// Registered first, so the configuration is restored after the environment
+	t.Cleanup(func() { conf.CreateAppConfig() })
+	env := map[string]string{
+		"ADMIN_USER":        "admin",
+		"ADMIN_PASS":        "password",
+		"OIDC_ISSUER":       "https://id.example.com",
+		"OIDC_CLIENT_ID":    "short-link",
+		"OIDC_REDIRECT_URL": "http://example.com/_admin/callback",
+		"SESSION_SECRET":    testSessionSecret,
+	}
+	for name, value := range env {
+		t.Setenv(util.PrefixedEnvVar(name), value)
+	}
+	conf.CreateAppConfig()
+	auth.Setup()
+
+	// The session cookie is created like a login to the admin UI would create it
+	recorder := httptest.NewRecorder()
+	cookies := auth.NewCookieCodec([]byte(testSessionSecret), false)
+	if err := cookies.SetCookie(recorder, auth.SessionCookieName, "session", auth.AdminPrincipal("jane"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	session := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	for _, cookie := range recorder.Result().Cookies() {
+		session.AddCookie(cookie)
+	}
+	return session
+}
+
+func TestRequestForgery(t *testing.T) {
+	session := setupTestAuth(t)
+	okHandler := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	endpoint := &Endpoint{Pattern: Prefix + "/test", Handler: okHandler, Role: auth.RoleEditor}
+	unsafeGetEndpoint := &Endpoint{Pattern: Prefix + "/test", Handler: okHandler, Role: auth.RoleAdmin, UnsafeGet: true}
+
+	newRequest := func(method string, withSession bool, header map[string]string) *http.Request {
+		r := httptest.NewRequest(method, "http://example.com"+Prefix+"/test", strings.NewReader("{}"))
+		if withSession {
+			for _, cookie := range session.Cookies() {
+				r.AddCookie(cookie)
+			}
+		} else {
+			r.SetBasicAuth("admin", "password")
+		}
+		for name, value := range header {
+			r.Header.Set(name, value)
+		}
+		return r
+	}
+	csrfToken := auth.OIDC().CsrfToken(session)
+
+	tests := []struct {
+		name     string
+		endpoint *Endpoint
+		request  *http.Request
+		status   int
+	}{
+		{"basic", endpoint, newRequest(http.MethodPost, false, nil), http.StatusOK},
+		{"basic same-origin", endpoint, newRequest(http.MethodPost, false, map[string]string{"Origin": "http://example.com"}), http.StatusOK},
+		{"basic cross-origin", endpoint, newRequest(http.MethodPost, false, map[string]string{"Origin": "https://attacker.example"}), http.StatusForbidden},
+		{"basic cross-origin GET", endpoint, newRequest(http.MethodGet, false, map[string]string{"Origin": "https://attacker.example"}), http.StatusOK},
+		{"session without CSRF token", endpoint, newRequest(http.MethodPost, true, nil), http.StatusForbidden},
+		{"session with invalid CSRF token", endpoint, newRequest(http.MethodPost, true, map[string]string{auth.CsrfHeader: "invalid"}), http.StatusForbidden},
+		{"session with CSRF token", endpoint, newRequest(http.MethodPost, true, map[string]string{auth.CsrfHeader: csrfToken}), http.StatusOK},
+		{"session GET", endpoint, newRequest(http.MethodGet, true, nil), http.StatusOK},
+		{"session unsafe GET without CSRF token", unsafeGetEndpoint, newRequest(http.MethodGet, true, nil), http.StatusForbidden},
+		{"session unsafe GET with CSRF token", unsafeGetEndpoint, newRequest(http.MethodGet, true, map[string]string{auth.CsrfHeader: csrfToken}), http.StatusOK},
+	}
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		wrapMiddleware(test.endpoint)(recorder, test.request)
+		if recorder.Code != test.status {
+			t.Errorf("%s: expected status %d, got %d (%s)", test.name, test.status, recorder.Code, recorder.Body)
+		}
+	}
+}
+
+func TestRequestTooLarge(t *testing.T) {
+	setupTestAuth(t)
+	endpoint := &Endpoint{Pattern: Prefix + "/test", Role: auth.RoleEditor, Handler: func(w http.ResponseWriter, r *http.Request) {
+		var body LinkRequest
+		if decodeLinkRequest(w, r, &body) {
+			w.WriteHeader(http.StatusOK)
+		}
+	}}
+	body := `{"target":"https://example.com/` + strings.Repeat("a", defaultMaxBodySize) + `"}`
+
+	for _, chunked := range []bool{false, true} {
+		r := httptest.NewRequest(http.MethodPost, "http://example.com"+Prefix+"/test", strings.NewReader(body))
+		r.SetBasicAuth("admin", "password")
+		if chunked {
+			// Without a Content-Length, the limit is only noticed while decoding the body
+			r.Body = io.NopCloser(strings.NewReader(body))
+			r.ContentLength = -1
+		}
+		recorder := httptest.NewRecorder()
+		wrapMiddleware(endpoint)(recorder, r)
+		if recorder.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("chunked %v: expected status 413, got %d (%s)", chunked, recorder.Code, recorder.Body)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/fanonwue/go-short-link/internal/auth"
+	"github.com/fanonwue/go-short-link/internal/repo"
+	"github.com/fanonwue/go-short-link/internal/srv"
+	"github.com/fanonwue/go-short-link/internal/state"
+)
+
+type (
+	HistoryInfo struct {
+		PinnedId uint64               `json:"pinnedId,omitempty"`
+		Entries  []state.HistoryEntry `json:"entries"`
+	}
+
+	HistoryDiff struct {
+		Id      uint64 `json:"id"`
+		Against string `json:"against"`
+		state.MappingDiff
+	}
+)
+
+const (
+	againstPrevious = "previous"
+	againstCurrent  = "current"
+)
+
+func historyEndpoints() []Endpoint {
+	return []Endpoint{
+		{Pattern: Prefix + "/history", Handler: HistoryHandler},
+		{Pattern: Prefix + "/history/{id}", Handler: HistoryEntryHandler},
+		{Pattern: Prefix + "/history/{id}/diff", Handler: HistoryDiffHandler},
+		{Pattern: Prefix + "/history/{id}/rollback", Handler: HistoryRollbackHandler, Methods: []srv.HttpMethod{srv.POST}, Role: auth.RoleAdmin},
+		{Pattern: Prefix + "/history/unpin", Handler: HistoryUnpinHandler, Methods: []srv.HttpMethod{srv.POST}, Role: auth.RoleAdmin},
+	}
+}
+
+func historyEntryFromRequest(w http.ResponseWriter, r *http.Request) (state.HistoryEntry, bool) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		_ = srv.TextResponse(w, r, "Invalid version ID", http.StatusBadRequest)
+		return state.HistoryEntry{}, false
+	}
+
+	entry, found := repo.MappingHistory().Get(id)
+	if !found {
+		_ = srv.TextResponse(w, r, fmt.Sprintf("%s: %d", repo.ErrUnknownVersion, id), http.StatusNotFound)
+		return entry, false
+	}
+	return entry, true
+}
+
+func HistoryHandler(w http.ResponseWriter, r *http.Request) {
+	_ = srv.JsonResponse(w, r, HistoryInfo{
+		PinnedId: repo.PinnedVersion(),
+		Entries:  repo.MappingHistory().Entries(),
+	}, http.StatusOK)
+}
+
+func HistoryEntryHandler(w http.ResponseWriter, r *http.Request) {
+	entry, ok := historyEntryFromRequest(w, r)
+	if !ok {
+		return
+	}
+	_ = srv.JsonResponse(w, r, entry, http.StatusOK)
+}
+
+// HistoryDiffHandler compares a version against the previous version (default), the currently active mapping
+// (?against=current) or any other version (?against=<id>).
+func HistoryDiffHandler(w http.ResponseWriter, r *http.Request) {
+	entry, ok := historyEntryFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	against := r.URL.Query().Get("against")
+	var diff state.MappingDiff
+
+	switch against {
+	case "", againstPrevious:
+		against = againstPrevious
+		previous, found := repo.MappingHistory().Previous(entry.Id)
+		if !found {
+			previous.Mapping = state.RedirectMap{}
+		}
+		diff = state.Diff(previous.Mapping, entry.Mapping)
+	case againstCurrent:
+		diff = state.Diff(entry.Mapping, repo.RedirectState().CurrentMapping())
+	default:
+		otherId, err := strconv.ParseUint(against, 10, 64)
+		if err != nil {
+			_ = srv.TextResponse(w, r, "Invalid value for parameter 'against'", http.StatusBadRequest)
+			return
+		}
+		other, found := repo.MappingHistory().Get(otherId)
+		if !found {
+			_ = srv.TextResponse(w, r, fmt.Sprintf("%s: %d", repo.ErrUnknownVersion, otherId), http.StatusNotFound)
+			return
+		}
+		diff = state.Diff(other.Mapping, entry.Mapping)
+	}
+
+	_ = srv.JsonResponse(w, r, HistoryDiff{
+		Id:          entry.Id,
+		Against:     against,
+		MappingDiff: diff,
+	}, http.StatusOK)
+}
+
+func HistoryRollbackHandler(w http.ResponseWriter, r *http.Request) {
+	entry, ok := historyEntryFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	_, err := repo.Rollback(r.Context(), entry.Id)
+	if errors.Is(err, repo.ErrUnknownVersion) {
+		_ = srv.TextResponse(w, r, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		_ = srv.TextResponse(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	responseText := fmt.Sprintf("Rolled back to version %d, mapping size: %d", entry.Id, entry.Size)
+	_ = srv.TextResponse(w, r, responseText, http.StatusOK)
+}
+
+func HistoryUnpinHandler(w http.ResponseWriter, r *http.Request) {
+	err := repo.Unpin(r.Context())
+	if errors.Is(err, repo.ErrNotPinned) {
+		_ = srv.TextResponse(w, r, err.Error(), http.StatusConflict)
+		return
+	}
+
+	newMap, err := repo.UpdateRedirectMappingDefault(context.WithoutCancel(r.Context()), true)
+	if errors.Is(err, repo.ErrUpdateHeld) {
+		_ = srv.TextResponse(w, r, fmt.Sprintf("Unpinned, but the update has been held back: %v", err), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		_ = srv.TextResponse(w, r, fmt.Sprintf("Unpinned, but the update failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+	responseText := fmt.Sprintf("Unpinned, mapping size: %d", len(newMap))
+	_ = srv.TextResponse(w, r, responseText, http.StatusOK)
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/fanonwue/go-short-link/internal/auth"
+	"github.com/fanonwue/go-short-link/internal/ds"
+	"github.com/fanonwue/go-short-link/internal/policy"
+	"github.com/fanonwue/go-short-link/internal/repo"
+	"github.com/fanonwue/go-short-link/internal/srv"
+)
+
+type (
+	LinksInfo struct {
+		// Writable specifies whether the data source supports changing links using this API
+		Writable bool        `json:"writable"`
+		Links    []repo.Link `json:"links"`
+	}
+
+	LinkRequest struct {
+		Target string `json:"target"`
+	}
+)
+
+func linkEndpoints() []Endpoint {
+	return []Endpoint{
+		{Pattern: Prefix + "/links", Handler: LinksHandler},
+		{Pattern: Prefix + "/links/{key...}", Handler: LinkHandler, Methods: []srv.HttpMethod{srv.GET, srv.HEAD, srv.POST, srv.PUT, srv.DELETE}, Role: auth.RoleEditor},
+	}
+}
+
+func LinksHandler(w http.ResponseWriter, r *http.Request) {
+	_ = srv.JsonResponse(w, r, LinksInfo{
+		Writable: repo.IsWritable(),
+		Links:    repo.Links(),
+	}, http.StatusOK)
+}
+
+// LinkHandler returns (GET), creates (POST), changes (PUT) or deletes (DELETE) a single link. Changes are written
+// to the data source and applied to the active mapping immediately. PUT and DELETE honor the If-Match header.
+func LinkHandler(w http.ResponseWriter, r *http.Request) {
+	key, err := repo.NormalizeKey(r.PathValue("key"))
+	if err != nil {
+		_ = srv.TextResponse(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if isMethod(srv.GET, r) || isMethod(srv.HEAD, r) {
+		link, found := repo.GetLink(key)
+		if !found {
+			_ = srv.TextResponse(w, r, fmt.Sprintf("%s: %s", ds.ErrEntryNotFound, key), http.StatusNotFound)
+			return
+		}
+		linkResponse(w, r, link, http.StatusOK)
+		return
+	}
+
+	if !repo.IsWritable() {
+		w.Header().Set("Allow", "GET, HEAD")
+		_ = srv.TextResponse(w, r, repo.ErrReadOnly.Error(), http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Writes must not be aborted halfway if the client disconnects
+	ctx := context.WithoutCancel(r.Context())
+	ifMatch := r.Header.Get("If-Match")
+
+	switch {
+	case isMethod(srv.DELETE, r):
+		if err = repo.DeleteLink(ctx, key, ifMatch); err != nil {
+			linkErrorResponse(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case isMethod(srv.POST, r), isMethod(srv.PUT, r):
+		var body LinkRequest
+		if !decodeLinkRequest(w, r, &body) {
+			return
+		}
+
+		var link repo.Link
+		status := http.StatusOK
+		if isMethod(srv.POST, r) {
+			link, err = repo.CreateLink(ctx, key, body.Target)
+			status = http.StatusCreated
+			w.Header().Set("Location", Prefix+"/links/"+url.PathEscape(key))
+		} else {
+			link, err = repo.UpdateLink(ctx, key, body.Target, ifMatch)
+		}
+		if err != nil {
+			w.Header().Del("Location")
+			linkErrorResponse(w, r, err)
+			return
+		}
+		linkResponse(w, r, link, status)
+	default:
+		illegalMethodHandler(w, r)
+	}
+}
+
+func decodeLinkRequest(w http.ResponseWriter, r *http.Request, body *LinkRequest) bool {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(body); err != nil {
+		invalidBodyResponse(w, r, "Invalid request body", err)
+		return false
+	}
+	return true
+}
+
+func linkResponse(w http.ResponseWriter, r *http.Request, link repo.Link, status int) {
+	w.Header().Set("ETag", link.ETag)
+	_ = srv.JsonResponse(w, r, link, status)
+}
+
+func linkErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusBadGateway
+	switch {
+	case errors.Is(err, ds.ErrEntryNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, ds.ErrEntryExists), errors.Is(err, repo.ErrMappingPinned), errors.Is(err, repo.ErrLinkReferenced):
+		status = http.StatusConflict
+	case errors.Is(err, repo.ErrPreconditionFailed):
+		status = http.StatusPreconditionFailed
+	case errors.Is(err, policy.ErrInvalidHostFilter):
+		status = http.StatusInternalServerError
+	case errors.Is(err, repo.ErrInvalidKey):
+		status = http.StatusBadRequest
+	case errors.Is(err, policy.ErrInvalidTarget), errors.Is(err, policy.ErrSchemeNotAllowed),
+		errors.Is(err, policy.ErrHostNotAllowed), errors.Is(err, policy.ErrHostDenied):
+		status = http.StatusUnprocessableEntity
+	}
+	_ = srv.TextResponse(w, r, err.Error(), status)
+}
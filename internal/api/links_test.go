@@ -0,0 +1,37 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fanonwue/go-short-link/internal/ds"
+	"github.com/fanonwue/go-short-link/internal/repo"
+	"github.com/fanonwue/go-short-link/internal/state"
+)
+
+func TestLinkHandlerReadOnly(t *testing.T) {
+	repo.UseDataSource(ds.CreateCsvDataSource(filepath.Join(t.TempDir(), "links.csv"), false))
+	repo.RedirectState().UpdateMapping(state.RedirectMap{"docs": "https://docs.example.org"})
+
+	for _, method := range []string{http.MethodPost, http.MethodPut, http.MethodDelete} {
+		r := httptest.NewRequest(method, Prefix+"/links/docs", strings.NewReader(`{"target":"https://new.example.org"}`))
+		r.SetPathValue("key", "docs")
+		recorder := httptest.NewRecorder()
+		LinkHandler(recorder, r)
+
+		if recorder.Code != http.StatusMethodNotAllowed || recorder.Header().Get("Allow") != "GET, HEAD" {
+			t.Errorf("%s: expected 405 with allowed methods, got %d (Allow: %s)", method, recorder.Code, recorder.Header().Get("Allow"))
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, Prefix+"/links/docs", nil)
+	r.SetPathValue("key", "docs")
+	recorder := httptest.NewRecorder()
+	LinkHandler(recorder, r)
+	if recorder.Code != http.StatusOK || recorder.Header().Get("ETag") == "" {
+		t.Errorf("expected link to be readable, got %d", recorder.Code)
+	}
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fanonwue/go-short-link/internal/linkcheck"
+	"github.com/fanonwue/go-short-link/internal/repo"
+	"github.com/fanonwue/go-short-link/internal/srv"
+	"github.com/fanonwue/go-short-link/internal/stats"
+)
+
+type (
+	StaleReport struct {
+		// Since is the time at which counting has started. Keys that have never been clicked may have been
+		// clicked before that.
+		Since  *time.Time `json:"since"`
+		Cutoff *time.Time `json:"cutoff"`
+		Days   int        `json:"days"`
+		Keys   []StaleKey `json:"keys"`
+	}
+
+	StaleKey struct {
+		Key       string     `json:"key"`
+		Target    string     `json:"target"`
+		Clicks    uint64     `json:"clicks"`
+		LastClick *time.Time `json:"lastClick"`
+	}
+
+	BrokenReport struct {
+		StartedAt  *time.Time         `json:"startedAt"`
+		FinishedAt *time.Time         `json:"finishedAt"`
+		Checked    int                `json:"checked"`
+		Broken     int                `json:"broken"`
+		Results    []linkcheck.Result `json:"results"`
+	}
+)
+
+const defaultStaleDays = 30
+
+func reportEndpoints() []Endpoint {
+	var endpoints []Endpoint
+	if stats.Enabled() {
+		endpoints = append(endpoints, Endpoint{Pattern: Prefix + "/reports/stale", Handler: StaleReportHandler})
+	}
+	if linkcheck.Enabled() {
+		endpoints = append(endpoints, Endpoint{Pattern: Prefix + "/reports/broken", Handler: BrokenReportHandler})
+	}
+	return endpoints
+}
+
+// StaleReportHandler lists all keys that have not been clicked within the last N days (?days=N, default 30),
+// including keys that have never been clicked. Keys are sorted by their last click, oldest first.
+func StaleReportHandler(w http.ResponseWriter, r *http.Request) {
+	days := defaultStaleDays
+	if value := r.URL.Query().Get("days"); len(value) > 0 {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			_ = srv.TextResponse(w, r, "Parameter 'days' must be a positive number", http.StatusBadRequest)
+			return
+		}
+		days = parsed
+	}
+
+	cutoff := time.Now().UTC().AddDate(0, 0, -days)
+	counts := stats.Clicks().Counts()
+	lastClicks := stats.Clicks().LastClicks()
+
+	keys := []StaleKey{}
+	for key, target := range repo.RedirectState().CurrentMapping() {
+		lastClick, clicked := lastClicks[key]
+		if clicked && lastClick.After(cutoff) {
+			continue
+		}
+		staleKey := StaleKey{Key: key, Target: target, Clicks: counts[key]}
+		if clicked {
+			staleKey.LastClick = &lastClick
+		}
+		keys = append(keys, staleKey)
+	}
+	slices.SortFunc(keys, func(a, b StaleKey) int {
+		// Never clicked keys have no last click and therefore come first
+		if order := a.lastClick().Compare(b.lastClick()); order != 0 {
+			return order
+		}
+		return strings.Compare(a.Key, b.Key)
+	})
+
+	_ = srv.JsonResponse(w, r, StaleReport{
+		Since:  srv.StatusResponseTimeMapper(stats.Clicks().Since()),
+		Cutoff: &cutoff,
+		Days:   days,
+		Keys:   keys,
+	}, http.StatusOK)
+}
+
+// BrokenReportHandler returns the broken targets found by the last link check. All results, including
+// working targets, are returned with ?all=true.
+func BrokenReportHandler(w http.ResponseWriter, r *http.Request) {
+	report := linkcheck.LatestReport()
+	if report == nil {
+		_ = srv.TextResponse(w, r, "No link check has completed yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	broken := report.Broken()
+	results := broken
+	if all, _ := strconv.ParseBool(r.URL.Query().Get("all")); all {
+		results = report.Results
+	}
+
+	_ = srv.JsonResponse(w, r, BrokenReport{
+		StartedAt:  srv.StatusResponseTimeMapper(report.StartedAt),
+		FinishedAt: srv.StatusResponseTimeMapper(report.FinishedAt),
+		Checked:    report.Checked,
+		Broken:     len(broken),
+		Results:    results,
+	}, http.StatusOK)
+}
+
+func (sk StaleKey) lastClick() time.Time {
+	if sk.LastClick == nil {
+		return time.Time{}
+	}
+	return *sk.LastClick
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/fanonwue/go-short-link/internal/auth"
+	"github.com/fanonwue/go-short-link/internal/reqlog"
+	"github.com/fanonwue/go-short-link/internal/srv"
+)
+
+type (
+	TokenRequest struct {
+		Name      string       `json:"name"`
+		Scopes    []auth.Scope `json:"scopes"`
+		ExpiresAt *time.Time   `json:"expiresAt"`
+	}
+
+	// CreatedToken is returned when a token has been created. It is the only time the token itself is returned.
+	CreatedToken struct {
+		auth.Token
+		Value string `json:"token"`
+	}
+)
+
+// tokenEndpoints returns the endpoints for managing API tokens. They are only available if a token file is configured.
+func tokenEndpoints() []Endpoint {
+	if auth.Tokens() == nil {
+		return nil
+	}
+	return []Endpoint{
+		{Pattern: Prefix + "/tokens", Handler: TokensHandler, Methods: []srv.HttpMethod{srv.GET, srv.HEAD, srv.POST}, Role: auth.RoleAdmin},
+		{Pattern: Prefix + "/tokens/{id}", Handler: RevokeTokenHandler, Methods: []srv.HttpMethod{srv.DELETE}, Role: auth.RoleAdmin},
+	}
+}
+
+// TokensHandler lists all tokens (GET) or creates a new one (POST). Tokens can only grant the scopes of the client
+// creating them.
+func TokensHandler(w http.ResponseWriter, r *http.Request) {
+	if !isMethod(srv.POST, r) {
+		_ = srv.JsonResponse(w, r, auth.Tokens().List(), http.StatusOK)
+		return
+	}
+
+	var body TokenRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&body); err != nil {
+		invalidBodyResponse(w, r, "Invalid request body", err)
+		return
+	}
+
+	caller, _ := auth.PrincipalFromContext(r.Context())
+	scopes := make([]auth.Scope, len(body.Scopes))
+	for i, value := range body.Scopes {
+		scope, err := auth.ParseScope(string(value))
+		if err != nil {
+			_ = srv.TextResponse(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		scopes[i] = scope
+		if !caller.HasScope(scope) {
+			_ = srv.TextResponse(w, r, fmt.Sprintf("Cannot grant scope '%s' %s has not been granted itself", scope, caller.Name), http.StatusForbidden)
+			return
+		}
+	}
+	if body.ExpiresAt != nil && body.ExpiresAt.Before(time.Now()) {
+		_ = srv.TextResponse(w, r, "Expiration time must be in the future", http.StatusBadRequest)
+		return
+	}
+
+	token, value, err := auth.Tokens().Create(body.Name, scopes, body.ExpiresAt)
+	switch {
+	case errors.Is(err, auth.ErrInvalidName), errors.Is(err, auth.ErrInvalidScope):
+		_ = srv.TextResponse(w, r, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		reqlog.FromRequest(r).Errorf("Error saving API token: %v", err)
+		_ = srv.TextResponse(w, r, "Error saving token", http.StatusInternalServerError)
+		return
+	}
+
+	reqlog.FromRequest(r).Infof("Created API token %s (%s) with scopes %v", token.Id, token.Name, token.Scopes)
+	w.Header().Set("Location", Prefix+"/tokens/"+token.Id)
+	_ = srv.JsonResponse(w, r, CreatedToken{Token: token, Value: value}, http.StatusCreated)
+}
+
+func RevokeTokenHandler(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.Tokens().Revoke(r.PathValue("id"))
+	switch {
+	case errors.Is(err, auth.ErrUnknownToken):
+		_ = srv.TextResponse(w, r, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		reqlog.FromRequest(r).Errorf("Error saving API tokens: %v", err)
+		_ = srv.TextResponse(w, r, "Error saving tokens", http.StatusInternalServerError)
+		return
+	}
+
+	reqlog.FromRequest(r).Infof("Revoked API token %s (%s)", token.Id, token.Name)
+	w.WriteHeader(http.StatusNoContent)
+}
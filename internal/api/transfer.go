@@ -0,0 +1,182 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fanonwue/go-short-link/internal/auth"
+	"github.com/fanonwue/go-short-link/internal/conf"
+	"github.com/fanonwue/go-short-link/internal/repo"
+	"github.com/fanonwue/go-short-link/internal/reqlog"
+	"github.com/fanonwue/go-short-link/internal/srv"
+	"github.com/fanonwue/go-short-link/internal/stats"
+	"github.com/fanonwue/go-short-link/internal/transfer"
+	"github.com/fanonwue/go-short-link/internal/util"
+)
+
+// maxImportRequestSize limits the size of files sent to the import endpoint
+const maxImportRequestSize = 10 * 1024 * 1024
+
+func transferEndpoints() []Endpoint {
+	return []Endpoint{
+		{Pattern: Prefix + "/export", Handler: ExportHandler},
+		{Pattern: Prefix + "/export/{format}", Handler: StaticExportHandler},
+		{Pattern: Prefix + "/import", Handler: ImportHandler, Methods: []srv.HttpMethod{srv.POST}, Role: auth.RoleEditor, MaxBodySize: maxImportRequestSize},
+	}
+}
+
+// exportDocument creates an export of the active mapping, including the click statistics if they are enabled.
+func exportDocument() transfer.Document {
+	links := repo.Links()
+	doc := transfer.Document{
+		ExportedAt: time.Now().UTC(),
+		Source:     repo.DataSource().Id(),
+		Entries:    make([]transfer.Entry, len(links)),
+	}
+
+	var counts map[string]uint64
+	var lastClicks map[string]time.Time
+	if stats.Enabled() {
+		counts = stats.Clicks().Counts()
+		lastClicks = stats.Clicks().LastClicks()
+	}
+
+	for i, link := range links {
+		entry := transfer.Entry{Key: link.Key, Target: link.Target}
+		if counts != nil {
+			clicks := counts[link.Key]
+			entry.Clicks = &clicks
+			if lastClick, found := lastClicks[link.Key]; found {
+				entry.LastClick = &lastClick
+			}
+		}
+		doc.Entries[i] = entry
+	}
+	return doc
+}
+
+// ExportHandler exports the active mapping in the format given by ?format=csv|json|yaml (default json).
+func ExportHandler(w http.ResponseWriter, r *http.Request) {
+	format := transfer.FormatJson
+	if value := r.URL.Query().Get("format"); len(value) > 0 {
+		var err error
+		if format, err = transfer.ParseFormat(value); err != nil {
+			_ = srv.TextResponse(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	h := w.Header()
+	srv.AddDefaultHeaders(h)
+	h.Set("Content-Type", format.ContentType())
+	h.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"links.%s\"", format))
+	w.WriteHeader(http.StatusOK)
+	if srv.NoBodyRequest(r) {
+		return
+	}
+
+	if err := transfer.Encode(w, format, exportDocument()); err != nil {
+		reqlog.FromRequest(r).Errorf("Error writing export: %v", err)
+	}
+}
+
+// StaticExportHandler exports the active mapping as a static server configuration in the format given by the path,
+// see [transfer.StaticFormats]. The number of entries that could not be exported is returned in the
+// X-Skipped-Entries header, the entries themselves are listed in the generated file.
+func StaticExportHandler(w http.ResponseWriter, r *http.Request) {
+	format, err := transfer.ParseStaticFormat(r.PathValue("format"))
+	if err != nil {
+		_ = srv.TextResponse(w, r, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	opts := transfer.StaticOptions{IgnoreCase: conf.Config().IgnoreCaseInPath}
+	if conf.Config().AllowRootRedirect {
+		opts.RootKey = repo.RootKey
+	}
+	// The configuration is generated up front, as the number of skipped entries is sent as a header
+	buf := util.NewBuffer(conf.DefaultBufferSize)
+	skipped, err := transfer.EncodeStatic(buf, format, exportDocument(), opts)
+	if err != nil {
+		reqlog.FromRequest(r).Errorf("Error generating %s export: %v", format, err)
+		_ = srv.TextResponse(w, r, "Error generating export", http.StatusInternalServerError)
+		return
+	}
+
+	h := w.Header()
+	srv.AddDefaultHeaders(h)
+	h.Set("Content-Type", format.ContentType())
+	h.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", format.FileName()))
+	h.Set("X-Skipped-Entries", strconv.Itoa(len(skipped)))
+	w.WriteHeader(http.StatusOK)
+	if srv.NoBodyRequest(r) {
+		return
+	}
+	_, _ = buf.WriteTo(w)
+}
+
+// ImportHandler imports the request body into the data source. The format is given by ?format or the
+// Content-Type header (default json) and may be the export format of another link shortener. The mode is given
+// by ?mode=merge|replace (default merge). With ?dryRun=true, only the changes that would be applied are returned.
+// Replace imports refused by the mass-change guard need ?confirm=true.
+func ImportHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	format, ok := transfer.FormatFromContentType(r.Header.Get("Content-Type"))
+	if !ok {
+		format = transfer.FormatJson
+	}
+	if value := query.Get("format"); len(value) > 0 {
+		var err error
+		if format, err = transfer.ParseImportFormat(value); err != nil {
+			_ = srv.TextResponse(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	mode, err := repo.ParseImportMode(query.Get("mode"))
+	if err != nil {
+		_ = srv.TextResponse(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	dryRun, confirmed := false, false
+	for name, value := range map[string]*bool{"dryRun": &dryRun, "confirm": &confirmed} {
+		if raw := query.Get(name); len(raw) > 0 {
+			if *value, err = strconv.ParseBool(raw); err != nil {
+				_ = srv.TextResponse(w, r, fmt.Sprintf("Invalid value for parameter '%s'", name), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	if !dryRun && !repo.IsWritable() {
+		_ = srv.TextResponse(w, r, repo.ErrReadOnly.Error(), http.StatusMethodNotAllowed)
+		return
+	}
+
+	entries, notes, err := transfer.DecodeReport(http.MaxBytesReader(w, r.Body, maxImportRequestSize), format)
+	if err != nil {
+		invalidBodyResponse(w, r, fmt.Sprintf("Invalid %s input", format), err)
+		return
+	}
+
+	// Imports must not be aborted halfway if the client disconnects
+	result, err := repo.ImportLinks(context.WithoutCancel(r.Context()), entries, mode, dryRun, confirmed)
+	result.Notes = notes
+	switch {
+	case err == nil:
+		_ = srv.JsonResponse(w, r, result, http.StatusOK)
+	case errors.Is(err, repo.ErrImportRejected):
+		_ = srv.JsonResponse(w, r, result, http.StatusUnprocessableEntity)
+	case errors.Is(err, repo.ErrImportGuarded):
+		_ = srv.TextResponse(w, r, err.Error()+", add confirm=true to apply it anyway", http.StatusConflict)
+	case errors.Is(err, repo.ErrEmptyImport):
+		_ = srv.TextResponse(w, r, err.Error(), http.StatusBadRequest)
+	default:
+		linkErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,117 @@
+// Package auth implements the ways clients can authenticate besides the admin credentials: users with roles, named API
+// tokens, JSON Web Tokens issued by an identity provider and sessions of users logged in to the admin UI using OpenID
+// Connect.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"strings"
+
+	"github.com/fanonwue/go-short-link/internal/conf"
+	"github.com/fanonwue/go-short-link/internal/util"
+	"github.com/fanonwue/goutils/logging"
+)
+
+// minSecretLength is the length secrets should have at least, so they cannot be guessed using a leaked hash or cookie
+const minSecretLength = 32
+
+var (
+	jwtVerifier *Verifier
+	roleMapping RoleMapping
+	provider    *Provider
+
+	ErrJwtDisabled = errors.New("JSON Web Tokens are not accepted")
+)
+
+// Setup loads the users and API tokens and sets up the identity provider, if configured.
+func Setup() {
+	setupUsers()
+	setupTokens()
+	setupIdentityProvider()
+}
+
+// OIDC returns the identity provider used to log in to the admin UI, or nil if the login is disabled.
+func OIDC() *Provider {
+	return provider
+}
+
+// JwtEnabled reports whether JSON Web Tokens issued by the identity provider are accepted.
+func JwtEnabled() bool {
+	return jwtVerifier != nil
+}
+
+// AuthenticateJwt verifies a JSON Web Token and returns the principal it identifies, with the roles its claims are
+// mapped to.
+func AuthenticateJwt(ctx context.Context, token string) (Principal, error) {
+	if jwtVerifier == nil {
+		return Principal{}, ErrJwtDisabled
+	}
+	claims, err := jwtVerifier.Verify(ctx, token)
+	if err != nil {
+		return Principal{}, err
+	}
+	return claims.Principal(roleMapping), nil
+}
+
+// checkSecret warns if the secret configured by the environment variable is not set, naming the consequence, or if
+// it is too short to withstand guessing.
+func checkSecret(name string, secret string, consequence string) {
+	if len(secret) == 0 {
+		logging.Warnf("%s is not set, %s", util.PrefixedEnvVar(name), consequence)
+	} else if len(secret) < minSecretLength {
+		logging.Warnf("%s should be at least %d characters long", util.PrefixedEnvVar(name), minSecretLength)
+	}
+}
+
+func setupIdentityProvider() {
+	config := conf.Config()
+	if len(config.OidcIssuer) == 0 {
+		logging.Debug("No OpenID Connect issuer configured, JSON Web Tokens and the admin UI are disabled")
+		return
+	}
+
+	mapping, err := ParseRoleMapping(config.RolesClaim, config.RoleMapping)
+	if err != nil {
+		logging.Panicf("Invalid %s: %v", util.PrefixedEnvVar("ROLE_MAPPING"), err)
+	}
+	if len(mapping.Values) == 0 {
+		logging.Warnf("%s is empty, users of the identity provider will not be granted any role", util.PrefixedEnvVar("ROLE_MAPPING"))
+	}
+	roleMapping = mapping
+
+	keys := NewKeySet(config.JwksSource, config.JwksRefreshPeriod)
+	if len(config.OidcClientId) > 0 && len(config.OidcRedirectUrl) > 0 {
+		sessionSecret := []byte(config.SessionSecret)
+		checkSecret("SESSION_SECRET", config.SessionSecret, "sessions will not survive a restart")
+		if len(sessionSecret) == 0 {
+			sessionSecret = make([]byte, 32)
+			_, _ = rand.Read(sessionSecret)
+		}
+		cookies := NewCookieCodec(sessionSecret, strings.HasPrefix(config.OidcRedirectUrl, "https://"))
+		provider = NewProvider(config.OidcIssuer, config.OidcClientId, config.OidcClientSecret, config.OidcRedirectUrl,
+			config.OidcScopes, keys, mapping, cookies, config.SessionDuration)
+		if len(config.JwksSource) == 0 {
+			keys.resolve = provider.jwksUri
+		}
+		logging.Infof("OpenID Connect login to the admin UI enabled using issuer %s", config.OidcIssuer)
+	}
+
+	audience := config.JwtAudience
+	if len(audience) == 0 {
+		logging.Infof("%s is not set, JSON Web Tokens are not accepted", util.PrefixedEnvVar("JWT_AUDIENCE"))
+		return
+	}
+	if audience == config.OidcClientId {
+		// ID tokens are issued for the client ID, they must not be usable as access tokens for the API
+		logging.Panicf("%s must differ from %s", util.PrefixedEnvVar("JWT_AUDIENCE"), util.PrefixedEnvVar("OIDC_CLIENT_ID"))
+	}
+	if len(config.JwksSource) == 0 && provider == nil {
+		// The key set has to be discovered without a login provider
+		discovery := NewProvider(config.OidcIssuer, "", "", "", nil, keys, mapping, nil, 0)
+		keys.resolve = discovery.jwksUri
+	}
+	jwtVerifier = NewVerifier(config.OidcIssuer, audience, keys)
+	logging.Infof("Accepting JSON Web Tokens issued by %s for audience %s", config.OidcIssuer, audience)
+}
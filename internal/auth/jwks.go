@@ -0,0 +1,289 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fanonwue/goutils/logging"
+)
+
+type (
+	// KeySet is a JSON Web Key Set loaded from a file or URL. The keys are cached and reloaded periodically, or
+	// earlier if a token is signed with an unknown key, to support key rotation.
+	KeySet struct {
+		source string
+		// resolve returns the source if it is not known up front, e.g. because it has to be discovered
+		resolve       func(ctx context.Context) (string, error)
+		client        *http.Client
+		refreshPeriod time.Duration
+		// minRefreshInterval limits reloading the keys because of unknown key IDs
+		minRefreshInterval time.Duration
+		keys               []publicKey
+		fetchedAt          time.Time
+		// refreshing is the refresh in progress, nil if there is none
+		refreshing *keySetRefresh
+		mutex      sync.Mutex
+	}
+
+	// keySetRefresh is a single attempt to reload the keys, shared by all callers waiting for it.
+	keySetRefresh struct {
+		done chan struct{}
+		// err is the result of the attempt, set before done is closed
+		err error
+	}
+
+	publicKey struct {
+		id  string
+		alg string
+		key crypto.PublicKey
+	}
+
+	jsonWebKey struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Use string `json:"use"`
+		Alg string `json:"alg"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+		Crv string `json:"crv"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+	}
+)
+
+const (
+	defaultMinRefreshInterval = time.Minute
+	maxKeySetSize             = 1024 * 1024
+	keySetTimeout             = 10 * time.Second
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// NewKeySet creates a key set loaded from source, which is either an HTTP(S) URL or the path of a file.
+// The refresh period is raised to the minimum refresh interval, so the keys are not fetched for every token.
+func NewKeySet(source string, refreshPeriod time.Duration) *KeySet {
+	return &KeySet{
+		source:             source,
+		client:             &http.Client{Timeout: keySetTimeout},
+		refreshPeriod:      max(refreshPeriod, defaultMinRefreshInterval),
+		minRefreshInterval: defaultMinRefreshInterval,
+	}
+}
+
+// keysFor returns the keys with the given ID, or all keys if the ID is empty.
+func (ks *KeySet) keysFor(ctx context.Context, id string) ([]publicKey, error) {
+	if ks.sinceFetch() >= ks.refreshPeriod {
+		if err := ks.refresh(ctx); err != nil {
+			if len(ks.matching("")) == 0 {
+				return nil, err
+			}
+			logging.Warnf("Could not reload JSON Web Key Set, using cached keys: %v", err)
+		}
+	}
+
+	matching := ks.matching(id)
+	if len(matching) == 0 && ks.sinceFetch() >= ks.minRefreshInterval {
+		// The key may have been rotated since the keys were loaded
+		if err := ks.refresh(ctx); err != nil {
+			return nil, err
+		}
+		matching = ks.matching(id)
+	}
+	if len(matching) == 0 {
+		return nil, fmt.Errorf("%w '%s'", ErrUnknownKey, id)
+	}
+	return matching, nil
+}
+
+func (ks *KeySet) sinceFetch() time.Duration {
+	ks.mutex.Lock()
+	defer ks.mutex.Unlock()
+	return time.Since(ks.fetchedAt)
+}
+
+func (ks *KeySet) matching(id string) []publicKey {
+	ks.mutex.Lock()
+	defer ks.mutex.Unlock()
+
+	var matching []publicKey
+	for _, key := range ks.keys {
+		if len(id) == 0 || key.id == id {
+			matching = append(matching, key)
+		}
+	}
+	return matching
+}
+
+// refresh reloads the keys. The keys are loaded without holding the lock, so the cached keys stay available in the
+// meantime. Callers arriving while the keys are being loaded wait for that attempt instead of starting another one.
+func (ks *KeySet) refresh(ctx context.Context) error {
+	ks.mutex.Lock()
+	current := ks.refreshing
+	if current == nil {
+		current = &keySetRefresh{done: make(chan struct{})}
+		ks.refreshing = current
+		// Failed attempts count as well, so an unavailable source is not queried on every request
+		ks.fetchedAt = time.Now()
+		go ks.load(context.WithoutCancel(ctx), current, ks.source)
+	}
+	ks.mutex.Unlock()
+
+	select {
+	case <-current.done:
+		return current.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// load loads the keys from source and completes the refresh. The load is not bound to the request that started it,
+// as other requests may be waiting for it as well; it is limited by the timeout of the HTTP client instead.
+func (ks *KeySet) load(ctx context.Context, current *keySetRefresh, source string) {
+	var keys []publicKey
+	err := func() error {
+		if len(source) == 0 && ks.resolve != nil {
+			var err error
+			if source, err = ks.resolve(ctx); err != nil {
+				return err
+			}
+		}
+
+		data, err := ks.read(ctx, source)
+		if err != nil {
+			return fmt.Errorf("could not load JSON Web Key Set from %s: %w", source, err)
+		}
+		if keys, err = parseKeySet(data); err != nil {
+			return fmt.Errorf("invalid JSON Web Key Set %s: %w", source, err)
+		}
+		logging.Debugf("Loaded %d keys from JSON Web Key Set %s", len(keys), source)
+		return nil
+	}()
+
+	ks.mutex.Lock()
+	if err == nil {
+		ks.source = source
+		ks.keys = keys
+	}
+	ks.refreshing = nil
+	ks.mutex.Unlock()
+
+	current.err = err
+	close(current.done)
+}
+
+func (ks *KeySet) read(ctx context.Context, source string) ([]byte, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return os.ReadFile(source)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", "application/json")
+	response, err := ks.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", response.Status)
+	}
+	return io.ReadAll(io.LimitReader(response.Body, maxKeySetSize))
+}
+
+// parseKeySet parses the signing keys of a key set. Keys of unsupported types are ignored.
+func parseKeySet(data []byte) ([]publicKey, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	var keys []publicKey
+	for _, jwk := range set.Keys {
+		if len(jwk.Use) > 0 && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			logging.Debugf("Ignoring key '%s' of JSON Web Key Set: %v", jwk.Kid, err)
+			continue
+		}
+		keys = append(keys, publicKey{id: jwk.Kid, alg: jwk.Alg, key: key})
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no supported signing keys")
+	}
+	return keys, nil
+}
+
+func (jwk jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeBase64Int(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBase64Int(jwk.E)
+		if err != nil || !e.IsInt64() {
+			return nil, errors.New("invalid exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve '%s'", jwk.Crv)
+		}
+		x, errX := base64.RawURLEncoding.DecodeString(jwk.X)
+		y, errY := base64.RawURLEncoding.DecodeString(jwk.Y)
+		size := (curve.Params().BitSize + 7) / 8
+		if errX != nil || errY != nil || len(x) > size || len(y) > size {
+			return nil, errors.New("invalid coordinates")
+		}
+		point := make([]byte, 1+2*size)
+		point[0] = 4
+		// Coordinates may omit leading zeros
+		copy(point[1+size-len(x):], x)
+		copy(point[1+2*size-len(y):], y)
+		return ecdsa.ParseUncompressedPublicKey(curve, point)
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if jwk.Crv != "Ed25519" || err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("unsupported or invalid key with curve '%s'", jwk.Crv)
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type '%s'", jwk.Kty)
+}
+
+func decodeBase64Int(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(data) == 0 {
+		return nil, errors.New("invalid integer")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
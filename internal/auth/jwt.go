@@ -0,0 +1,221 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+type (
+	// Claims are the claims of a verified JSON Web Token.
+	Claims map[string]any
+
+	// Verifier verifies JSON Web Tokens signed by an identity provider.
+	Verifier struct {
+		issuer   string
+		audience string
+		keys     *KeySet
+		// leeway is the tolerated clock skew when checking the expiration time
+		leeway time.Duration
+		now    func() time.Time
+	}
+
+	jwtHeader struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+)
+
+const defaultLeeway = time.Minute
+
+var (
+	ErrInvalidJwt = errors.New("invalid token")
+
+	// jwtAlgorithms are the supported signature algorithms, symmetric algorithms and "none" are never accepted
+	jwtAlgorithms = map[string]crypto.Hash{
+		"RS256": crypto.SHA256, "RS384": crypto.SHA384, "RS512": crypto.SHA512,
+		"PS256": crypto.SHA256, "PS384": crypto.SHA384, "PS512": crypto.SHA512,
+		"ES256": crypto.SHA256, "ES384": crypto.SHA384, "ES512": crypto.SHA512,
+		"EdDSA": 0,
+	}
+)
+
+// NewVerifier creates a verifier accepting tokens issued by issuer for audience, signed with one of the keys.
+func NewVerifier(issuer string, audience string, keys *KeySet) *Verifier {
+	return &Verifier{
+		issuer:   issuer,
+		audience: audience,
+		keys:     keys,
+		leeway:   defaultLeeway,
+		now:      time.Now,
+	}
+}
+
+// Verify checks the signature, issuer, audience and validity period of the token and returns its claims.
+func (v *Verifier) Verify(ctx context.Context, token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed", ErrInvalidJwt)
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: invalid header: %v", ErrInvalidJwt, err)
+	}
+	hash, supported := jwtAlgorithms[header.Alg]
+	if !supported {
+		return nil, fmt.Errorf("%w: unsupported algorithm '%s'", ErrInvalidJwt, header.Alg)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid signature encoding", ErrInvalidJwt)
+	}
+
+	keys, err := v.keys.keysFor(ctx, header.Kid)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidJwt, err)
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+	verified := slices.ContainsFunc(keys, func(key publicKey) bool {
+		return (len(key.alg) == 0 || key.alg == header.Alg) && verifySignature(header.Alg, hash, key.key, signed, signature)
+	})
+	if !verified {
+		return nil, fmt.Errorf("%w: signature verification failed", ErrInvalidJwt)
+	}
+
+	var claims Claims
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: invalid claims: %v", ErrInvalidJwt, err)
+	}
+	if err = v.validateClaims(claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidJwt, err)
+	}
+	return claims, nil
+}
+
+func (v *Verifier) validateClaims(claims Claims) error {
+	now := v.now()
+	if issuer, _ := claims["iss"].(string); issuer != v.issuer {
+		return fmt.Errorf("unexpected issuer '%s'", issuer)
+	}
+	if !slices.Contains(claims.Strings("aud"), v.audience) {
+		return fmt.Errorf("token has not been issued for audience '%s'", v.audience)
+	}
+	expiresAt, found := claims.Time("exp")
+	if !found {
+		return errors.New("missing expiration time")
+	}
+	if now.After(expiresAt.Add(v.leeway)) {
+		return errors.New("token has expired")
+	}
+	if notBefore, found := claims.Time("nbf"); found && now.Add(v.leeway).Before(notBefore) {
+		return errors.New("token is not valid yet")
+	}
+	return nil
+}
+
+func verifySignature(alg string, hash crypto.Hash, key crypto.PublicKey, signed []byte, signature []byte) bool {
+	if alg == "EdDSA" {
+		edKey, ok := key.(ed25519.PublicKey)
+		return ok && ed25519.Verify(edKey, signed, signature)
+	}
+
+	hasher := hash.New()
+	hasher.Write(signed)
+	digest := hasher.Sum(nil)
+
+	switch alg[:2] {
+	case "RS":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPKCS1v15(rsaKey, hash, digest, signature) == nil
+	case "PS":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPSS(rsaKey, hash, digest, signature, nil) == nil
+	case "ES":
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return false
+		}
+		// The signature consists of the fixed-size values r and s
+		size := (ecKey.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		return ecdsa.Verify(ecKey, digest, r, s)
+	}
+	return false
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// String returns the claim with the given name, if it is a string.
+func (c Claims) String(name string) string {
+	value, _ := c[name].(string)
+	return value
+}
+
+// Strings returns the claim with the given name as a list of strings. Single strings are returned as a list, and
+// nested claims are separated by dots.
+func (c Claims) Strings(name string) []string {
+	var value any = map[string]any(c)
+	for part := range strings.SplitSeq(name, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = object[part]
+	}
+
+	switch value := value.(type) {
+	case string:
+		return []string{value}
+	case []any:
+		var values []string
+		for _, element := range value {
+			if s, ok := element.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// Time returns the claim with the given name as time, if it is a numeric date.
+func (c Claims) Time(name string) (time.Time, bool) {
+	value, ok := c[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(value), 0), true
+}
+
+// Principal returns the principal identified by the claims, with the roles they are mapped to.
+func (c Claims) Principal(mapping RoleMapping) Principal {
+	name := c.String("preferred_username")
+	if len(name) == 0 {
+		name = c.String("email")
+	}
+	if len(name) == 0 {
+		name = c.String("sub")
+	}
+	return NewPrincipal(name, mapping.RolesFromClaims(c))
+}
@@ -0,0 +1,225 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+type (
+	// Provider implements the OpenID Connect authorization code flow used to log in to the admin UI. The endpoints
+	// of the identity provider are discovered on first use.
+	Provider struct {
+		issuer          string
+		config          oauth2.Config
+		verifier        *Verifier
+		roles           RoleMapping
+		cookies         *CookieCodec
+		sessionDuration time.Duration
+		client          *http.Client
+		metadata        *providerMetadata
+		mutex           sync.Mutex
+	}
+
+	providerMetadata struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		JwksUri               string `json:"jwks_uri"`
+	}
+
+	// loginState is stored in a cookie while the user logs in at the identity provider.
+	loginState struct {
+		State    string `json:"state"`
+		Verifier string `json:"verifier"`
+		Nonce    string `json:"nonce"`
+		ReturnTo string `json:"returnTo"`
+	}
+)
+
+const (
+	discoveryPath  = "/.well-known/openid-configuration"
+	loginTimeout   = 10 * time.Minute
+	sessionPurpose = "session"
+	loginPurpose   = "login"
+	csrfPurpose    = "csrf"
+	// CsrfHeader is the header carrying the CSRF token of API requests authenticated by a session
+	CsrfHeader      = "X-CSRF-Token"
+	maxMetadataSize = 1024 * 1024
+)
+
+var (
+	ErrLoginFailed = errors.New("login failed")
+	ErrNoRole      = errors.New("no role has been assigned to the user")
+)
+
+// NewProvider creates a provider for the given issuer. ID tokens are verified using keys.
+func NewProvider(issuer string, clientId string, clientSecret string, redirectUrl string, scopes []string,
+	keys *KeySet, roles RoleMapping, cookies *CookieCodec, sessionDuration time.Duration) *Provider {
+	return &Provider{
+		issuer: issuer,
+		config: oauth2.Config{
+			ClientID:     clientId,
+			ClientSecret: clientSecret,
+			RedirectURL:  redirectUrl,
+			Scopes:       scopes,
+		},
+		verifier:        NewVerifier(issuer, clientId, keys),
+		roles:           roles,
+		cookies:         cookies,
+		sessionDuration: sessionDuration,
+		client:          &http.Client{Timeout: keySetTimeout},
+	}
+}
+
+// discover returns the metadata of the identity provider, fetching it if it has not been fetched yet.
+func (p *Provider) discover(ctx context.Context) (providerMetadata, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.metadata != nil {
+		return *p.metadata, nil
+	}
+
+	url := strings.TrimSuffix(p.issuer, "/") + discoveryPath
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return providerMetadata{}, err
+	}
+	response, err := p.client.Do(request)
+	if err != nil {
+		return providerMetadata{}, fmt.Errorf("could not discover identity provider: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return providerMetadata{}, fmt.Errorf("could not discover identity provider: unexpected status %s", response.Status)
+	}
+
+	var metadata providerMetadata
+	if err = json.NewDecoder(io.LimitReader(response.Body, maxMetadataSize)).Decode(&metadata); err != nil {
+		return providerMetadata{}, fmt.Errorf("invalid identity provider metadata: %w", err)
+	}
+	if metadata.Issuer != p.issuer {
+		return providerMetadata{}, fmt.Errorf("identity provider metadata is for issuer '%s' instead of '%s'", metadata.Issuer, p.issuer)
+	}
+	p.metadata = &metadata
+	p.config.Endpoint = oauth2.Endpoint{AuthURL: metadata.AuthorizationEndpoint, TokenURL: metadata.TokenEndpoint}
+	return metadata, nil
+}
+
+// jwksUri returns the URL of the key set of the identity provider.
+func (p *Provider) jwksUri(ctx context.Context) (string, error) {
+	metadata, err := p.discover(ctx)
+	if len(metadata.JwksUri) == 0 && err == nil {
+		err = errors.New("identity provider metadata does not contain a jwks_uri")
+	}
+	return metadata.JwksUri, err
+}
+
+// StartLogin returns the URL of the identity provider's login page. The state of the login is stored in a cookie,
+// returnTo is the local path the user is redirected to after logging in.
+func (p *Provider) StartLogin(w http.ResponseWriter, r *http.Request, returnTo string) (string, error) {
+	if _, err := p.discover(r.Context()); err != nil {
+		return "", err
+	}
+
+	state := loginState{
+		State:    randomString(),
+		Verifier: oauth2.GenerateVerifier(),
+		Nonce:    randomString(),
+		ReturnTo: returnTo,
+	}
+	if err := p.cookies.SetCookie(w, loginCookieName, loginPurpose, state, loginTimeout); err != nil {
+		return "", err
+	}
+	return p.config.AuthCodeURL(state.State, oauth2.S256ChallengeOption(state.Verifier),
+		oauth2.SetAuthURLParam("nonce", state.Nonce)), nil
+}
+
+// FinishLogin handles the redirect back from the identity provider. The authorization code is exchanged for an
+// ID token, whose claims are mapped to the roles of the session. It returns the path to redirect the user to.
+func (p *Provider) FinishLogin(w http.ResponseWriter, r *http.Request) (Principal, string, error) {
+	var state loginState
+	if err := p.cookies.Cookie(r, loginCookieName, loginPurpose, &state); err != nil {
+		return Principal{}, "", fmt.Errorf("%w: %v", ErrLoginFailed, err)
+	}
+	p.cookies.ClearCookie(w, loginCookieName)
+
+	query := r.URL.Query()
+	if errorCode := query.Get("error"); len(errorCode) > 0 {
+		return Principal{}, "", fmt.Errorf("%w: identity provider returned %s: %s", ErrLoginFailed, errorCode, query.Get("error_description"))
+	}
+	if query.Get("state") != state.State {
+		return Principal{}, "", fmt.Errorf("%w: state mismatch", ErrLoginFailed)
+	}
+	if _, err := p.discover(r.Context()); err != nil {
+		return Principal{}, "", err
+	}
+
+	ctx := context.WithValue(r.Context(), oauth2.HTTPClient, p.client)
+	token, err := p.config.Exchange(ctx, query.Get("code"), oauth2.VerifierOption(state.Verifier))
+	if err != nil {
+		return Principal{}, "", fmt.Errorf("%w: could not exchange code: %v", ErrLoginFailed, err)
+	}
+	idToken, _ := token.Extra("id_token").(string)
+	claims, err := p.verifier.Verify(r.Context(), idToken)
+	if err != nil {
+		return Principal{}, "", fmt.Errorf("%w: %v", ErrLoginFailed, err)
+	}
+	if claims.String("nonce") != state.Nonce {
+		return Principal{}, "", fmt.Errorf("%w: nonce mismatch", ErrLoginFailed)
+	}
+
+	principal := claims.Principal(p.roles)
+	if len(principal.Roles) == 0 {
+		return principal, "", fmt.Errorf("%w: %s", ErrNoRole, principal.Name)
+	}
+	if err = p.cookies.SetCookie(w, SessionCookieName, sessionPurpose, principal, p.sessionDuration); err != nil {
+		return principal, "", err
+	}
+	return principal, state.ReturnTo, nil
+}
+
+// Session returns the principal of the session the request belongs to.
+func (p *Provider) Session(r *http.Request) (Principal, bool) {
+	var principal Principal
+	err := p.cookies.Cookie(r, SessionCookieName, sessionPurpose, &principal)
+	return principal, err == nil
+}
+
+// CsrfToken returns the token requests authenticated by the session have to carry to protect against cross-site
+// request forgery. It is bound to the session, so it changes with every login.
+func (p *Provider) CsrfToken(r *http.Request) string {
+	cookie, err := r.Cookie(SessionCookieName)
+	if err != nil {
+		return ""
+	}
+	return p.cookies.sign(csrfPurpose + ":" + cookie.Value)
+}
+
+// VerifyCsrf checks the CSRF token sent with a request authenticated by the session.
+func (p *Provider) VerifyCsrf(r *http.Request, token string) bool {
+	expected := p.CsrfToken(r)
+	return len(expected) > 0 && hmac.Equal([]byte(token), []byte(expected))
+}
+
+// Logout ends the session.
+func (p *Provider) Logout(w http.ResponseWriter) {
+	p.cookies.ClearCookie(w, SessionCookieName)
+}
+
+func randomString() string {
+	data := make([]byte, 24)
+	_, _ = rand.Read(data)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
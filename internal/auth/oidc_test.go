@@ -0,0 +1,304 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testIssuer is a local stand-in for an identity provider. It serves the discovery document, the key set and a
+// token endpoint returning an ID token with the claims of the next login.
+type testIssuer struct {
+	server *httptest.Server
+	keyId  string
+	key    *rsa.PrivateKey
+	claims map[string]any
+	nonce  string
+	mutex  sync.Mutex
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	issuer := &testIssuer{}
+	issuer.rotateKey(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(providerMetadata{
+			Issuer:                issuer.server.URL,
+			AuthorizationEndpoint: issuer.server.URL + "/authorize",
+			TokenEndpoint:         issuer.server.URL + "/token",
+			JwksUri:               issuer.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		issuer.mutex.Lock()
+		defer issuer.mutex.Unlock()
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": issuer.keyId,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(issuer.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(issuer.key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "test-code" || len(r.FormValue("code_verifier")) == 0 {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		claims := issuer.claims
+		claims["nonce"] = issuer.nonce
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"id_token":     issuer.sign(t, "RS256", claims),
+		})
+	})
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+	return issuer
+}
+
+func (i *testIssuer) rotateKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.key = key
+	i.keyId = randomString()
+}
+
+func (i *testIssuer) sign(t *testing.T, alg string, claims map[string]any) string {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": i.keyId, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	if alg == "none" {
+		return signed + "."
+	}
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, i.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func (i *testIssuer) claimsFor(audience string, groups ...string) map[string]any {
+	return map[string]any{
+		"iss":                i.server.URL,
+		"aud":                audience,
+		"sub":                "1234",
+		"preferred_username": "jane",
+		"groups":             groups,
+		"exp":                time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func TestVerifier(t *testing.T) {
+	issuer := newTestIssuer(t)
+	keys := NewKeySet(issuer.server.URL+"/jwks", time.Hour)
+	keys.minRefreshInterval = 0
+	verifier := NewVerifier(issuer.server.URL, "short-link", keys)
+	mapping, err := ParseRoleMapping("groups", "Link-Editors=editor, Admins=admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := verifier.Verify(t.Context(), issuer.sign(t, "RS256", issuer.claimsFor("short-link", "Link-Editors", "other")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	principal := claims.Principal(mapping)
+	if principal.Name != "jane" || !principal.HasScope(ScopeWriteLinks) || principal.HasScope(ScopeAdminUpdate) {
+		t.Errorf("unexpected principal %+v", principal)
+	}
+
+	expired := issuer.claimsFor("short-link")
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+	notYetValid := issuer.claimsFor("short-link")
+	notYetValid["nbf"] = time.Now().Add(time.Hour).Unix()
+	wrongIssuer := issuer.claimsFor("short-link")
+	wrongIssuer["iss"] = "https://attacker.example"
+	noExpiration := issuer.claimsFor("short-link")
+	delete(noExpiration, "exp")
+
+	invalid := map[string]string{
+		"expired":         issuer.sign(t, "RS256", expired),
+		"not yet valid":   issuer.sign(t, "RS256", notYetValid),
+		"wrong issuer":    issuer.sign(t, "RS256", wrongIssuer),
+		"wrong audience":  issuer.sign(t, "RS256", issuer.claimsFor("other")),
+		"no expiration":   issuer.sign(t, "RS256", noExpiration),
+		"alg none":        issuer.sign(t, "none", issuer.claimsFor("short-link")),
+		"alg symmetric":   issuer.sign(t, "HS256", issuer.claimsFor("short-link")),
+		"malformed":       "abc.def",
+		"tampered claims": tamper(issuer.sign(t, "RS256", issuer.claimsFor("short-link")), issuer.claimsFor("short-link", "Admins")),
+	}
+	for name, token := range invalid {
+		if _, err := verifier.Verify(t.Context(), token); !errors.Is(err, ErrInvalidJwt) {
+			t.Errorf("%s: expected token to be rejected, got %v", name, err)
+		}
+	}
+
+	// Tokens signed with a new key are accepted once the key set has been reloaded
+	issuer.rotateKey(t)
+	if _, err = verifier.Verify(t.Context(), issuer.sign(t, "RS256", issuer.claimsFor("short-link"))); err != nil {
+		t.Errorf("expected token signed with rotated key to be accepted, got %v", err)
+	}
+}
+
+func TestKeySetRefresh(t *testing.T) {
+	issuer := newTestIssuer(t)
+	release := make(chan struct{})
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) > 1 {
+			<-release
+		}
+		response, err := http.Get(issuer.server.URL + "/jwks")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer response.Body.Close()
+		_, _ = io.Copy(w, response.Body)
+	}))
+	t.Cleanup(server.Close)
+
+	keys := NewKeySet(server.URL, time.Hour)
+	if _, err := keys.keysFor(t.Context(), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// Let the keys expire, so the next call reloads them while the key set server is blocked
+	keys.mutex.Lock()
+	keys.fetchedAt = time.Time{}
+	keys.mutex.Unlock()
+	refreshed := make(chan error, 1)
+	go func() {
+		_, err := keys.keysFor(t.Context(), "")
+		refreshed <- err
+	}()
+	for requests.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), time.Second)
+	defer cancel()
+	if cached, err := keys.keysFor(ctx, ""); err != nil || len(cached) != 1 {
+		t.Errorf("expected the cached keys to be available while reloading, got %v (%v)", cached, err)
+	}
+
+	close(release)
+	if err := <-refreshed; err != nil {
+		t.Errorf("expected the keys to be reloaded, got %v", err)
+	}
+	if requests.Load() != 2 {
+		t.Errorf("expected the key set to be loaded twice, got %d requests", requests.Load())
+	}
+}
+
+func TestKeySetRefreshPeriod(t *testing.T) {
+	issuer := newTestIssuer(t)
+	keys := NewKeySet(issuer.server.URL+"/jwks", 0)
+	if _, err := keys.keysFor(t.Context(), ""); err != nil {
+		t.Fatal(err)
+	}
+	fetchedAt := keys.fetchedAt
+	if _, err := keys.keysFor(t.Context(), ""); err != nil {
+		t.Fatal(err)
+	}
+	if !keys.fetchedAt.Equal(fetchedAt) {
+		t.Error("expected a refresh period of 0 not to reload the keys on every call")
+	}
+}
+
+// tamper replaces the claims of a signed token, keeping the original signature.
+func tamper(token string, claims map[string]any) string {
+	parts := strings.Split(token, ".")
+	payload, _ := json.Marshal(claims)
+	return parts[0] + "." + base64.RawURLEncoding.EncodeToString(payload) + "." + parts[2]
+}
+
+func TestProviderLogin(t *testing.T) {
+	issuer := newTestIssuer(t)
+	keys := NewKeySet("", time.Hour)
+	mapping, _ := ParseRoleMapping("groups", "Admins=admin")
+	provider := NewProvider(issuer.server.URL, "short-link", "secret", "http://localhost/_admin/callback",
+		[]string{"openid"}, keys, mapping, NewCookieCodec([]byte("key"), false), time.Hour)
+	keys.resolve = provider.jwksUri
+
+	login := func(groups ...string) (*httptest.ResponseRecorder, error) {
+		recorder := httptest.NewRecorder()
+		loginUrl, err := provider.StartLogin(recorder, httptest.NewRequest(http.MethodGet, "/_admin/login", nil), "/_admin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, _ := url.Parse(loginUrl)
+		query := parsed.Query()
+		if !strings.HasPrefix(loginUrl, issuer.server.URL+"/authorize?") || query.Get("code_challenge_method") != "S256" {
+			t.Fatalf("unexpected login URL %s", loginUrl)
+		}
+		issuer.claims = issuer.claimsFor("short-link", groups...)
+		issuer.nonce = query.Get("nonce")
+
+		callback := httptest.NewRequest(http.MethodGet, "/_admin/callback?code=test-code&state="+query.Get("state"), nil)
+		for _, cookie := range recorder.Result().Cookies() {
+			callback.AddCookie(cookie)
+		}
+		recorder = httptest.NewRecorder()
+		_, returnTo, err := provider.FinishLogin(recorder, callback)
+		if err == nil && returnTo != "/_admin" {
+			t.Errorf("unexpected return path %s", returnTo)
+		}
+		return recorder, err
+	}
+
+	recorder, err := login("Admins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := httptest.NewRequest(http.MethodGet, "/_admin", nil)
+	for _, cookie := range recorder.Result().Cookies() {
+		request.AddCookie(cookie)
+	}
+	if principal, ok := provider.Session(request); !ok || principal.Name != "jane" || !principal.HasScope(ScopeAdminUpdate) {
+		t.Errorf("expected an admin session, got %+v", principal)
+	}
+
+	csrfToken := provider.CsrfToken(request)
+	if !provider.VerifyCsrf(request, csrfToken) || provider.VerifyCsrf(request, csrfToken+"x") {
+		t.Error("expected only the CSRF token of the session to be accepted")
+	}
+	if provider.VerifyCsrf(httptest.NewRequest(http.MethodPost, "/_api/update-mapping", nil), csrfToken) {
+		t.Error("expected CSRF token to be rejected without the session")
+	}
+
+	if _, err = login("Users"); !errors.Is(err, ErrNoRole) {
+		t.Errorf("expected login without a role to be rejected, got %v", err)
+	}
+
+	// A callback without the login cookie is rejected
+	if _, _, err = provider.FinishLogin(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/_admin/callback?code=test-code", nil)); !errors.Is(err, ErrLoginFailed) {
+		t.Errorf("expected callback without login state to fail, got %v", err)
+	}
+}
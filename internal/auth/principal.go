@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+type (
+	// Role is a set of scopes assigned to users authenticated by an identity provider.
+	Role string
+
+	// Principal is the authenticated client of a request.
+	Principal struct {
+		Name   string  `json:"name"`
+		Roles  []Role  `json:"roles,omitempty"`
+		Scopes []Scope `json:"scopes"`
+	}
+
+	// RoleMapping maps the values of a claim, e.g. the groups of a user, to roles.
+	RoleMapping struct {
+		// Claim is the name of the claim, nested claims are separated by dots (e.g. realm_access.roles)
+		Claim  string
+		Values map[string]Role
+	}
+
+	principalKey struct{}
+)
+
+const (
+	// RoleAnonymous is required by endpoints that can be accessed without authentication. It cannot be assigned.
+	RoleAnonymous Role = "anonymous"
+	RoleViewer    Role = "viewer"
+	RoleEditor    Role = "editor"
+	RoleAdmin     Role = "admin"
+)
+
+var (
+	Roles = []Role{RoleViewer, RoleEditor, RoleAdmin}
+
+	roleScopes = map[Role][]Scope{
+		RoleViewer: {ScopeReadInfo},
+		RoleEditor: {ScopeReadInfo, ScopeWriteLinks},
+		RoleAdmin:  Scopes,
+	}
+
+	// roleScope is the scope that sets a role apart from the roles below it
+	roleScope = map[Role]Scope{
+		RoleViewer: ScopeReadInfo,
+		RoleEditor: ScopeWriteLinks,
+		RoleAdmin:  ScopeAdminUpdate,
+	}
+)
+
+func ParseRole(value string) (Role, error) {
+	role := Role(strings.ToLower(strings.TrimSpace(value)))
+	if !slices.Contains(Roles, role) {
+		return "", fmt.Errorf("invalid role '%s', must be one of %v", value, Roles)
+	}
+	return role, nil
+}
+
+// ParseRoleMapping parses a comma-separated list of entries of the form value=role.
+func ParseRoleMapping(claim string, raw string) (RoleMapping, error) {
+	mapping := RoleMapping{Claim: claim, Values: make(map[string]Role)}
+	for entry := range strings.SplitSeq(raw, ",") {
+		if len(strings.TrimSpace(entry)) == 0 {
+			continue
+		}
+		value, rawRole, found := strings.Cut(entry, "=")
+		if !found {
+			return mapping, fmt.Errorf("invalid role mapping '%s', must be of the form value=role", entry)
+		}
+		role, err := ParseRole(rawRole)
+		if err != nil {
+			return mapping, err
+		}
+		mapping.Values[strings.TrimSpace(value)] = role
+	}
+	return mapping, nil
+}
+
+// RolesFromClaims returns the roles the claims are mapped to. The claim may be a single string or a list of strings.
+func (m RoleMapping) RolesFromClaims(claims Claims) []Role {
+	var roles []Role
+	for _, value := range claims.Strings(m.Claim) {
+		if role, found := m.Values[value]; found && !slices.Contains(roles, role) {
+			roles = append(roles, role)
+		}
+	}
+	slices.Sort(roles)
+	return roles
+}
+
+// AdminPrincipal returns the principal of a client using the admin credentials, which grant all scopes.
+func AdminPrincipal(name string) Principal {
+	return Principal{Name: name, Roles: []Role{RoleAdmin}, Scopes: Scopes}
+}
+
+// NewPrincipal creates a principal with the scopes of the given roles.
+func NewPrincipal(name string, roles []Role) Principal {
+	var scopes []Scope
+	for _, role := range roles {
+		scopes = append(scopes, roleScopes[role]...)
+	}
+	return Principal{Name: name, Roles: roles, Scopes: slices.Compact(slices.Sorted(slices.Values(scopes)))}
+}
+
+func (p Principal) HasScope(scope Scope) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+// Grants reports whether the principal may access endpoints requiring role. Principals without roles, e.g. API tokens,
+// need the scope that sets the role apart from the roles below it.
+func (p Principal) Grants(role Role) bool {
+	return role == RoleAnonymous || p.HasScope(roleScope[role])
+}
+
+// WithPrincipal returns a copy of ctx carrying the principal the request has been authenticated as.
+func WithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the principal carried by ctx. The second return value is false if there is none.
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(Principal)
+	return principal, ok
+}
@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type (
+	// CookieCodec signs values stored in cookies, so they cannot be changed by the client. The values are not
+	// encrypted.
+	CookieCodec struct {
+		key    []byte
+		secure bool
+	}
+
+	signedValue struct {
+		Purpose   string          `json:"p"`
+		ExpiresAt int64           `json:"e"`
+		Value     json.RawMessage `json:"v"`
+	}
+)
+
+const (
+	SessionCookieName = "gsl_session"
+	loginCookieName   = "gsl_login"
+)
+
+var ErrInvalidCookie = errors.New("invalid or expired cookie")
+
+func NewCookieCodec(key []byte, secure bool) *CookieCodec {
+	return &CookieCodec{key: key, secure: secure}
+}
+
+// SetCookie stores value in a signed cookie. The purpose is part of the signature, so a cookie cannot be used in
+// place of another one.
+func (c *CookieCodec) SetCookie(w http.ResponseWriter, name string, purpose string, value any, maxAge time.Duration) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(maxAge)
+	payload, err := json.Marshal(signedValue{Purpose: purpose, ExpiresAt: expiresAt.Unix(), Value: raw})
+	if err != nil {
+		return err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    encoded + "." + c.sign(encoded),
+		Path:     "/",
+		Expires:  expiresAt,
+		MaxAge:   int(maxAge.Seconds()),
+		Secure:   c.secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// Cookie reads the signed cookie with the given name and purpose into value.
+func (c *CookieCodec) Cookie(r *http.Request, name string, purpose string, value any) error {
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return ErrInvalidCookie
+	}
+	encoded, signature, found := strings.Cut(cookie.Value, ".")
+	if !found || !hmac.Equal([]byte(signature), []byte(c.sign(encoded))) {
+		return ErrInvalidCookie
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return ErrInvalidCookie
+	}
+	var signed signedValue
+	if err = json.Unmarshal(payload, &signed); err != nil {
+		return ErrInvalidCookie
+	}
+	if signed.Purpose != purpose || time.Now().Unix() > signed.ExpiresAt {
+		return ErrInvalidCookie
+	}
+	if err = json.Unmarshal(signed.Value, value); err != nil {
+		return ErrInvalidCookie
+	}
+	return nil
+}
+
+// ClearCookie removes the cookie with the given name.
+func (c *CookieCodec) ClearCookie(w http.ResponseWriter, name string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		Secure:   c.secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (c *CookieCodec) sign(encoded string) string {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
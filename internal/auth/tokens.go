@@ -0,0 +1,308 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/fanonwue/go-short-link/internal/conf"
+	"github.com/fanonwue/goutils/logging"
+)
+
+type (
+	// Scope grants access to a group of API endpoints.
+	Scope string
+
+	// Token is a named API token. Only the hash of its secret is stored, the token itself is returned once when it
+	// is created.
+	Token struct {
+		Id        string     `json:"id"`
+		Name      string     `json:"name"`
+		Scopes    []Scope    `json:"scopes"`
+		CreatedAt time.Time  `json:"createdAt"`
+		ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+		hash      string
+	}
+
+	// tokenFileEntry is a token as stored in the token file
+	tokenFileEntry struct {
+		Token
+		Hash string `json:"hash"`
+	}
+
+	// TokenStore holds all tokens and persists them to a file.
+	TokenStore struct {
+		path   string
+		secret []byte
+		tokens map[string]Token
+		mutex  sync.RWMutex
+	}
+)
+
+const (
+	// ScopeReadInfo allows reading the mapping, statistics, reports and history
+	ScopeReadInfo Scope = "read:info"
+	// ScopeWriteLinks allows creating, changing and deleting links, including imports
+	ScopeWriteLinks Scope = "write:links"
+	// ScopeAdminUpdate allows updating, rolling back and pinning the mapping, and managing tokens
+	ScopeAdminUpdate Scope = "admin:update"
+
+	// tokenPrefix makes tokens recognizable, e.g. for secret scanners
+	tokenPrefix   = "gsl_"
+	tokenIdBytes  = 6
+	tokenKeyBytes = 32
+	maxNameLength = 100
+	tokenFileMode = 0600
+)
+
+var (
+	Scopes          = []Scope{ScopeReadInfo, ScopeWriteLinks, ScopeAdminUpdate}
+	ErrInvalidScope = errors.New("invalid scope")
+	ErrInvalidName  = errors.New("invalid token name")
+	ErrUnknownToken = errors.New("unknown token")
+	tokens          *TokenStore
+)
+
+func ParseScope(value string) (Scope, error) {
+	scope := Scope(strings.TrimSpace(value))
+	if !slices.Contains(Scopes, scope) {
+		return "", fmt.Errorf("%w '%s', must be one of %v", ErrInvalidScope, value, Scopes)
+	}
+	return scope, nil
+}
+
+// Tokens returns the token store, or nil if tokens are disabled.
+func Tokens() *TokenStore {
+	return tokens
+}
+
+// setupTokens loads the tokens from the configured token file. Tokens are disabled if no token file is configured.
+func setupTokens() {
+	path := conf.Config().TokenFile
+	if len(path) == 0 {
+		logging.Info("No token file configured, API tokens are disabled")
+		return
+	}
+
+	store := NewTokenStore(path, []byte(conf.Config().TokenSecret))
+	if err := store.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		logging.Panicf("Could not load API tokens from %s: %v", path, err)
+	}
+	checkSecret("TOKEN_SECRET", conf.Config().TokenSecret, "API tokens are hashed without a secret key")
+	tokens = store
+	logging.Infof("Loaded %d API tokens from %s", store.Len(), path)
+}
+
+// NewTokenStore creates an empty store persisting its tokens to path. The hashes of the tokens are keyed with
+// secret, so a leaked token file cannot be used to verify guessed tokens without it.
+func NewTokenStore(path string, secret []byte) *TokenStore {
+	return &TokenStore{
+		path:   path,
+		secret: secret,
+		tokens: make(map[string]Token),
+	}
+}
+
+func (s *TokenStore) Len() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return len(s.tokens)
+}
+
+// List returns all tokens, sorted by creation time.
+func (s *TokenStore) List() []Token {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	list := slices.AppendSeq(make([]Token, 0, len(s.tokens)), maps.Values(s.tokens))
+	slices.SortFunc(list, func(a, b Token) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return list
+}
+
+// Create adds a new token and returns it along with the secret token string, which is not stored.
+func (s *TokenStore) Create(name string, scopes []Scope, expiresAt *time.Time) (Token, string, error) {
+	name = strings.TrimSpace(name)
+	if len(name) == 0 || len(name) > maxNameLength || strings.ContainsFunc(name, unicode.IsControl) {
+		return Token{}, "", fmt.Errorf("%w: must have 1 to %d characters", ErrInvalidName, maxNameLength)
+	}
+	if len(scopes) == 0 {
+		return Token{}, "", fmt.Errorf("%w: at least one scope is required", ErrInvalidScope)
+	}
+
+	idBytes := make([]byte, tokenIdBytes)
+	keyBytes := make([]byte, tokenKeyBytes)
+	_, _ = rand.Read(idBytes)
+	_, _ = rand.Read(keyBytes)
+	id := hex.EncodeToString(idBytes)
+	value := tokenPrefix + id + "_" + base64.RawURLEncoding.EncodeToString(keyBytes)
+
+	token := Token{
+		Id:        id,
+		Name:      name,
+		Scopes:    slices.Compact(slices.Sorted(slices.Values(scopes))),
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: expiresAt,
+		hash:      s.hash(value),
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.tokens[id] = token
+	if err := s.save(); err != nil {
+		delete(s.tokens, id)
+		return Token{}, "", err
+	}
+	return token, value, nil
+}
+
+// Revoke removes the token with the given ID.
+func (s *TokenStore) Revoke(id string) (Token, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	token, found := s.tokens[id]
+	if !found {
+		return token, fmt.Errorf("%w: %s", ErrUnknownToken, id)
+	}
+	delete(s.tokens, id)
+	if err := s.save(); err != nil {
+		s.tokens[id] = token
+		return Token{}, err
+	}
+	return token, nil
+}
+
+// IsToken reports whether value looks like an API token, as opposed to e.g. a JSON Web Token.
+func IsToken(value string) bool {
+	return strings.HasPrefix(value, tokenPrefix)
+}
+
+// Authenticate returns the token matching the given token string, if it exists and has not expired.
+func (s *TokenStore) Authenticate(value string) (Token, bool) {
+	id, _, ok := strings.Cut(strings.TrimPrefix(value, tokenPrefix), "_")
+	if !ok || !strings.HasPrefix(value, tokenPrefix) {
+		return Token{}, false
+	}
+
+	s.mutex.RLock()
+	token, found := s.tokens[id]
+	s.mutex.RUnlock()
+	if !found || !hmac.Equal([]byte(token.hash), []byte(s.hash(value))) {
+		return Token{}, false
+	}
+	if token.Expired(time.Now()) {
+		return Token{}, false
+	}
+	return token, true
+}
+
+func (s *TokenStore) hash(value string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Load replaces the tokens with the ones stored in the token file.
+func (s *TokenStore) Load() error {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+
+	var entries []tokenFileEntry
+	if err = json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.tokens = make(map[string]Token, len(entries))
+	for _, entry := range entries {
+		token := entry.Token
+		token.hash = entry.Hash
+		s.tokens[token.Id] = token
+	}
+	return nil
+}
+
+// save writes all tokens to the token file, replacing it atomically and durably. The caller has to hold the lock.
+func (s *TokenStore) save() error {
+	entries := make([]tokenFileEntry, 0, len(s.tokens))
+	for _, token := range s.tokens {
+		entries = append(entries, tokenFileEntry{Token: token, Hash: token.hash})
+	}
+	slices.SortFunc(entries, func(a, b tokenFileEntry) int {
+		return strings.Compare(a.Id, b.Id)
+	})
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	tempFile, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tempFile.Name()) }()
+
+	err = tempFile.Chmod(tokenFileMode)
+	if err == nil {
+		_, err = tempFile.Write(data)
+	}
+	if err == nil {
+		err = tempFile.Sync()
+	}
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tempFile.Name(), s.path)
+	}
+	if err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(s.path))
+}
+
+// syncDir makes the rename of the token file durable, so a created token cannot be lost after it has been shown.
+func syncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	err = dir.Sync()
+	if closeErr := dir.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Principal returns the principal of clients authenticated with the token.
+func (t Token) Principal() Principal {
+	return Principal{Name: "token:" + t.Name, Scopes: t.Scopes}
+}
+
+// HasScope reports whether the token grants the given scope.
+func (t Token) HasScope(scope Scope) bool {
+	return slices.Contains(t.Scopes, scope)
+}
+
+func (t Token) Expired(now time.Time) bool {
+	return t.ExpiresAt != nil && now.After(*t.ExpiresAt)
+}
@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTokenStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	store := NewTokenStore(path, []byte("secret"))
+
+	token, value, err := store.Create("ci", []Scope{ScopeWriteLinks, ScopeReadInfo, ScopeWriteLinks}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(token.Scopes) != 2 || !token.HasScope(ScopeReadInfo) || token.HasScope(ScopeAdminUpdate) {
+		t.Errorf("unexpected scopes %v", token.Scopes)
+	}
+	if _, _, err = store.Create(" ", []Scope{ScopeReadInfo}, nil); err == nil {
+		t.Error("expected an error for an empty name")
+	}
+
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != tokenFileMode {
+		t.Errorf("expected token file with mode %o, got %v (%v)", tokenFileMode, info, err)
+	}
+	if files, _ := os.ReadDir(filepath.Dir(path)); len(files) != 1 {
+		t.Errorf("expected only the token file to remain, got %d files", len(files))
+	}
+
+	// Reload the tokens from the file, which only contains the hash
+	reloaded := NewTokenStore(path, []byte("secret"))
+	if err = reloaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if authenticated, ok := reloaded.Authenticate(value); !ok || authenticated.Name != "ci" {
+		t.Errorf("expected token to be accepted after reloading, got %v", authenticated)
+	}
+	for _, invalid := range []string{"", value + "x", value[:len(value)-1], "gsl_" + token.Id} {
+		if _, ok := reloaded.Authenticate(invalid); ok {
+			t.Errorf("expected %q to be rejected", invalid)
+		}
+	}
+
+	otherSecret := NewTokenStore(path, []byte("other"))
+	_ = otherSecret.Load()
+	if _, ok := otherSecret.Authenticate(value); ok {
+		t.Error("expected token to be rejected when the secret differs")
+	}
+
+	expiresAt := time.Now().Add(-time.Minute)
+	_, expiredValue, _ := store.Create("expired", []Scope{ScopeReadInfo}, &expiresAt)
+	if _, ok := store.Authenticate(expiredValue); ok {
+		t.Error("expected expired token to be rejected")
+	}
+
+	if _, err = store.Revoke(token.Id); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.Authenticate(value); ok {
+		t.Error("expected revoked token to be rejected")
+	}
+	if _, err = store.Revoke(token.Id); err == nil {
+		t.Error("expected an error when revoking an unknown token")
+	}
+}
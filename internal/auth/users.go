@@ -0,0 +1,239 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fanonwue/go-short-link/internal/conf"
+	"github.com/fanonwue/go-short-link/internal/util"
+	"github.com/fanonwue/goutils/logging"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type (
+	// UserStore holds the users of an htpasswd-style file. Each line consists of the username, the bcrypt hash of the
+	// password and optionally a comma-separated list of roles, separated by colons. Users without roles are viewers.
+	// The file is reloaded when it changes.
+	UserStore struct {
+		path    string
+		users   map[string]user
+		modTime time.Time
+		// checkedAt is the time the file has last been checked for changes
+		checkedAt time.Time
+		// verified caches successful logins, so bcrypt only has to be run once per user and password
+		verified map[string]verifiedLogin
+		cacheKey []byte
+		mutex    sync.Mutex
+	}
+
+	user struct {
+		hash  []byte
+		roles []Role
+	}
+
+	verifiedLogin struct {
+		mac       []byte
+		expiresAt time.Time
+	}
+)
+
+const (
+	userFileCheckInterval = 5 * time.Second
+	verifiedLoginTtl      = 5 * time.Minute
+)
+
+var (
+	users *UserStore
+
+	// dummyHash is compared against for unknown users, so they take as long to reject as wrong passwords
+	dummyHash = sync.OnceValue(func() []byte {
+		hash, _ := util.HashPassword([]byte("dummy"))
+		return hash
+	})
+)
+
+// Users returns the user store, or nil if no users file is configured.
+func Users() *UserStore {
+	return users
+}
+
+// setupUsers loads the users from the configured users file.
+func setupUsers() {
+	path := conf.Config().UsersFile
+	if len(path) == 0 {
+		return
+	}
+
+	store := NewUserStore(path)
+	if err := store.Load(); err != nil {
+		logging.Panicf("Could not load users from %s: %v", path, err)
+	}
+	users = store
+	logging.Infof("Loaded %d users from %s", store.Len(), path)
+}
+
+func NewUserStore(path string) *UserStore {
+	cacheKey := make([]byte, 32)
+	_, _ = rand.Read(cacheKey)
+	return &UserStore{
+		path:     path,
+		users:    make(map[string]user),
+		verified: make(map[string]verifiedLogin),
+		cacheKey: cacheKey,
+	}
+}
+
+func (s *UserStore) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.users)
+}
+
+// Load replaces the users with the ones in the users file.
+func (s *UserStore) Load() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.load()
+}
+
+// load reads the users file. The caller has to hold the lock.
+func (s *UserStore) load() error {
+	s.checkedAt = time.Now()
+	file, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	parsed, err := parseUsers(file)
+	if err != nil {
+		return err
+	}
+	s.users = parsed
+	s.modTime = info.ModTime()
+	clear(s.verified)
+	return nil
+}
+
+func parseUsers(r io.Reader) (map[string]user, error) {
+	parsed := make(map[string]user)
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, ":")
+		if len(fields) < 2 || len(fields) > 3 || len(fields[0]) == 0 {
+			return nil, fmt.Errorf("line %d: expected user:hash or user:hash:roles", lineNumber)
+		}
+		name, hash := fields[0], []byte(fields[1])
+		if _, err := bcrypt.Cost(hash); err != nil {
+			return nil, fmt.Errorf("line %d: password of %s is not a bcrypt hash", lineNumber, name)
+		}
+		if _, found := parsed[name]; found {
+			return nil, fmt.Errorf("line %d: duplicate user %s", lineNumber, name)
+		}
+
+		roles := []Role{RoleViewer}
+		if len(fields) == 3 && len(strings.TrimSpace(fields[2])) > 0 {
+			roles = nil
+			for value := range strings.SplitSeq(fields[2], ",") {
+				role, err := ParseRole(value)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+				}
+				roles = append(roles, role)
+			}
+		}
+		parsed[name] = user{hash: hash, roles: roles}
+	}
+	return parsed, scanner.Err()
+}
+
+// reloadIfChanged reloads the users file if it has been modified. If it cannot be loaded, the previous users are kept.
+// The caller has to hold the lock.
+func (s *UserStore) reloadIfChanged() {
+	if time.Since(s.checkedAt) < userFileCheckInterval {
+		return
+	}
+	s.checkedAt = time.Now()
+	info, err := os.Stat(s.path)
+	if err != nil || info.ModTime().Equal(s.modTime) {
+		if err != nil {
+			logging.Warnf("Could not check users file %s for changes: %v", s.path, err)
+		}
+		return
+	}
+
+	if err = s.load(); err != nil {
+		logging.Errorf("Could not reload users from %s, keeping the previous users: %v", s.path, err)
+		return
+	}
+	logging.Infof("Reloaded %d users from %s", len(s.users), s.path)
+}
+
+// Authenticate checks the password of a user and returns the principal with the user's roles.
+func (s *UserStore) Authenticate(name string, password string) (Principal, bool) {
+	if principal, ok := s.AuthenticateCached(name, password); ok {
+		return principal, true
+	}
+
+	s.mutex.Lock()
+	u, found := s.users[name]
+	s.mutex.Unlock()
+	if !found {
+		_ = util.ComparePasswords([]byte(password), dummyHash())
+		return Principal{}, false
+	}
+	if err := util.ComparePasswords([]byte(password), u.hash); err != nil {
+		return Principal{}, false
+	}
+
+	s.mutex.Lock()
+	// The file may have been reloaded in the meantime
+	if current, ok := s.users[name]; ok && bytes.Equal(current.hash, u.hash) {
+		s.verified[name] = verifiedLogin{mac: s.mac(name, password), expiresAt: time.Now().Add(verifiedLoginTtl)}
+	}
+	s.mutex.Unlock()
+	return NewPrincipal(name, u.roles), true
+}
+
+// AuthenticateCached works like [UserStore.Authenticate], but only accepts passwords verified recently. It never runs
+// bcrypt, so it can be checked before other, more expensive ways to authenticate.
+func (s *UserStore) AuthenticateCached(name string, password string) (Principal, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.reloadIfChanged()
+
+	u, found := s.users[name]
+	cached, isCached := s.verified[name]
+	if !found || !isCached || time.Now().After(cached.expiresAt) || !hmac.Equal(cached.mac, s.mac(name, password)) {
+		return Principal{}, false
+	}
+	return NewPrincipal(name, u.roles), true
+}
+
+func (s *UserStore) mac(name string, password string) []byte {
+	mac := hmac.New(sha256.New, s.cacheKey)
+	mac.Write([]byte(name))
+	mac.Write([]byte{0})
+	mac.Write([]byte(password))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestUserStore(t *testing.T) {
+	hash := func(password string) string {
+		hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(hashed)
+	}
+	path := filepath.Join(t.TempDir(), "users")
+	content := "# comment\n\nalice:" + hash("a") + ":admin\nbob:" + hash("b") + ":editor, viewer\ncarol:" + hash("c") + "\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewUserStore(path)
+	if err := store.Load(); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]Role{"alice": RoleAdmin, "bob": RoleEditor, "carol": RoleViewer}
+	for name, role := range expected {
+		principal, ok := store.Authenticate(name, name[:1])
+		if !ok || principal.Name != name || !principal.Grants(role) {
+			t.Errorf("expected %s to be granted %s, got %+v", name, role, principal)
+		}
+		// The second login is served from the cache
+		if _, ok = store.AuthenticateCached(name, name[:1]); !ok {
+			t.Errorf("expected cached login of %s to succeed", name)
+		}
+		if _, ok = store.AuthenticateCached(name, name[:1]+"x"); ok {
+			t.Errorf("expected cached login of %s with another password to fail", name)
+		}
+	}
+	if principal, _ := store.Authenticate("bob", "b"); principal.Grants(RoleAdmin) {
+		t.Error("expected editor not to be granted the admin role")
+	}
+	for _, credentials := range [][2]string{{"alice", "b"}, {"alice", ""}, {"dave", "d"}} {
+		if _, ok := store.Authenticate(credentials[0], credentials[1]); ok {
+			t.Errorf("expected %v to be rejected", credentials)
+		}
+	}
+
+	// Changes to the file are picked up, invalid files are ignored
+	store.checkedAt = time.Time{}
+	future := time.Now().Add(time.Minute)
+	if err := os.WriteFile(path, []byte("alice:"+hash("new")+":viewer\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_ = os.Chtimes(path, future, future)
+	if _, ok := store.Authenticate("alice", "a"); ok {
+		t.Error("expected old password to be rejected after reload")
+	}
+	if principal, ok := store.Authenticate("alice", "new"); !ok || principal.Grants(RoleEditor) {
+		t.Errorf("expected alice to be a viewer after reload, got %+v", principal)
+	}
+
+	store.checkedAt = time.Time{}
+	if err := os.WriteFile(path, []byte("alice:plain\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_ = os.Chtimes(path, future.Add(time.Minute), future.Add(time.Minute))
+	if _, ok := store.Authenticate("alice", "new"); !ok {
+		t.Error("expected previous users to be kept if the file is invalid")
+	}
+}
+
+func TestParseUsers(t *testing.T) {
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("x"), bcrypt.MinCost)
+	invalid := []string{
+		"alice",
+		"alice:plain",
+		":" + string(hashed),
+		"alice:" + string(hashed) + ":owner",
+		"alice:" + string(hashed) + "\nalice:" + string(hashed),
+	}
+	for _, content := range invalid {
+		if _, err := parseUsers(strings.NewReader(content)); err == nil {
+			t.Errorf("expected %q to be rejected", content)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package bot
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+type (
+	// Category groups the kinds of automated clients.
+	Category string
+
+	// Result is the outcome of classifying a request.
+	Result struct {
+		Category Category `json:"category,omitempty"`
+		// Name is the name of the matched pattern or heuristic
+		Name string `json:"name,omitempty"`
+	}
+
+	pattern struct {
+		name     string
+		category Category
+		// match is a lowercase substring of the user agent
+		match string
+		// word requires the match not to be part of a longer word, unless it ends a product token like "examplebot/1.0"
+		word bool
+	}
+
+	contextKey struct{}
+)
+
+const (
+	// CategoryHuman means no indication of an automated client has been found
+	CategoryHuman Category = ""
+	// CategoryUnfurler are link preview fetchers of chat apps and social networks
+	CategoryUnfurler Category = "unfurler"
+	// CategoryCrawler are search engine and AI crawlers
+	CategoryCrawler Category = "crawler"
+	// CategoryScanner are security scanners
+	CategoryScanner Category = "scanner"
+	// CategoryMonitor are uptime monitors
+	CategoryMonitor Category = "monitor"
+	// CategoryTool are HTTP libraries and command line tools
+	CategoryTool Category = "tool"
+	// CategoryHeuristic are requests classified by their shape rather than their user agent
+	CategoryHeuristic Category = "heuristic"
+	// CategoryCustom are user agents matched by custom patterns
+	CategoryCustom Category = "custom"
+)
+
+// patterns are checked in order, so specific names come before generic markers
+var patterns = []pattern{
+	{"slack", CategoryUnfurler, "slackbot", false},
+	{"slack", CategoryUnfurler, "slack-imgproxy", false},
+	{"teams", CategoryUnfurler, "skypeuripreview", false},
+	{"teams", CategoryUnfurler, "msteams", false},
+	{"discord", CategoryUnfurler, "discordbot", false},
+	{"telegram", CategoryUnfurler, "telegrambot", false},
+	{"whatsapp", CategoryUnfurler, "whatsapp", false},
+	{"twitter", CategoryUnfurler, "twitterbot", false},
+	{"facebook", CategoryUnfurler, "facebookexternalhit", false},
+	{"facebook", CategoryUnfurler, "facebookcatalog", false},
+	{"linkedin", CategoryUnfurler, "linkedinbot", false},
+	{"mastodon", CategoryUnfurler, "mastodon/", false},
+	{"bluesky", CategoryUnfurler, "cardyb", false},
+	{"reddit", CategoryUnfurler, "redditbot", false},
+	{"pinterest", CategoryUnfurler, "pinterest", false},
+	{"embedly", CategoryUnfurler, "embedly", false},
+	{"iframely", CategoryUnfurler, "iframely", false},
+	{"google", CategoryCrawler, "googlebot", false},
+	{"google", CategoryCrawler, "google-inspectiontool", false},
+	{"bing", CategoryCrawler, "bingbot", false},
+	{"bing", CategoryCrawler, "bingpreview", false},
+	{"duckduckgo", CategoryCrawler, "duckduckbot", false},
+	{"yandex", CategoryCrawler, "yandex", false},
+	{"baidu", CategoryCrawler, "baiduspider", false},
+	{"apple", CategoryCrawler, "applebot", false},
+	{"ahrefs", CategoryCrawler, "ahrefsbot", false},
+	{"semrush", CategoryCrawler, "semrushbot", false},
+	{"majestic", CategoryCrawler, "mj12bot", false},
+	{"petal", CategoryCrawler, "petalbot", false},
+	{"openai", CategoryCrawler, "gptbot", false},
+	{"commoncrawl", CategoryCrawler, "ccbot", false},
+	{"nmap", CategoryScanner, "nmap", false},
+	{"masscan", CategoryScanner, "masscan", false},
+	{"zgrab", CategoryScanner, "zgrab", false},
+	{"nikto", CategoryScanner, "nikto", false},
+	{"sqlmap", CategoryScanner, "sqlmap", false},
+	{"nuclei", CategoryScanner, "nuclei", false},
+	{"censys", CategoryScanner, "censys", false},
+	{"shodan", CategoryScanner, "shodan", false},
+	{"wpscan", CategoryScanner, "wpscan", false},
+	{"uptimerobot", CategoryMonitor, "uptimerobot", false},
+	{"pingdom", CategoryMonitor, "pingdom", false},
+	{"statuscake", CategoryMonitor, "statuscake", false},
+	{"site24x7", CategoryMonitor, "site24x7", false},
+	{"headless", CategoryTool, "headlesschrome", false},
+	{"phantomjs", CategoryTool, "phantomjs", false},
+	{"curl", CategoryTool, "curl/", false},
+	{"wget", CategoryTool, "wget/", false},
+	{"httpie", CategoryTool, "httpie/", false},
+	{"python", CategoryTool, "python-requests", false},
+	{"python", CategoryTool, "python-urllib", false},
+	{"python", CategoryTool, "aiohttp", false},
+	{"scrapy", CategoryTool, "scrapy", false},
+	{"go", CategoryTool, "go-http-client", false},
+	{"java", CategoryTool, "java/", false},
+	{"okhttp", CategoryTool, "okhttp", false},
+	{"node", CategoryTool, "node-fetch", false},
+	{"node", CategoryTool, "axios/", false},
+	{"perl", CategoryTool, "libwww-perl", false},
+	{"generic", CategoryCrawler, "bot", true},
+	{"generic", CategoryCrawler, "crawler", false},
+	{"generic", CategoryCrawler, "spider", false},
+	{"generic", CategoryUnfurler, "preview", false},
+	{"generic", CategoryScanner, "scanner", false},
+}
+
+// IsBot returns whether the request has been classified as automated.
+func (r Result) IsBot() bool {
+	return r.Category != CategoryHuman
+}
+
+// Classifier classifies requests by their user agent and a few request heuristics.
+type Classifier struct {
+	custom []string
+}
+
+// NewClassifier creates a classifier. customPatterns are lowercase substrings of user agents that are
+// classified as [CategoryCustom], checked before the built-in patterns.
+func NewClassifier(customPatterns []string) *Classifier {
+	return &Classifier{custom: customPatterns}
+}
+
+// Classify classifies the request.
+func (c *Classifier) Classify(r *http.Request) Result {
+	userAgent := strings.ToLower(r.UserAgent())
+	if result := c.ClassifyUserAgent(userAgent); result.IsBot() {
+		return result
+	}
+
+	switch {
+	case len(strings.TrimSpace(userAgent)) == 0:
+		return Result{Category: CategoryHeuristic, Name: "empty-user-agent"}
+	case isPrefetch(r):
+		return Result{Category: CategoryHeuristic, Name: "prefetch"}
+	}
+	return Result{}
+}
+
+// ClassifyUserAgent classifies a user agent string only.
+func (c *Classifier) ClassifyUserAgent(userAgent string) Result {
+	userAgent = strings.ToLower(userAgent)
+	if len(userAgent) == 0 {
+		return Result{}
+	}
+	for _, custom := range c.custom {
+		if strings.Contains(userAgent, custom) {
+			return Result{Category: CategoryCustom, Name: custom}
+		}
+	}
+	for _, p := range patterns {
+		if p.matches(userAgent) {
+			return Result{Category: p.category, Name: p.name}
+		}
+	}
+	return Result{}
+}
+
+func (p pattern) matches(userAgent string) bool {
+	if !p.word {
+		return strings.Contains(userAgent, p.match)
+	}
+	for offset := 0; ; {
+		index := strings.Index(userAgent[offset:], p.match)
+		if index < 0 {
+			return false
+		}
+		start := offset + index
+		end := start + len(p.match)
+		if end < len(userAgent) && userAgent[end] == '/' {
+			return true
+		}
+		if !isLetterAt(userAgent, start-1) && !isLetterAt(userAgent, end) {
+			return true
+		}
+		offset = start + 1
+	}
+}
+
+func isLetterAt(s string, index int) bool {
+	return index >= 0 && index < len(s) && s[index] >= 'a' && s[index] <= 'z'
+}
+
+func isPrefetch(r *http.Request) bool {
+	purpose := strings.ToLower(r.Header.Get("Sec-Purpose") + r.Header.Get("Purpose") + r.Header.Get("X-Moz"))
+	return strings.Contains(purpose, "prefetch") || strings.Contains(purpose, "preview")
+}
+
+// NewContext returns a copy of ctx carrying the classification result.
+func NewContext(ctx context.Context, result Result) context.Context {
+	return context.WithValue(ctx, contextKey{}, result)
+}
+
+// FromContext returns the classification result carried by ctx.
+func FromContext(ctx context.Context) (Result, bool) {
+	result, ok := ctx.Value(contextKey{}).(Result)
+	return result, ok
+}
@@ -0,0 +1,45 @@
+package bot
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	classifier := NewClassifier([]string{"acme-linkchecker"})
+	firefox := "Mozilla/5.0 (X11; Linux x86_64; rv:120.0) Gecko/20100101 Firefox/120.0"
+
+	tests := []struct {
+		name      string
+		method    string
+		userAgent string
+		headers   map[string]string
+		expected  Category
+	}{
+		{"browser", http.MethodGet, firefox, nil, CategoryHuman},
+		{"slack", http.MethodGet, "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)", nil, CategoryUnfurler},
+		{"teams", http.MethodGet, "Mozilla/5.0 (Windows NT 6.1; WOW64) SkypeUriPreview Preview/0.5", nil, CategoryUnfurler},
+		{"google", http.MethodGet, "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", nil, CategoryCrawler},
+		{"scanner", http.MethodGet, "Mozilla/5.0 zgrab/0.x", nil, CategoryScanner},
+		{"generic bot", http.MethodGet, "Mozilla/5.0 (compatible; ExampleBot/1.0; +https://example.com/bot)", nil, CategoryCrawler},
+		{"generic bot word", http.MethodGet, "Mozilla/5.0 (compatible; Yeti-Bot)", nil, CategoryCrawler},
+		{"cubot phone", http.MethodGet, "Mozilla/5.0 (Linux; Android 10; CUBOT X30) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36", nil, CategoryHuman},
+		{"curl", http.MethodGet, "curl/8.4.0", nil, CategoryTool},
+		{"custom", http.MethodGet, "ACME-LinkChecker/2.0", nil, CategoryCustom},
+		{"empty", http.MethodGet, "", nil, CategoryHeuristic},
+		{"head", http.MethodHead, firefox, nil, CategoryHuman},
+		{"prefetch", http.MethodGet, firefox, map[string]string{"Sec-Purpose": "prefetch"}, CategoryHeuristic},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(test.method, "/docs", nil)
+		r.Header.Set("User-Agent", test.userAgent)
+		for name, value := range test.headers {
+			r.Header.Set(name, value)
+		}
+		if result := classifier.Classify(r); result.Category != test.expected {
+			t.Errorf("%s: expected category %q, got %q (%s)", test.name, test.expected, result.Category, result.Name)
+		}
+	}
+}
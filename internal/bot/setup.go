@@ -0,0 +1,49 @@
+package bot
+
+import (
+	"net/http"
+
+	"github.com/fanonwue/go-short-link/internal/conf"
+	"github.com/fanonwue/go-short-link/internal/metrics"
+)
+
+var (
+	defaultClassifier = NewClassifier(nil)
+	botClicks         = metrics.NewCounterVec("gsl_bot_clicks_total",
+		"Number of redirects requested by automated clients, by category.", "category")
+)
+
+func Setup() {
+	defaultClassifier = NewClassifier(conf.Config().BotPatterns)
+}
+
+// Middleware classifies every request and attaches the result to the request context.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result := defaultClassifier.Classify(r)
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), result)))
+	})
+}
+
+// FromRequest returns the classification result of the request, classifying it if necessary.
+func FromRequest(r *http.Request) Result {
+	if result, ok := FromContext(r.Context()); ok {
+		return result
+	}
+	return defaultClassifier.Classify(r)
+}
+
+// ClassifyUserAgent classifies a user agent string using the configured patterns.
+func ClassifyUserAgent(userAgent string) Result {
+	return defaultClassifier.ClassifyUserAgent(userAgent)
+}
+
+// CountClick counts a redirect requested by an automated client in the metrics.
+func CountClick(result Result) {
+	botClicks.Inc(string(result.Category))
+}
+
+// Excluded returns whether clicks with the given classification are excluded from the statistics.
+func Excluded(result Result) bool {
+	return result.IsBot() && !conf.Config().CountBots
+}
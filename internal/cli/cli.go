@@ -0,0 +1,182 @@
+// Package cli implements the subcommands of the application. They work on files only and do not start the server.
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/fanonwue/go-short-link/internal/repo"
+	"github.com/fanonwue/go-short-link/internal/transfer"
+)
+
+type command struct {
+	name        string
+	description string
+	run         func(args []string) error
+}
+
+// errUsage signals that the usage has already been printed
+var errUsage = errors.New("invalid usage")
+
+func commands() []command {
+	return []command{
+		{name: "convert", description: "Converts the export of another link shortener into an importable mapping", run: runConvert},
+		{name: "export", description: "Generates a static server configuration from an export or fallback file", run: runExport},
+	}
+}
+
+// Run runs the subcommand named by the first argument and returns the exit code.
+func Run(args []string) int {
+	for _, cmd := range commands() {
+		if cmd.name != args[0] {
+			continue
+		}
+		err := cmd.run(args[1:])
+		switch {
+		case err == nil:
+			return 0
+		case errors.Is(err, errUsage):
+			return 2
+		}
+		_, _ = fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	_, _ = fmt.Fprintf(os.Stderr, "Unknown command '%s'. Run without arguments to start the server. Available commands:\n", args[0])
+	for _, cmd := range commands() {
+		_, _ = fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.description)
+	}
+	return 2
+}
+
+func runConvert(args []string) error {
+	flags := flag.NewFlagSet("convert", flag.ContinueOnError)
+	from := flags.String("from", string(transfer.FormatJson), fmt.Sprintf("format of the input, one of %v", transfer.ImportFormats))
+	to := flags.String("to", string(transfer.FormatJson), fmt.Sprintf("format of the output, one of %v", transfer.Formats))
+	output := flags.String("o", "", "output file (default stdout)")
+	flags.Usage = func() {
+		_, _ = fmt.Fprintf(flags.Output(), "Usage: go-short-link convert [flags] [input file]\n\n"+
+			"Converts an export into a mapping that can be sent to the import endpoint. Reads from stdin if no input\n"+
+			"file is given. Features that cannot be imported are reported on stderr.\n\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+
+	fromFormat, err := transfer.ParseImportFormat(*from)
+	if err != nil {
+		return err
+	}
+	toFormat, err := transfer.ParseFormat(*to)
+	if err != nil {
+		return err
+	}
+
+	input, err := openInput(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	entries, notes, err := transfer.DecodeReport(input, fromFormat)
+	if err != nil {
+		return fmt.Errorf("could not read %s input: %w", fromFormat, err)
+	}
+	for _, note := range notes {
+		_, _ = fmt.Fprintln(os.Stderr, note)
+	}
+	_, _ = fmt.Fprintf(os.Stderr, "Converted %d entries, %d notes\n", len(entries), len(notes))
+
+	doc := transfer.Document{ExportedAt: time.Now().UTC(), Source: string(fromFormat), Entries: entries}
+	return writeOutput(*output, func(w io.Writer) error {
+		return transfer.Encode(w, toFormat, doc)
+	})
+}
+
+func runExport(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	from := flags.String("from", string(transfer.FormatJson), fmt.Sprintf("format of the input, one of %v", transfer.Formats))
+	to := flags.String("to", "", fmt.Sprintf("format of the output, one of %v (required)", transfer.StaticFormats))
+	output := flags.String("o", "", "output file (default stdout)")
+	ignoreCase := flags.Bool("ignore-case", true, "match paths case-insensitively, like APP_IGNORE_CASE_IN_PATH")
+	rootRedirect := flags.Bool("root-redirect", true, "redirect the root path using the "+repo.RootKey+" entry, like APP_ALLOW_ROOT_REDIRECT")
+	flags.Usage = func() {
+		_, _ = fmt.Fprintf(flags.Output(), "Usage: go-short-link export -to <format> [flags] [input file]\n\n"+
+			"Generates a static server configuration that redirects like the server does, e.g. to keep redirecting when\n"+
+			"the server is down. The input is an export or a fallback file, read from stdin if no input file is given.\n"+
+			"Entries that cannot be expressed in the configuration are reported on stderr.\n\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	if len(*to) == 0 {
+		flags.Usage()
+		return errUsage
+	}
+
+	fromFormat, err := transfer.ParseFormat(*from)
+	if err != nil {
+		return err
+	}
+	toFormat, err := transfer.ParseStaticFormat(*to)
+	if err != nil {
+		return err
+	}
+
+	input, err := openInput(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	entries, err := transfer.Decode(input, fromFormat)
+	if err != nil {
+		return fmt.Errorf("could not read %s input: %w", fromFormat, err)
+	}
+
+	opts := transfer.StaticOptions{IgnoreCase: *ignoreCase}
+	if *rootRedirect {
+		opts.RootKey = repo.RootKey
+	}
+	doc := transfer.Document{ExportedAt: time.Now().UTC(), Source: flags.Arg(0), Entries: entries}
+	var skipped []transfer.SkippedEntry
+	err = writeOutput(*output, func(w io.Writer) error {
+		skipped, err = transfer.EncodeStatic(w, toFormat, doc, opts)
+		return err
+	})
+	for _, entry := range skipped {
+		_, _ = fmt.Fprintf(os.Stderr, "Skipped %s: %s\n", entry.Key, entry.Reason)
+	}
+	_, _ = fmt.Fprintf(os.Stderr, "Exported %d entries, %d skipped\n", len(entries)-len(skipped), len(skipped))
+	return err
+}
+
+// openInput opens the input file, or stdin if path is empty or "-".
+func openInput(path string) (io.ReadCloser, error) {
+	if len(path) == 0 || path == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	return os.Open(path)
+}
+
+// writeOutput calls write with the output file, or stdout if path is empty.
+func writeOutput(path string, write func(w io.Writer) error) error {
+	if len(path) == 0 {
+		return write(os.Stdout)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err = write(file); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
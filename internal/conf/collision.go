@@ -0,0 +1,36 @@
+package conf
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// CollisionStrategy determines which row is kept when multiple rows end up using the same key.
+type CollisionStrategy uint8
+
+const (
+	// CollisionKeepFirst keeps the row with the lowest row number
+	CollisionKeepFirst CollisionStrategy = iota
+	// CollisionKeepLast keeps the row with the highest row number
+	CollisionKeepLast
+)
+
+var ErrUnknownCollisionStrategy = errors.New("unknown collision strategy")
+
+func ParseCollisionStrategy(s string) (CollisionStrategy, error) {
+	switch strings.ToLower(s) {
+	case "first":
+		return CollisionKeepFirst, nil
+	case "last":
+		return CollisionKeepLast, nil
+	}
+	return CollisionKeepFirst, fmt.Errorf("%w: %s", ErrUnknownCollisionStrategy, s)
+}
+
+func (cs CollisionStrategy) String() string {
+	if cs == CollisionKeepLast {
+		return "last"
+	}
+	return "first"
+}
@@ -1,6 +1,7 @@
 package conf
 
 import (
+	"encoding/json"
 	"fmt"
 
 	"github.com/fanonwue/go-short-link/internal/util"
@@ -31,15 +32,110 @@ type (
 		CacheControlHeader       string
 		AssetsCacheControlHeader string
 		FallbackFile             string
-		Favicons                 map[FaviconType]string
-		UseAssets                bool
-		UseETag                  bool
-		UseRedirectBody          bool
-		AllowRootRedirect        bool
-		ShowRepositoryLink       bool
-		StatusEndpointEnabled    bool
-		ApiEnabled               bool
-		AdminCredentials         *AdminCredentials
+		// DataSource is the type of the data source (google-sheets or store)
+		DataSource string
+		// StoreFile is the path of the journal file used by the local store
+		StoreFile             string
+		Favicons              map[FaviconType]string
+		UseAssets             bool
+		UseETag               bool
+		UseRedirectBody       bool
+		AllowRootRedirect     bool
+		ShowRepositoryLink    bool
+		StatusEndpointEnabled bool
+		ApiEnabled            bool
+		AdminCredentials      *AdminCredentials
+		// UsersFile is the path of an htpasswd-style file of users with roles (empty = only the admin credentials)
+		UsersFile string
+		// TokenFile is the path of the file API tokens are stored in (empty = tokens disabled)
+		TokenFile string
+		// TokenSecret is the key used to hash API tokens
+		TokenSecret string
+		// OidcIssuer is the issuer of JWTs accepted by the API and of the OpenID Connect login (empty = disabled)
+		OidcIssuer       string
+		OidcClientId     string
+		OidcClientSecret string
+		// OidcRedirectUrl is the URL of the login callback of the admin UI (empty = login disabled)
+		OidcRedirectUrl string
+		OidcScopes      []string
+		// JwksSource is the file or URL the keys of the issuer are loaded from (empty = discovered)
+		JwksSource        string
+		JwksRefreshPeriod time.Duration
+		// JwtAudience is the audience of JWTs accepted by the API (empty = JWTs are not accepted)
+		JwtAudience string
+		// RolesClaim is the claim mapped to roles using RoleMapping
+		RolesClaim string
+		// RoleMapping is a comma-separated list of value=role entries. Unlike other lists, it is case-sensitive.
+		RoleMapping string
+		// SessionSecret is the key used to sign session cookies (empty = random key)
+		SessionSecret        string
+		SessionDuration      time.Duration
+		AllowedTargetSchemes []string
+		AllowedTargetHosts   []string
+		DeniedTargetHosts    []string
+		KeyCollisionStrategy CollisionStrategy
+		// UpdateGuardMaxRemoved is the maximum number of keys an update may remove before it is held back (0 = unlimited)
+		UpdateGuardMaxRemoved uint
+		// UpdateGuardMaxRemovedPercent is the maximum percentage of keys an update may remove before it is held back (0 = unlimited)
+		UpdateGuardMaxRemovedPercent uint
+		// HistorySize is the number of applied mappings to keep in the history (0 = disabled)
+		HistorySize uint
+		// PersistHistory specifies whether the history is persisted next to the fallback file
+		PersistHistory bool
+		StatsEnabled   bool
+		// StatsFile is the path of the file click statistics are persisted to (empty = not persisted)
+		StatsFile        string
+		StatsFlushPeriod time.Duration
+		// AnalyticsEnabled specifies whether hourly click buckets with referrer and user agent aggregates are recorded
+		AnalyticsEnabled bool
+		// AnalyticsFile is the path of the file click analytics are persisted to (empty = not persisted)
+		AnalyticsFile string
+		// AnalyticsRetention is the duration analytics buckets are kept for (0 = forever)
+		AnalyticsRetention time.Duration
+		// ShowClicksOnInfoPage specifies whether the click count is shown on the redirect info page
+		ShowClicksOnInfoPage bool
+		// EventsWebhookUrl is the URL click events are posted to (disabled if empty)
+		EventsWebhookUrl   string
+		EventsWebhookToken string
+		// EventsFile is the path of a file click events are appended to, if no webhook is configured
+		EventsFile        string
+		EventsBufferSize  uint
+		EventsBatchSize   uint
+		EventsFlushPeriod time.Duration
+		EventsMaxRetries  uint
+		// PrivacyIpMode determines how client IP addresses are anonymized (none, truncate or hash)
+		PrivacyIpMode       string
+		PrivacySaltRotation time.Duration
+		// PrivacyHonorDnt specifies whether clients sending DNT or Sec-GPC are excluded from tracking
+		PrivacyHonorDnt bool
+		// PrivacyRetention is the duration click data is kept for (0 = forever)
+		PrivacyRetention time.Duration
+		// CountBots specifies whether clicks of automated clients are included in the statistics
+		CountBots bool
+		// BotPatterns are additional user agent substrings that identify automated clients
+		BotPatterns []string
+		// LinkCheckEnabled specifies whether redirect targets are checked periodically for broken links
+		LinkCheckEnabled bool
+		LinkCheckPeriod  time.Duration
+		// LinkCheckDelay is the minimum delay between two requests of the link checker
+		LinkCheckDelay   time.Duration
+		LinkCheckTimeout time.Duration
+		// LinkCheckAllowPrivate allows the link checker to request loopback, link-local and private addresses
+		LinkCheckAllowPrivate bool
+		// TracingExporter is the exporter spans are sent to (none, otlp, otlp-grpc or stdout)
+		TracingExporter string
+		// MetricsEnabled specifies whether the Prometheus metrics endpoint is available, independent of ApiEnabled
+		MetricsEnabled bool
+		// MetricsAnonymous allows scraping the metrics endpoint without credentials
+		MetricsAnonymous bool
+		// AccessLogFormat is the format of the access log (json, common, combined or logfmt, disabled if empty)
+		AccessLogFormat string
+		// AccessLogFile is the path of the access log file (stdout if empty)
+		AccessLogFile string
+		// AccessLogMaxSize is the size in megabytes after which the access log file is rotated (0 = never)
+		AccessLogMaxSize      uint
+		AccessLogMaxBackups   uint
+		AccessLogRedactFields []string
 	}
 
 	FaviconEntry struct {
@@ -54,13 +150,31 @@ const (
 )
 
 const (
-	LogResponseTimes           = false
 	ServerIdentifierHeader     = "go-short-link"
 	CacheControlHeaderTemplate = "public, max-age=%d"
 	EtagLength                 = 8
 	DefaultBufferSize          = 4096
 	defaultUpdatePeriod        = 300
 	minimumUpdatePeriod        = 15
+	defaultHistorySize         = 10
+	defaultStatsFlushPeriod    = 60
+	defaultAccessLogMaxSize    = 100
+	defaultAnalyticsRetention  = 90
+	defaultEventsBufferSize    = 1000
+	defaultEventsBatchSize     = 100
+	defaultEventsFlushPeriod   = 5
+	defaultEventsMaxRetries    = 5
+	defaultSaltRotation        = 24
+	defaultAccessLogMaxBackups = 5
+	defaultLinkCheckPeriod     = 24
+	defaultLinkCheckDelay      = 1000
+	defaultLinkCheckTimeout    = 10
+	defaultStoreFile           = "data/links.journal"
+	defaultJwksRefreshPeriod   = 3600
+	defaultRolesClaim          = "groups"
+	defaultSessionDuration     = 8
+	// minProdPasswordLength is the minimum length of the admin password if the API is enabled in production
+	minProdPasswordLength = 16
 )
 
 var (
@@ -167,23 +281,80 @@ func CreateAppConfig() *AppConfig {
 	}
 
 	currentConfig = &AppConfig{
-		IgnoreCaseInPath:         boolConfig(util.PrefixedEnvVar("IGNORE_CASE_IN_PATH"), true),
-		ShowServerHeader:         boolConfig(util.PrefixedEnvVar("SHOW_SERVER_HEADER"), true),
-		Port:                     uint16(port),
-		UpdatePeriod:             time.Duration(updatePeriod) * time.Second,
-		HttpCacheMaxAge:          uint32(httpCacheMaxAge),
-		Favicons:                 make(map[FaviconType]string),
-		CacheControlHeader:       fmt.Sprintf(CacheControlHeaderTemplate, httpCacheMaxAge),
-		AssetsCacheControlHeader: fmt.Sprintf(CacheControlHeaderTemplate, 21600),
-		UseETag:                  boolConfig(util.PrefixedEnvVar("ENABLE_ETAG"), true),
-		UseRedirectBody:          boolConfig(util.PrefixedEnvVar("ENABLE_REDIRECT_BODY"), true),
-		UseAssets:                boolConfig(util.PrefixedEnvVar("ENABLE_ASSETS"), false), // Enables the serving of statis assets, see [tmpl.EmbedLocalFS]
-		AllowRootRedirect:        boolConfig(util.PrefixedEnvVar("ALLOW_ROOT_REDIRECT"), true),
-		ShowRepositoryLink:       boolConfig(util.PrefixedEnvVar("SHOW_REPOSITORY_LINK"), false),
-		StatusEndpointEnabled:    boolConfig(util.PrefixedEnvVar("ENABLE_STATUS"), true),
-		ApiEnabled:               boolConfig(util.PrefixedEnvVar("ENABLE_API"), false),
-		AdminCredentials:         createAdminCredentials(),
-		FallbackFile:             os.Getenv(util.PrefixedEnvVar("FALLBACK_FILE")),
+		IgnoreCaseInPath:             boolConfig(util.PrefixedEnvVar("IGNORE_CASE_IN_PATH"), true),
+		ShowServerHeader:             boolConfig(util.PrefixedEnvVar("SHOW_SERVER_HEADER"), true),
+		Port:                         uint16(port),
+		UpdatePeriod:                 time.Duration(updatePeriod) * time.Second,
+		HttpCacheMaxAge:              uint32(httpCacheMaxAge),
+		Favicons:                     make(map[FaviconType]string),
+		CacheControlHeader:           fmt.Sprintf(CacheControlHeaderTemplate, httpCacheMaxAge),
+		AssetsCacheControlHeader:     fmt.Sprintf(CacheControlHeaderTemplate, 21600),
+		UseETag:                      boolConfig(util.PrefixedEnvVar("ENABLE_ETAG"), true),
+		UseRedirectBody:              boolConfig(util.PrefixedEnvVar("ENABLE_REDIRECT_BODY"), true),
+		UseAssets:                    boolConfig(util.PrefixedEnvVar("ENABLE_ASSETS"), false), // Enables the serving of statis assets, see [tmpl.EmbedLocalFS]
+		AllowRootRedirect:            boolConfig(util.PrefixedEnvVar("ALLOW_ROOT_REDIRECT"), true),
+		ShowRepositoryLink:           boolConfig(util.PrefixedEnvVar("SHOW_REPOSITORY_LINK"), false),
+		StatusEndpointEnabled:        boolConfig(util.PrefixedEnvVar("ENABLE_STATUS"), true),
+		ApiEnabled:                   boolConfig(util.PrefixedEnvVar("ENABLE_API"), false),
+		AdminCredentials:             createAdminCredentials(),
+		TokenFile:                    os.Getenv(util.PrefixedEnvVar("TOKEN_FILE")),
+		TokenSecret:                  os.Getenv(util.PrefixedEnvVar("TOKEN_SECRET")),
+		UsersFile:                    os.Getenv(util.PrefixedEnvVar("USERS_FILE")),
+		OidcIssuer:                   os.Getenv(util.PrefixedEnvVar("OIDC_ISSUER")),
+		OidcClientId:                 os.Getenv(util.PrefixedEnvVar("OIDC_CLIENT_ID")),
+		OidcClientSecret:             os.Getenv(util.PrefixedEnvVar("OIDC_CLIENT_SECRET")),
+		OidcRedirectUrl:              os.Getenv(util.PrefixedEnvVar("OIDC_REDIRECT_URL")),
+		OidcScopes:                   listConfig(util.PrefixedEnvVar("OIDC_SCOPES"), []string{"openid", "profile", "email"}),
+		JwksSource:                   os.Getenv(util.PrefixedEnvVar("JWKS")),
+		JwksRefreshPeriod:            time.Duration(uintConfig(util.PrefixedEnvVar("JWKS_REFRESH_PERIOD"), defaultJwksRefreshPeriod)) * time.Second,
+		JwtAudience:                  os.Getenv(util.PrefixedEnvVar("JWT_AUDIENCE")),
+		RolesClaim:                   stringConfig(util.PrefixedEnvVar("ROLES_CLAIM"), defaultRolesClaim),
+		RoleMapping:                  os.Getenv(util.PrefixedEnvVar("ROLE_MAPPING")),
+		SessionSecret:                os.Getenv(util.PrefixedEnvVar("SESSION_SECRET")),
+		SessionDuration:              time.Duration(uintConfig(util.PrefixedEnvVar("SESSION_DURATION"), defaultSessionDuration)) * time.Hour,
+		FallbackFile:                 os.Getenv(util.PrefixedEnvVar("FALLBACK_FILE")),
+		DataSource:                   os.Getenv(util.PrefixedEnvVar("DATA_SOURCE")),
+		StoreFile:                    stringConfig(util.PrefixedEnvVar("STORE_FILE"), defaultStoreFile),
+		AllowedTargetSchemes:         listConfig(util.PrefixedEnvVar("ALLOWED_TARGET_SCHEMES"), []string{"http", "https"}),
+		AllowedTargetHosts:           listConfig(util.PrefixedEnvVar("ALLOWED_TARGET_HOSTS"), nil),
+		DeniedTargetHosts:            listConfig(util.PrefixedEnvVar("DENIED_TARGET_HOSTS"), nil),
+		UpdateGuardMaxRemoved:        uintConfig(util.PrefixedEnvVar("UPDATE_GUARD_MAX_REMOVED"), 0),
+		UpdateGuardMaxRemovedPercent: uintConfig(util.PrefixedEnvVar("UPDATE_GUARD_MAX_REMOVED_PERCENT"), 0),
+		HistorySize:                  uintConfig(util.PrefixedEnvVar("HISTORY_SIZE"), defaultHistorySize),
+		PersistHistory:               boolConfig(util.PrefixedEnvVar("PERSIST_HISTORY"), false),
+		StatsEnabled:                 boolConfig(util.PrefixedEnvVar("ENABLE_STATS"), false),
+		StatsFile:                    os.Getenv(util.PrefixedEnvVar("STATS_FILE")),
+		ShowClicksOnInfoPage:         boolConfig(util.PrefixedEnvVar("SHOW_CLICKS"), false),
+		StatsFlushPeriod:             time.Duration(uintConfig(util.PrefixedEnvVar("STATS_FLUSH_PERIOD"), defaultStatsFlushPeriod)) * time.Second,
+		AnalyticsEnabled:             boolConfig(util.PrefixedEnvVar("ENABLE_ANALYTICS"), false),
+		AnalyticsFile:                os.Getenv(util.PrefixedEnvVar("ANALYTICS_FILE")),
+		AnalyticsRetention:           time.Duration(uintConfig(util.PrefixedEnvVar("ANALYTICS_RETENTION"), defaultAnalyticsRetention)) * 24 * time.Hour,
+		EventsWebhookUrl:             os.Getenv(util.PrefixedEnvVar("EVENTS_WEBHOOK_URL")),
+		EventsWebhookToken:           os.Getenv(util.PrefixedEnvVar("EVENTS_WEBHOOK_TOKEN")),
+		EventsFile:                   os.Getenv(util.PrefixedEnvVar("EVENTS_FILE")),
+		EventsBufferSize:             uintConfig(util.PrefixedEnvVar("EVENTS_BUFFER_SIZE"), defaultEventsBufferSize),
+		EventsBatchSize:              uintConfig(util.PrefixedEnvVar("EVENTS_BATCH_SIZE"), defaultEventsBatchSize),
+		EventsFlushPeriod:            time.Duration(uintConfig(util.PrefixedEnvVar("EVENTS_FLUSH_PERIOD"), defaultEventsFlushPeriod)) * time.Second,
+		EventsMaxRetries:             uintConfig(util.PrefixedEnvVar("EVENTS_MAX_RETRIES"), defaultEventsMaxRetries),
+		PrivacyIpMode:                os.Getenv(util.PrefixedEnvVar("PRIVACY_IP_MODE")),
+		PrivacySaltRotation:          time.Duration(uintConfig(util.PrefixedEnvVar("PRIVACY_SALT_ROTATION"), defaultSaltRotation)) * time.Hour,
+		PrivacyHonorDnt:              boolConfig(util.PrefixedEnvVar("PRIVACY_HONOR_DNT"), true),
+		PrivacyRetention:             time.Duration(uintConfig(util.PrefixedEnvVar("PRIVACY_RETENTION"), 0)) * 24 * time.Hour,
+		CountBots:                    boolConfig(util.PrefixedEnvVar("COUNT_BOTS"), false),
+		BotPatterns:                  listConfig(util.PrefixedEnvVar("BOT_PATTERNS"), nil),
+		LinkCheckEnabled:             boolConfig(util.PrefixedEnvVar("ENABLE_LINK_CHECK"), false),
+		LinkCheckPeriod:              time.Duration(uintConfig(util.PrefixedEnvVar("LINK_CHECK_PERIOD"), defaultLinkCheckPeriod)) * time.Hour,
+		LinkCheckDelay:               time.Duration(uintConfig(util.PrefixedEnvVar("LINK_CHECK_DELAY"), defaultLinkCheckDelay)) * time.Millisecond,
+		LinkCheckTimeout:             time.Duration(uintConfig(util.PrefixedEnvVar("LINK_CHECK_TIMEOUT"), defaultLinkCheckTimeout)) * time.Second,
+		LinkCheckAllowPrivate:        boolConfig(util.PrefixedEnvVar("LINK_CHECK_ALLOW_PRIVATE"), false),
+		TracingExporter:              os.Getenv(util.PrefixedEnvVar("TRACING_EXPORTER")),
+		MetricsEnabled:               boolConfig(util.PrefixedEnvVar("ENABLE_METRICS"), false),
+		MetricsAnonymous:             boolConfig(util.PrefixedEnvVar("METRICS_ANONYMOUS"), false),
+		AccessLogFormat:              os.Getenv(util.PrefixedEnvVar("ACCESS_LOG")),
+		AccessLogFile:                os.Getenv(util.PrefixedEnvVar("ACCESS_LOG_FILE")),
+		AccessLogMaxSize:             uintConfig(util.PrefixedEnvVar("ACCESS_LOG_MAX_SIZE"), defaultAccessLogMaxSize),
+		AccessLogMaxBackups:          uintConfig(util.PrefixedEnvVar("ACCESS_LOG_MAX_BACKUPS"), defaultAccessLogMaxBackups),
+		AccessLogRedactFields:        listConfig(util.PrefixedEnvVar("ACCESS_LOG_REDACT"), nil),
 	}
 
 	rawFavicons := os.Getenv(util.PrefixedEnvVar("FAVICON"))
@@ -200,12 +371,70 @@ func CreateAppConfig() *AppConfig {
 		currentConfig.Favicons[faviconType] = favicon
 	}
 
-	// Only allow API in dev environment for now
-	currentConfig.ApiEnabled = currentConfig.ApiEnabled && !isProd
+	rawCollisionStrategy := os.Getenv(util.PrefixedEnvVar("KEY_COLLISION_STRATEGY"))
+	if len(rawCollisionStrategy) > 0 {
+		collisionStrategy, err := ParseCollisionStrategy(rawCollisionStrategy)
+		if err != nil {
+			logging.Warnf("Invalid KEY_COLLISION_STRATEGY, falling back to '%s': %v", collisionStrategy, err)
+		}
+		currentConfig.KeyCollisionStrategy = collisionStrategy
+	}
+
+	if currentConfig.StatsFlushPeriod == 0 {
+		currentConfig.StatsFlushPeriod = defaultStatsFlushPeriod * time.Second
+	}
+
+	if err = validateApiAuth(currentConfig); err != nil {
+		logging.Panicf("Refusing to start: %v", err)
+	}
 
 	return currentConfig
 }
 
+// validateApiAuth makes sure the API is not enabled without a way to authenticate. In production, the admin password
+// has to be strong, API tokens have to be hashed with a secret and logins to the admin UI have to use HTTPS as well.
+func validateApiAuth(config *AppConfig) error {
+	if !config.ApiEnabled {
+		return nil
+	}
+	// JWTs are only accepted with an audience, and the admin UI login needs a client ID and a redirect URL
+	oidcUsable := len(config.OidcIssuer) > 0 &&
+		(len(config.JwtAudience) > 0 || (len(config.OidcClientId) > 0 && len(config.OidcRedirectUrl) > 0))
+	// Tokens can only be created by admins, so the token file alone only works if it already holds tokens
+	tokensUsable := len(config.TokenFile) > 0 && tokenFileHasTokens(config.TokenFile)
+	if config.AdminCredentials == nil && len(config.UsersFile) == 0 && !oidcUsable && !tokensUsable {
+		return fmt.Errorf("the API is enabled, but neither %s and %s, %s, %s holding at least one token nor %s "+
+			"together with %s or %s and %s are set",
+			util.PrefixedEnvVar("ADMIN_USER"), util.PrefixedEnvVar("ADMIN_PASS"), util.PrefixedEnvVar("USERS_FILE"),
+			util.PrefixedEnvVar("TOKEN_FILE"), util.PrefixedEnvVar("OIDC_ISSUER"), util.PrefixedEnvVar("JWT_AUDIENCE"),
+			util.PrefixedEnvVar("OIDC_CLIENT_ID"), util.PrefixedEnvVar("OIDC_REDIRECT_URL"))
+	}
+	if !isProd {
+		return nil
+	}
+	if config.AdminCredentials != nil && len(os.Getenv(util.PrefixedEnvVar("ADMIN_PASS"))) < minProdPasswordLength {
+		return fmt.Errorf("%s must be at least %d characters long when the API is enabled in production",
+			util.PrefixedEnvVar("ADMIN_PASS"), minProdPasswordLength)
+	}
+	if len(config.TokenFile) > 0 && len(config.TokenSecret) == 0 {
+		return fmt.Errorf("%s must be set when API tokens are enabled in production", util.PrefixedEnvVar("TOKEN_SECRET"))
+	}
+	if len(config.OidcRedirectUrl) > 0 && !strings.HasPrefix(config.OidcRedirectUrl, "https://") {
+		return fmt.Errorf("%s must use HTTPS when the API is enabled in production", util.PrefixedEnvVar("OIDC_REDIRECT_URL"))
+	}
+	return nil
+}
+
+// tokenFileHasTokens returns whether the token file exists and contains at least one token.
+func tokenFileHasTokens(path string) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	var entries []json.RawMessage
+	return json.Unmarshal(data, &entries) == nil && len(entries) > 0
+}
+
 func boolConfig(key string, defaultValue bool) bool {
 	value, err := strconv.ParseBool(os.Getenv(key))
 	if err != nil {
@@ -214,6 +443,41 @@ func boolConfig(key string, defaultValue bool) bool {
 	return value
 }
 
+func stringConfig(key string, defaultValue string) string {
+	value := os.Getenv(key)
+	if len(value) == 0 {
+		return defaultValue
+	}
+	return value
+}
+
+func uintConfig(key string, defaultValue uint) uint {
+	value, err := strconv.ParseUint(os.Getenv(key), 0, 32)
+	if err != nil {
+		return defaultValue
+	}
+	return uint(value)
+}
+
+// listConfig parses a comma separated list of values. Entries are trimmed and converted to lowercase,
+// empty entries are ignored. If the variable is not set, defaultValue is returned.
+func listConfig(key string, defaultValue []string) []string {
+	raw, found := os.LookupEnv(key)
+	if !found {
+		return defaultValue
+	}
+
+	var values []string
+	for _, value := range strings.Split(raw, ",") {
+		value = strings.ToLower(strings.TrimSpace(value))
+		if value == "" {
+			continue
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
 func createAdminCredentials() *AdminCredentials {
 	user := os.Getenv(util.PrefixedEnvVar("ADMIN_USER"))
 	pass := os.Getenv(util.PrefixedEnvVar("ADMIN_PASS"))
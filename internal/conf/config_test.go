@@ -0,0 +1,54 @@
+package conf
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fanonwue/go-short-link/internal/util"
+)
+
+func TestValidateApiAuth(t *testing.T) {
+	previous := isProd
+	t.Cleanup(func() { isProd = previous })
+	t.Setenv(util.PrefixedEnvVar("ADMIN_PASS"), "short")
+	emptyTokens, tokens := filepath.Join(t.TempDir(), "empty.json"), filepath.Join(t.TempDir(), "tokens.json")
+	if err := os.WriteFile(emptyTokens, []byte("[]"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(tokens, []byte(`[{"id":"ci","name":"CI","hash":"abc"}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	issuer := "https://id.example.com"
+
+	tests := []struct {
+		name   string
+		prod   bool
+		config AppConfig
+		valid  bool
+	}{
+		{"API disabled", false, AppConfig{}, true},
+		{"no authentication", false, AppConfig{ApiEnabled: true}, false},
+		{"no authentication in production", true, AppConfig{ApiEnabled: true}, false},
+		{"admin credentials", false, AppConfig{ApiEnabled: true, AdminCredentials: &AdminCredentials{}}, true},
+		{"short admin password in production", true, AppConfig{ApiEnabled: true, AdminCredentials: &AdminCredentials{}}, false},
+		{"users file", true, AppConfig{ApiEnabled: true, UsersFile: "users"}, true},
+		{"token file", false, AppConfig{ApiEnabled: true, TokenFile: tokens}, true},
+		{"missing token file", false, AppConfig{ApiEnabled: true, TokenFile: "missing.json"}, false},
+		{"empty token file", false, AppConfig{ApiEnabled: true, TokenFile: emptyTokens}, false},
+		{"empty token file with users file", false, AppConfig{ApiEnabled: true, TokenFile: emptyTokens, UsersFile: "users"}, true},
+		{"token file without secret in production", true, AppConfig{ApiEnabled: true, TokenFile: tokens}, false},
+		{"token file with secret in production", true, AppConfig{ApiEnabled: true, TokenFile: tokens, TokenSecret: "secret"}, true},
+		{"identity provider only", false, AppConfig{ApiEnabled: true, OidcIssuer: issuer}, false},
+		{"identity provider with audience", false, AppConfig{ApiEnabled: true, OidcIssuer: issuer, JwtAudience: "short-link-api"}, true},
+		{"identity provider with client ID only", false, AppConfig{ApiEnabled: true, OidcIssuer: issuer, OidcClientId: "short-link"}, false},
+		{"identity provider with login", false, AppConfig{ApiEnabled: true, OidcIssuer: issuer, OidcClientId: "short-link", OidcRedirectUrl: "https://example.com/_admin/callback"}, true},
+		{"insecure login in production", true, AppConfig{ApiEnabled: true, OidcIssuer: issuer, OidcClientId: "short-link", OidcRedirectUrl: "http://example.com/_admin/callback"}, false},
+	}
+	for _, test := range tests {
+		isProd = test.prod
+		if err := validateApiAuth(&test.config); (err == nil) != test.valid {
+			t.Errorf("%s: expected valid %v, got %v", test.name, test.valid, err)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package ds
 
 import (
+	"context"
 	"encoding/csv"
 	"io"
 	"io/fs"
@@ -35,7 +36,7 @@ func (ds *CsvDataSource) LastModified() time.Time {
 	return fileInfo.ModTime().UTC()
 }
 
-func (ds *CsvDataSource) NeedsUpdate() bool {
+func (ds *CsvDataSource) NeedsUpdate(_ context.Context) bool {
 	// If checkModificationTime has been disabled, always signal that an update is needed
 	if !ds.checkModificationTime {
 		return true
@@ -51,9 +52,13 @@ func (ds *CsvDataSource) NeedsUpdate() bool {
 	return lastModifiedTime.After(ds.lastUpdate)
 }
 
-func (ds *CsvDataSource) FetchRedirectMapping() (state.RedirectMap, error) {
+func (ds *CsvDataSource) FetchRedirectMapping(ctx context.Context) (state.RedirectMap, error) {
+	return ds.FetchRedirectMappingReport(ctx, state.NewMappingReport(ds.Id()))
+}
+
+func (ds *CsvDataSource) FetchRedirectMappingReport(_ context.Context, report *state.MappingReport) (state.RedirectMap, error) {
 	return withFile(ds, func(f fs.File) (state.RedirectMap, error) {
-		return fetchRedirectMappingInternal(ds, f)
+		return fetchRedirectMappingInternal(ds, f, report)
 	})
 }
 
@@ -61,11 +66,13 @@ func (ds *CsvDataSource) Id() string {
 	return "CsvDataSource#" + ds.filePath
 }
 
-func fetchRedirectMappingInternal(ds *CsvDataSource, f fs.File) (state.RedirectMap, error) {
+func fetchRedirectMappingInternal(ds *CsvDataSource, f fs.File, report *state.MappingReport) (state.RedirectMap, error) {
 	redirectMap := state.RedirectMap{}
 	updateTime := time.Now().UTC()
 
 	reader := csv.NewReader(f)
+	// Records are allowed to omit the target, those will be reported instead of failing the whole update
+	reader.FieldsPerRecord = -1
 	for {
 		record, err := reader.Read()
 		if err == io.EOF {
@@ -74,8 +81,11 @@ func fetchRedirectMappingInternal(ds *CsvDataSource, f fs.File) (state.RedirectM
 		if err != nil {
 			return nil, err
 		}
+		row, _ := reader.FieldPos(0)
+
 		// Invalid record
 		if len(record) < 2 {
+			report.Skip(row, record[0], "missing target column")
 			continue
 		}
 
@@ -83,11 +93,16 @@ func fetchRedirectMappingInternal(ds *CsvDataSource, f fs.File) (state.RedirectM
 		target := record[1]
 
 		// Invalid record
-		if len(name) == 0 || len(target) == 0 {
+		if len(name) == 0 {
+			report.Skip(row, name, "missing key")
+			continue
+		}
+		if len(target) == 0 {
+			report.Skip(row, name, "missing target")
 			continue
 		}
 
-		redirectMap[name] = target
+		report.Assign(redirectMap, row, name, target)
 	}
 	ds.lastUpdate = updateTime
 	return redirectMap, nil
@@ -1,8 +1,11 @@
 package ds
 
 import (
-	"github.com/fanonwue/go-short-link/internal/state"
+	"context"
+	"errors"
 	"time"
+
+	"github.com/fanonwue/go-short-link/internal/state"
 )
 
 type RedirectDataSource interface {
@@ -11,9 +14,67 @@ type RedirectDataSource interface {
 	// LastModified returns the timestamp at which the data source has been modified
 	LastModified() time.Time
 	// NeedsUpdate returns true when the data source provider determined that an update of the redirect mapping is necessary
-	NeedsUpdate() bool
+	NeedsUpdate(ctx context.Context) bool
 	// FetchRedirectMapping returns the current redirect mapping from the provider
-	FetchRedirectMapping() (state.RedirectMap, error)
+	FetchRedirectMapping(ctx context.Context) (state.RedirectMap, error)
 	// Id returns a provider specific identifier
 	Id() string
 }
+
+// ReportingDataSource is an optional extension of RedirectDataSource. Data sources implementing it are able to
+// report which rows have been skipped or overwritten while fetching the redirect mapping.
+type ReportingDataSource interface {
+	RedirectDataSource
+	// FetchRedirectMappingReport returns the current redirect mapping from the provider, recording per-row
+	// diagnostics in the supplied report. Entries should be added using [state.MappingReport.Assign].
+	FetchRedirectMappingReport(ctx context.Context, report *state.MappingReport) (state.RedirectMap, error)
+}
+
+// WritableDataSource is an optional extension of RedirectDataSource. Data sources implementing it allow changing
+// single entries, e.g. using the links API. Keys are passed in their normalized form.
+type WritableDataSource interface {
+	RedirectDataSource
+	// Writable reports whether writing has been enabled for the data source
+	Writable() bool
+	// SetKeyNormalizer sets the function used to normalize keys read from the data source, so that entries can be
+	// located using their normalized key.
+	SetKeyNormalizer(normalizer func(string) string)
+	// CreateEntry adds a new entry. It returns an error wrapping [ErrEntryExists] if the key is in use already.
+	CreateEntry(ctx context.Context, key string, target string) error
+	// UpdateEntry changes the target of an existing entry. It returns an error wrapping [ErrEntryNotFound]
+	// if there is no entry for the key.
+	UpdateEntry(ctx context.Context, key string, target string) error
+	// DeleteEntry removes an entry, or deactivates it if the data source supports that. It returns an error
+	// wrapping [ErrEntryNotFound] if there is no entry for the key.
+	DeleteEntry(ctx context.Context, key string) error
+}
+
+// TransactionalDataSource is an optional extension of WritableDataSource. Data sources implementing it are able to
+// change multiple entries atomically.
+type TransactionalDataSource interface {
+	WritableDataSource
+	// Transaction calls fn and applies all of its changes at once. If fn returns an error, no changes are applied.
+	Transaction(ctx context.Context, fn func(tx Tx) error) error
+}
+
+// BatchDataSource is an optional extension of WritableDataSource. Data sources implementing it are able to write
+// many changes using a fixed number of requests, but not atomically.
+type BatchDataSource interface {
+	WritableDataSource
+	// WriteBatch sets the targets of all keys in puts, creating entries as needed, and deletes the keys in deletes.
+	// If it fails, some of the changes might have been written already.
+	WriteBatch(ctx context.Context, puts map[string]string, deletes []string) error
+}
+
+// Tx collects the changes of a transaction. Get reflects the changes made within the transaction.
+type Tx interface {
+	Get(key string) (string, bool)
+	Put(key string, target string)
+	// Delete removes the entry, returning false if there is no entry for the key
+	Delete(key string) bool
+}
+
+var (
+	ErrEntryExists   = errors.New("entry exists already")
+	ErrEntryNotFound = errors.New("entry not found")
+)
@@ -0,0 +1,250 @@
+package ds
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+// sheetRow is a row of the spreadsheet containing a certain key.
+type sheetRow struct {
+	number int
+	// active is true if the row is part of the redirect mapping
+	active bool
+}
+
+// rawValueInput stores values as they are, so targets starting with "=" are not interpreted as formulas
+const rawValueInput = "RAW"
+
+func (ds *GoogleSheetsDataSource) Writable() bool {
+	return ds.config.Writable
+}
+
+func (ds *GoogleSheetsDataSource) SetKeyNormalizer(normalizer func(string) string) {
+	ds.keyNormalizer = normalizer
+}
+
+func (ds *GoogleSheetsDataSource) normalizeKey(key string) string {
+	if ds.keyNormalizer == nil {
+		return key
+	}
+	return ds.keyNormalizer(key)
+}
+
+// CreateEntry appends a new row to the spreadsheet. If there is a deactivated row for the key, it is reactivated
+// instead, so the sheet does not collect duplicate rows.
+func (ds *GoogleSheetsDataSource) CreateEntry(ctx context.Context, key string, target string) error {
+	rows, err := ds.findRows(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	inactiveRow := 0
+	for _, row := range rows {
+		if row.active {
+			return fmt.Errorf("%w: %s (row %d)", ErrEntryExists, key, row.number)
+		}
+		if inactiveRow == 0 {
+			inactiveRow = row.number
+		}
+	}
+
+	if inactiveRow != 0 {
+		return ds.updateRow(ctx, fmt.Sprintf("B%d:C%d", inactiveRow, inactiveRow), target, true)
+	}
+
+	sheetsRange, _ := ds.valuesRange()
+	values := &sheets.ValueRange{Values: [][]any{{key, target, true}}}
+	ctx, endCall := ds.startCall(ctx, "sheets.values.append")
+	_, err = ds.SheetsService().Spreadsheets.Values.Append(ds.config.SpreadsheetId, sheetsRange, values).
+		Context(ctx).
+		ValueInputOption(rawValueInput).
+		InsertDataOption("INSERT_ROWS").
+		Do()
+	endCall(err)
+	if err != nil {
+		return fmt.Errorf("could not append row for key '%s': %w", key, err)
+	}
+	return nil
+}
+
+// UpdateEntry changes the target of all active rows for the key.
+func (ds *GoogleSheetsDataSource) UpdateEntry(ctx context.Context, key string, target string) error {
+	return ds.updateActiveRows(ctx, key, func(row sheetRow) error {
+		return ds.updateRow(ctx, fmt.Sprintf("B%d", row.number), target)
+	})
+}
+
+// DeleteEntry deactivates all active rows for the key using the active column. The rows are kept, so the entry
+// can be restored by editing the spreadsheet.
+func (ds *GoogleSheetsDataSource) DeleteEntry(ctx context.Context, key string) error {
+	return ds.updateActiveRows(ctx, key, func(row sheetRow) error {
+		return ds.updateRow(ctx, fmt.Sprintf("C%d", row.number), false)
+	})
+}
+
+// updateActiveRows calls update for each active row for the key. If there are multiple rows, all of them are
+// changed, so the result does not depend on the key collision strategy.
+func (ds *GoogleSheetsDataSource) updateActiveRows(ctx context.Context, key string, update func(sheetRow) error) error {
+	rows, err := ds.findRows(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for _, row := range rows {
+		if !row.active {
+			continue
+		}
+		found = true
+		if err = update(row); err != nil {
+			return err
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("%w: %s", ErrEntryNotFound, key)
+	}
+	return nil
+}
+
+// WriteBatch reads the spreadsheet once, then writes all changed cells using a single batch update and appends
+// all new rows using a single append, following the rules of [GoogleSheetsDataSource.CreateEntry],
+// [GoogleSheetsDataSource.UpdateEntry] and [GoogleSheetsDataSource.DeleteEntry].
+func (ds *GoogleSheetsDataSource) WriteBatch(ctx context.Context, puts map[string]string, deletes []string) error {
+	rows, err := ds.readRows(ctx)
+	if err != nil {
+		return err
+	}
+
+	var updates []*sheets.ValueRange
+	var appended [][]any
+	updateCells := func(cellRange string, values ...any) {
+		updates = append(updates, &sheets.ValueRange{Range: cellRange, Values: [][]any{values}})
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(puts)) {
+		target := puts[key]
+		inactiveRow, found := 0, false
+		for _, row := range rows[key] {
+			if row.active {
+				found = true
+				updateCells(fmt.Sprintf("B%d", row.number), target)
+			} else if inactiveRow == 0 {
+				inactiveRow = row.number
+			}
+		}
+
+		switch {
+		case found:
+		case inactiveRow != 0:
+			updateCells(fmt.Sprintf("B%d:C%d", inactiveRow, inactiveRow), target, true)
+		default:
+			appended = append(appended, []any{key, target, true})
+		}
+	}
+	for _, key := range deletes {
+		for _, row := range rows[key] {
+			if row.active {
+				updateCells(fmt.Sprintf("C%d", row.number), false)
+			}
+		}
+	}
+
+	if len(updates) > 0 {
+		request := &sheets.BatchUpdateValuesRequest{ValueInputOption: rawValueInput, Data: updates}
+		ctx, endCall := ds.startCall(ctx, "sheets.values.batchUpdate")
+		_, err = ds.SheetsService().Spreadsheets.Values.BatchUpdate(ds.config.SpreadsheetId, request).Context(ctx).Do()
+		endCall(err)
+		if err != nil {
+			return fmt.Errorf("could not update %d ranges: %w", len(updates), err)
+		}
+	}
+
+	if len(appended) > 0 {
+		sheetsRange, _ := ds.valuesRange()
+		ctx, endCall := ds.startCall(ctx, "sheets.values.append")
+		_, err = ds.SheetsService().Spreadsheets.Values.Append(ds.config.SpreadsheetId, sheetsRange, &sheets.ValueRange{Values: appended}).
+			Context(ctx).
+			ValueInputOption(rawValueInput).
+			InsertDataOption("INSERT_ROWS").
+			Do()
+		endCall(err)
+		if err != nil {
+			return fmt.Errorf("could not append %d rows: %w", len(appended), err)
+		}
+	}
+	return nil
+}
+
+func (ds *GoogleSheetsDataSource) updateRow(ctx context.Context, cellRange string, values ...any) error {
+	valueRange := &sheets.ValueRange{Values: [][]any{values}}
+	ctx, endCall := ds.startCall(ctx, "sheets.values.update")
+	_, err := ds.SheetsService().Spreadsheets.Values.Update(ds.config.SpreadsheetId, cellRange, valueRange).
+		Context(ctx).
+		ValueInputOption(rawValueInput).
+		Do()
+	endCall(err)
+	if err != nil {
+		return fmt.Errorf("could not update range %s: %w", cellRange, err)
+	}
+	return nil
+}
+
+// findRows returns all rows whose normalized key equals key.
+func (ds *GoogleSheetsDataSource) findRows(ctx context.Context, key string) ([]sheetRow, error) {
+	rows, err := ds.readRows(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return rows[key], nil
+}
+
+// readRows returns the rows of the spreadsheet grouped by their normalized key. The rows are read right before
+// writing, as rows might have been added or removed since the last update.
+func (ds *GoogleSheetsDataSource) readRows(ctx context.Context) (map[string][]sheetRow, error) {
+	sheetsRange, firstRow := ds.valuesRange()
+
+	ctx, endCall := ds.startCall(ctx, "sheets.values.get")
+	result, err := ds.SheetsService().Spreadsheets.Values.Get(ds.config.SpreadsheetId, sheetsRange).
+		Context(ctx).
+		ValueRenderOption("UNFORMATTED_VALUE").
+		Do()
+	endCall(err)
+	if err != nil {
+		return nil, fmt.Errorf("could not read rows: %w", err)
+	}
+
+	rows := make(map[string][]sheetRow)
+	for i, row := range result.Values {
+		if len(row) == 0 {
+			continue
+		}
+		rowKey, ok := cellToString(row[keyColumn])
+		if !ok {
+			continue
+		}
+		key := ds.normalizeKey(rowKey)
+		rows[key] = append(rows[key], sheetRow{number: firstRow + i, active: isActiveRow(row)})
+	}
+	return rows, nil
+}
+
+// isActiveRow reports whether the row would be part of the redirect mapping, following the rules
+// of [GoogleSheetsDataSource.FetchRedirectMappingReport].
+func isActiveRow(row []any) bool {
+	if len(row) <= targetColumn {
+		return false
+	}
+	if target, ok := row[targetColumn].(string); !ok || len(target) == 0 {
+		return false
+	}
+	if len(row) > isActiveColumn {
+		isActive, ok := cellToBool(row[isActiveColumn])
+		return ok && isActive
+	}
+	return true
+}
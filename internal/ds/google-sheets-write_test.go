@@ -0,0 +1,204 @@
+package ds
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeSheet is a minimal fake of the Sheets values API, operating on the first sheet of a single spreadsheet.
+type fakeSheet struct {
+	mutex    sync.Mutex
+	rows     [][]any
+	requests int
+}
+
+// parseCell parses a cell reference like "B5" into a zero-based column and row.
+func parseCell(cell string) (int, int) {
+	var row int
+	_, _ = fmt.Sscanf(cell[1:], "%d", &row)
+	return int(cell[0] - 'A'), row - 1
+}
+
+func (f *fakeSheet) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.requests++
+
+	if r.Method == http.MethodPost && r.URL.Path == "/v4/spreadsheets/sheet/values:batchUpdate" {
+		var body struct {
+			ValueInputOption string `json:"valueInputOption"`
+			Data             []struct {
+				Range  string  `json:"range"`
+				Values [][]any `json:"values"`
+			} `json:"data"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.ValueInputOption != "RAW" {
+			http.Error(w, "invalid body", http.StatusBadRequest)
+			return
+		}
+		for _, data := range body.Data {
+			f.update(data.Range, data.Values[0])
+		}
+		_, _ = w.Write([]byte("{}"))
+		return
+	}
+
+	cellRange, found := strings.CutPrefix(r.URL.Path, "/v4/spreadsheets/sheet/values/")
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.URL.Query().Get("valueInputOption") != "RAW" {
+		http.Error(w, "unexpected value input option", http.StatusBadRequest)
+		return
+	}
+
+	var body struct {
+		Values [][]any `json:"values"`
+	}
+	if r.Method != http.MethodGet {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || len(body.Values) == 0 {
+			http.Error(w, "invalid body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	switch {
+	case r.Method == http.MethodGet:
+		_, startRow := parseCell(strings.Split(cellRange, ":")[0])
+		_ = json.NewEncoder(w).Encode(map[string]any{"range": cellRange, "values": f.rows[startRow:]})
+	case r.Method == http.MethodPost && strings.HasSuffix(cellRange, ":append"):
+		f.rows = append(f.rows, body.Values...)
+		_, _ = w.Write([]byte("{}"))
+	case r.Method == http.MethodPut:
+		f.update(cellRange, body.Values[0])
+		_, _ = w.Write([]byte("{}"))
+	default:
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+	}
+}
+
+// update writes the values to the row of the range, starting at its first cell.
+func (f *fakeSheet) update(cellRange string, values []any) {
+	column, row := parseCell(strings.Split(cellRange, ":")[0])
+	for len(f.rows[row]) < column+len(values) {
+		f.rows[row] = append(f.rows[row], "")
+	}
+	copy(f.rows[row][column:], values)
+}
+
+// newFakeSheetSource creates a writable data source backed by the fake, normalizing keys to lower case.
+func newFakeSheetSource(t *testing.T, fake *fakeSheet) *GoogleSheetsDataSource {
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	source := &GoogleSheetsDataSource{
+		config: GoogleSheetsConfig{
+			SpreadsheetId: "sheet",
+			SkipFirstRow:  true,
+			Writable:      true,
+			Endpoint:      server.URL,
+			ApiKey:        "test",
+		},
+		ctx:       ctx,
+		ctxCancel: cancel,
+	}
+	source.SetKeyNormalizer(strings.ToLower)
+	return source
+}
+
+func TestSheetsWriteBack(t *testing.T) {
+	fake := &fakeSheet{rows: [][]any{
+		{"key", "target", "active"},
+		{"Docs", "https://docs.example.com"},
+		{"old", "https://old.example.com", false},
+		{"gh", "https://github.com", true},
+	}}
+	source := newFakeSheetSource(t, fake)
+	ctx := t.Context()
+
+	if err := source.CreateEntry(ctx, "docs", "https://example.com"); !errors.Is(err, ErrEntryExists) {
+		t.Errorf("expected existing entry to be rejected, got %v", err)
+	}
+	if err := source.UpdateEntry(ctx, "missing", "https://example.com"); !errors.Is(err, ErrEntryNotFound) {
+		t.Errorf("expected missing entry to be rejected, got %v", err)
+	}
+
+	steps := []error{
+		source.CreateEntry(ctx, "new", "https://new.example.com"),
+		source.CreateEntry(ctx, "old", "https://old.example.com/again"),
+		source.UpdateEntry(ctx, "docs", "https://docs.example.com/v2"),
+		source.DeleteEntry(ctx, "gh"),
+	}
+	for i, err := range steps {
+		if err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+	}
+
+	if err := source.DeleteEntry(ctx, "gh"); !errors.Is(err, ErrEntryNotFound) {
+		t.Errorf("expected deactivated entry to be treated as missing, got %v", err)
+	}
+	if len(fake.rows) != 5 {
+		t.Errorf("expected the deactivated row to be reused, got %d rows", len(fake.rows))
+	}
+
+	mapping, err := source.FetchRedirectMapping(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"Docs": "https://docs.example.com/v2",
+		"old":  "https://old.example.com/again",
+		"new":  "https://new.example.com",
+	}
+	if !maps.Equal(map[string]string(mapping), expected) {
+		t.Errorf("expected mapping %v, got %v", expected, mapping)
+	}
+}
+
+func TestSheetsWriteBatch(t *testing.T) {
+	fake := &fakeSheet{rows: [][]any{
+		{"key", "target", "active"},
+		{"Docs", "https://docs.example.com"},
+		{"old", "https://old.example.com", false},
+		{"gh", "https://github.com", true},
+	}}
+	source := newFakeSheetSource(t, fake)
+
+	puts := map[string]string{
+		"docs": "https://docs.example.com/v2",
+		"old":  "https://old.example.com/again",
+	}
+	for i := range 50 {
+		puts[fmt.Sprintf("new%d", i)] = fmt.Sprintf("https://new.example.com/%d", i)
+	}
+	if err := source.WriteBatch(t.Context(), puts, []string{"gh", "missing"}); err != nil {
+		t.Fatal(err)
+	}
+	// One read, one batch update and one append, regardless of the number of changes
+	if fake.requests != 3 {
+		t.Errorf("expected 3 requests, got %d", fake.requests)
+	}
+
+	mapping, err := source.FetchRedirectMapping(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mapping) != 52 || mapping["Docs"] != puts["docs"] || mapping["old"] != puts["old"] || mapping["new7"] != puts["new7"] {
+		t.Errorf("unexpected mapping %v", mapping)
+	}
+	if _, found := mapping["gh"]; found {
+		t.Error("expected deleted entry to be deactivated")
+	}
+}
@@ -3,6 +3,7 @@ package ds
 import (
 	"context"
 	"encoding/pem"
+	"math"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -11,9 +12,13 @@ import (
 	"sync"
 	"time"
 
+	"github.com/fanonwue/go-short-link/internal/metrics"
+	"github.com/fanonwue/go-short-link/internal/reqlog"
 	"github.com/fanonwue/go-short-link/internal/state"
+	"github.com/fanonwue/go-short-link/internal/tracing"
 	"github.com/fanonwue/go-short-link/internal/util"
 	"github.com/fanonwue/goutils/logging"
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/oauth2/google"
 	"golang.org/x/oauth2/jwt"
 	"google.golang.org/api/drive/v3"
@@ -31,8 +36,12 @@ type GoogleAuthConfig struct {
 type GoogleSheetsConfig struct {
 	SpreadsheetId string
 	SkipFirstRow  bool
-	ApiKey        string
-	Auth          *GoogleAuthConfig
+	// Writable enables changing entries in the spreadsheet, which requires the read-write scope
+	Writable bool
+	// Endpoint overrides the base URL of the Google APIs, e.g. to use a local fake for testing
+	Endpoint string
+	ApiKey   string
+	Auth     *GoogleAuthConfig
 }
 
 type GoogleSheetsDataSource struct {
@@ -46,6 +55,7 @@ type GoogleSheetsDataSource struct {
 	driveService      *drive.Service
 	ctx               context.Context
 	ctxCancel         context.CancelFunc
+	keyNormalizer     func(string) string
 }
 
 const (
@@ -57,9 +67,12 @@ const (
 )
 
 func createSheetsConfig() GoogleSheetsConfig {
+	writable, _ := strconv.ParseBool(os.Getenv(util.PrefixedEnvVar("SPREADSHEET_WRITABLE")))
 	config := GoogleSheetsConfig{
 		SpreadsheetId: os.Getenv(util.PrefixedEnvVar("SPREADSHEET_ID")),
 		SkipFirstRow:  true,
+		Writable:      writable,
+		Endpoint:      os.Getenv(util.PrefixedEnvVar("GOOGLE_API_ENDPOINT")),
 	}
 
 	apiKey := os.Getenv(util.PrefixedEnvVar("API_KEY"))
@@ -74,6 +87,9 @@ func createSheetsConfig() GoogleSheetsConfig {
 		config.Auth = &auth
 	} else {
 		config.ApiKey = apiKey
+		if writable {
+			logging.Warnf("Google does not accept changes authorized by an API key, writing to the spreadsheet requires a service account")
+		}
 	}
 
 	return config
@@ -155,14 +171,26 @@ func (ds *GoogleSheetsDataSource) serviceContext() context.Context {
 	return ctx
 }
 
-func (ds *GoogleSheetsDataSource) serviceContextWithTimeout(duration time.Duration) (context.Context, context.CancelFunc) {
-	return context.WithTimeout(ds.serviceContext(), duration)
+// startCall starts a span for a single API call as a child of the span in ctx. The returned context is
+// limited by the default timeout.
+func (ds *GoogleSheetsDataSource) startCall(ctx context.Context, call string) (context.Context, func(error)) {
+	ctx, span := tracing.Start(ctx, call, attribute.String("spreadsheet.id", ds.config.SpreadsheetId))
+	ctx, cancel := context.WithTimeout(ctx, contextTimeout)
+	return ctx, func(err error) {
+		cancel()
+		metrics.DataSourceCalls.Inc(call, metrics.Result(err))
+		tracing.End(span, err)
+	}
 }
 
 func (ds *GoogleSheetsDataSource) apiScopes() []string {
+	sheetsScope := sheets.SpreadsheetsReadonlyScope
+	if ds.config.Writable {
+		sheetsScope = sheets.SpreadsheetsScope
+	}
 	return []string{
 		drive.DriveMetadataReadonlyScope,
-		sheets.SpreadsheetsReadonlyScope,
+		sheetsScope,
 	}
 }
 
@@ -193,31 +221,41 @@ func (ds *GoogleSheetsDataSource) getClient() *http.Client {
 			ds.httpClient = &http.Client{}
 		}
 
+		// The Google API client only instruments its own HTTP client, so requests are traced explicitly here
+		ds.httpClient.Transport = tracing.Transport(ds.httpClient.Transport)
+
 		ds.httpClient.Timeout = contextTimeout * 2
 	}
 
 	return ds.httpClient
 }
 
-func (ds *GoogleSheetsDataSource) serviceClientOpts() []option.ClientOption {
+// serviceClientOpts returns the options used to create a service. If a custom endpoint is configured, the path of the
+// service (e.g. "drive/v3/") is appended to it, mirroring the layout of the Google APIs.
+func (ds *GoogleSheetsDataSource) serviceClientOpts(servicePath string) []option.ClientOption {
 	var opts []option.ClientOption
 
 	if ds.config.UseServiceAccount() {
 		opts = append(opts, option.WithHTTPClient(ds.getClient()))
 	} else {
 		opts = append(opts,
-			option.WithAPIKey(os.Getenv(util.PrefixedEnvVar("API_KEY"))),
+			option.WithAPIKey(ds.config.ApiKey),
 			option.WithScopes(ds.apiScopes()...),
 		)
 	}
 
+	if len(ds.config.Endpoint) > 0 {
+		endpoint := strings.TrimSuffix(ds.config.Endpoint, "/") + "/" + servicePath
+		opts = append(opts, option.WithEndpoint(endpoint))
+	}
+
 	return opts
 }
 
 func (ds *GoogleSheetsDataSource) DriveService() *drive.Service {
 	if ds.driveService == nil {
 		ctx := ds.serviceContext()
-		newService, err := drive.NewService(ctx, ds.serviceClientOpts()...)
+		newService, err := drive.NewService(ctx, ds.serviceClientOpts("drive/v3/")...)
 		if err != nil {
 			logging.Panicf("Could not create drive service: %v", err)
 		} else {
@@ -229,7 +267,7 @@ func (ds *GoogleSheetsDataSource) DriveService() *drive.Service {
 
 func (ds *GoogleSheetsDataSource) SheetsService() *sheets.Service {
 	if ds.sheetsService == nil {
-		newService, err := sheets.NewService(ds.serviceContext(), ds.serviceClientOpts()...)
+		newService, err := sheets.NewService(ds.serviceContext(), ds.serviceClientOpts("")...)
 		if err != nil {
 			logging.Panicf("Could not create sheets service: %v", err)
 		} else {
@@ -256,13 +294,11 @@ func (ds *GoogleSheetsDataSource) LastUpdate() time.Time {
 func (ds *GoogleSheetsDataSource) SpreadsheetWebLink() (string, error) {
 	service := ds.DriveService()
 
-	// Use a context with timeout
-	ctx, cancel := ds.serviceContextWithTimeout(contextTimeout)
-	defer cancel()
-
+	ctx, endCall := ds.startCall(ds.serviceContext(), "drive.files.get")
 	file, err := service.Files.Get(ds.config.SpreadsheetId).Fields("webViewLink").
 		Context(ctx).
 		Do()
+	endCall(err)
 
 	if err != nil {
 		logging.Warnf("Could not determine webViewLink for Spreadsheet '%s': %v", ds.config.SpreadsheetId, err)
@@ -283,25 +319,24 @@ func (ds *GoogleSheetsDataSource) updateLastUpdate(updateTime time.Time) time.Ti
 	return ds.lastUpdate
 }
 
-func (ds *GoogleSheetsDataSource) updateLastModified() (time.Time, error) {
+func (ds *GoogleSheetsDataSource) updateLastModified(ctx context.Context) (time.Time, error) {
+	log := reqlog.FromContext(ctx)
 	service := ds.DriveService()
 
-	// Use a context with timeout
-	ctx, cancel := ds.serviceContextWithTimeout(contextTimeout)
-	defer cancel()
-
+	ctx, endCall := ds.startCall(ctx, "drive.files.get")
 	file, err := service.Files.Get(ds.config.SpreadsheetId).Fields("modifiedTime").
 		Context(ctx).
 		Do()
+	endCall(err)
 	if err != nil {
-		logging.Errorf("Could not determine modifiedTime for Spreadsheet '%s': %v", ds.config.SpreadsheetId, err)
+		log.Errorf("Could not determine modifiedTime for Spreadsheet '%s': %v", ds.config.SpreadsheetId, err)
 		return time.Time{}, err
 	}
 
 	modifiedTimeRaw := file.ModifiedTime
 	modifiedTime, err := time.Parse(time.RFC3339, modifiedTimeRaw)
 	if err != nil {
-		logging.Errorf("Could not parse RFC3339 timestamp %s: %v", modifiedTimeRaw, err)
+		log.Errorf("Could not parse RFC3339 timestamp %s: %v", modifiedTimeRaw, err)
 		return time.Time{}, err
 	}
 
@@ -312,7 +347,7 @@ func (ds *GoogleSheetsDataSource) updateLastModified() (time.Time, error) {
 	ds.lastModified = modifiedTimeUtc
 
 	if oldTime.UnixMilli() != modifiedTimeUtc.UnixMilli() {
-		logging.Debugf("Updated last modified time to %v", modifiedTimeUtc)
+		log.Debugf("Updated last modified time to %v", modifiedTimeUtc)
 	}
 
 	return ds.lastModified, nil
@@ -323,7 +358,7 @@ func (ds *GoogleSheetsDataSource) LastModified() time.Time {
 	if ds.lastModified.IsZero() {
 		// Release read lock to allow upgrade to a write lock
 		ds.lastModifiedMutex.RUnlock()
-		modified, _ := ds.updateLastModified()
+		modified, _ := ds.updateLastModified(ds.serviceContext())
 		return modified
 	}
 
@@ -331,12 +366,12 @@ func (ds *GoogleSheetsDataSource) LastModified() time.Time {
 	return ds.lastModified
 }
 
-func (ds *GoogleSheetsDataSource) NeedsUpdate() bool {
+func (ds *GoogleSheetsDataSource) NeedsUpdate(ctx context.Context) bool {
 	if ds.lastUpdate.IsZero() {
 		return true
 	}
 
-	modifiedTime, err := ds.updateLastModified()
+	modifiedTime, err := ds.updateLastModified(ctx)
 	if err != nil {
 		return true
 	}
@@ -344,28 +379,30 @@ func (ds *GoogleSheetsDataSource) NeedsUpdate() bool {
 	return modifiedTime.After(ds.lastUpdate)
 }
 
-func (ds *GoogleSheetsDataSource) fetchRedirectMappingInternal() (state.RedirectMap, time.Time, error) {
-	service := ds.SheetsService()
-
-	sheetsRange := "A2:C"
-	if !ds.config.SkipFirstRow {
-		sheetsRange = "A:C"
+// valuesRange returns the range containing the entries in A1 notation, together with the number of its first row.
+func (ds *GoogleSheetsDataSource) valuesRange() (string, int) {
+	if ds.config.SkipFirstRow {
+		return "A2:C", 2
 	}
+	return "A:C", 1
+}
+
+func (ds *GoogleSheetsDataSource) fetchRedirectMappingInternal(ctx context.Context, report *state.MappingReport) (state.RedirectMap, time.Time, error) {
+	service := ds.SheetsService()
 
+	sheetsRange, firstRow := ds.valuesRange()
 	mapping := state.RedirectMap{}
 	updateTime := time.Now().UTC()
 
-	// Use a context with timeout
-	ctx, cancel := ds.serviceContextWithTimeout(contextTimeout)
-	defer cancel()
-
+	ctx, endCall := ds.startCall(ctx, "sheets.values.get")
 	result, err := service.Spreadsheets.Values.Get(ds.config.SpreadsheetId, sheetsRange).
 		Context(ctx).
 		ValueRenderOption("UNFORMATTED_VALUE").
 		Do()
+	endCall(err)
 
 	if err != nil {
-		logging.Errorf("Unable to retrieve data from sheet: %v", err)
+		reqlog.FromContext(ctx).Errorf("Unable to retrieve data from sheet: %v", err)
 		return nil, time.Time{}, err
 	}
 
@@ -373,56 +410,93 @@ func (ds *GoogleSheetsDataSource) fetchRedirectMappingInternal() (state.Redirect
 		return mapping, time.Time{}, nil
 	}
 
-	for _, row := range result.Values {
+	for i, row := range result.Values {
+		rowNumber := firstRow + i
+
+		// Completely empty rows are used as spacers, so they are not worth reporting
+		if len(row) == 0 {
+			continue
+		}
+
+		key, ok := cellToString(row[keyColumn])
+		if !ok {
+			report.Skip(rowNumber, "", "key has unsupported type %T", row[keyColumn])
+			continue
+		}
+
 		if len(row) < 2 {
+			report.Skip(rowNumber, key, "missing target")
 			continue
 		}
 
 		if len(row) > isActiveColumn {
-			isActive, ok := row[isActiveColumn].(bool)
-
+			isActive, ok := cellToBool(row[isActiveColumn])
 			if !ok {
-				rawIsActive, ok := row[isActiveColumn].(string)
-				if !ok {
-					continue
-				}
-
-				isActive, err = strconv.ParseBool(rawIsActive)
-			}
-
-			if !isActive || err != nil {
+				report.Skip(rowNumber, key, "invalid value in active column: %v", row[isActiveColumn])
 				continue
 			}
-		}
-
-		key, ok := row[keyColumn].(string)
-		if !ok {
-			// Check if the key is a number instead
-			intKey, ok := row[keyColumn].(int)
-			if ok {
-				key = strconv.Itoa(intKey)
-			} else {
+			if !isActive {
+				report.Skip(rowNumber, key, "inactive")
 				continue
 			}
 		}
 
 		value, ok := row[targetColumn].(string)
 		if !ok {
+			report.Skip(rowNumber, key, "target has unsupported type %T", row[targetColumn])
 			continue
 		}
 
-		if len(value) == 0 || len(key) == 0 {
+		if len(key) == 0 {
+			report.Skip(rowNumber, key, "missing key")
+			continue
+		}
+		if len(value) == 0 {
+			report.Skip(rowNumber, key, "missing target")
 			continue
 		}
 
-		mapping[key] = value
+		report.Assign(mapping, rowNumber, key, value)
 	}
 
 	return mapping, updateTime, nil
 }
 
-func (ds *GoogleSheetsDataSource) FetchRedirectMapping() (state.RedirectMap, error) {
-	mapping, updateTime, err := ds.fetchRedirectMappingInternal()
+// cellToString converts the unformatted value of a cell to a string. Whole numbers are accepted as well,
+// as keys consisting only of digits are returned as numbers by the API.
+func cellToString(cell any) (string, bool) {
+	switch value := cell.(type) {
+	case string:
+		return value, true
+	case int:
+		return strconv.Itoa(value), true
+	case float64:
+		if value != math.Trunc(value) {
+			return "", false
+		}
+		return strconv.FormatInt(int64(value), 10), true
+	}
+	return "", false
+}
+
+// cellToBool converts the unformatted value of a cell to a boolean.
+func cellToBool(cell any) (bool, bool) {
+	switch value := cell.(type) {
+	case bool:
+		return value, true
+	case string:
+		parsed, err := strconv.ParseBool(value)
+		return parsed, err == nil
+	}
+	return false, false
+}
+
+func (ds *GoogleSheetsDataSource) FetchRedirectMapping(ctx context.Context) (state.RedirectMap, error) {
+	return ds.FetchRedirectMappingReport(ctx, state.NewMappingReport(ds.Id()))
+}
+
+func (ds *GoogleSheetsDataSource) FetchRedirectMappingReport(ctx context.Context, report *state.MappingReport) (state.RedirectMap, error) {
+	mapping, updateTime, err := ds.fetchRedirectMappingInternal(ctx, report)
 
 	if err == nil {
 		ds.updateLastUpdate(updateTime)
@@ -0,0 +1,236 @@
+package ds
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fanonwue/go-short-link/internal/state"
+	"github.com/fanonwue/goutils/logging"
+)
+
+// The journal is an append-only file containing one record per line. Each line starts with the CRC-32 checksum of
+// the record, followed by a space and the record encoded as JSON:
+//
+//	1c291ca3 {"time":"2025-01-02T03:04:05Z","ops":[{"op":"put","key":"docs","target":"https://example.com"}]}
+//
+// A record is only applied if it has been written completely, so a crash while writing loses at most the change
+// being written. Compaction replaces the journal with a single snapshot record containing all entries.
+type (
+	journalOp struct {
+		Op     string `json:"op"`
+		Key    string `json:"key"`
+		Target string `json:"target,omitempty"`
+	}
+
+	journalRecord struct {
+		Time time.Time `json:"time"`
+		// Snapshot records replace all entries instead of changing them
+		Snapshot bool        `json:"snapshot,omitempty"`
+		Ops      []journalOp `json:"ops"`
+	}
+
+	journal struct {
+		path string
+		file *os.File
+		// ops is the number of operations in the journal, used to decide when to compact it
+		ops int
+	}
+)
+
+const (
+	opPut    = "put"
+	opDelete = "delete"
+)
+
+var ErrJournalCorrupted = errors.New("journal is corrupted")
+
+// openJournal opens the journal at path, creating it if necessary, and replays it into entries. An incomplete
+// last record is discarded, as it is the result of a crash while writing. Invalid records before the last one are
+// reported as [ErrJournalCorrupted].
+func openJournal(path string, entries state.RedirectMap) (*journal, time.Time, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, time.Time{}, err
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	j := &journal{path: path, file: file}
+	lastModified, validSize, err := j.replay(entries)
+	if err == nil {
+		err = j.truncate(validSize)
+	}
+	if err != nil {
+		_ = file.Close()
+		return nil, time.Time{}, err
+	}
+	return j, lastModified, nil
+}
+
+func (j *journal) replay(entries state.RedirectMap) (time.Time, int64, error) {
+	reader := bufio.NewReader(j.file)
+	var lastModified time.Time
+	var offset int64
+	lineNumber := 0
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 {
+				logging.Warnf("Discarding incomplete last record of journal %s", j.path)
+			}
+			return lastModified, offset, nil
+		}
+		if err != nil {
+			return time.Time{}, 0, err
+		}
+		lineNumber++
+
+		record, decodeErr := decodeRecord(line)
+		if decodeErr != nil {
+			// Only the last record may be invalid, anything else is not caused by an interrupted write
+			if _, peekErr := reader.Peek(1); errors.Is(peekErr, io.EOF) {
+				logging.Warnf("Discarding invalid last record of journal %s: %v", j.path, decodeErr)
+				return lastModified, offset, nil
+			}
+			return time.Time{}, 0, fmt.Errorf("%w: line %d: %v", ErrJournalCorrupted, lineNumber, decodeErr)
+		}
+
+		if record.Snapshot {
+			clear(entries)
+			j.ops = 0
+		}
+		applyOps(entries, record.Ops)
+		j.ops += len(record.Ops)
+		lastModified = record.Time
+		offset += int64(len(line))
+	}
+}
+
+func (j *journal) truncate(size int64) error {
+	if err := j.file.Truncate(size); err != nil {
+		return err
+	}
+	_, err := j.file.Seek(size, io.SeekStart)
+	return err
+}
+
+func encodeRecord(record journalRecord) ([]byte, error) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	line := fmt.Appendf(nil, "%08x ", crc32.ChecksumIEEE(data))
+	line = append(line, data...)
+	return append(line, '\n'), nil
+}
+
+func decodeRecord(line []byte) (journalRecord, error) {
+	var record journalRecord
+	checksumHex, data, found := bytes.Cut(bytes.TrimSuffix(line, []byte{'\n'}), []byte{' '})
+	if !found {
+		return record, errors.New("missing checksum")
+	}
+	var checksum uint32
+	if _, err := fmt.Sscanf(string(checksumHex), "%08x", &checksum); err != nil {
+		return record, fmt.Errorf("invalid checksum: %w", err)
+	}
+	if crc32.ChecksumIEEE(data) != checksum {
+		return record, errors.New("checksum mismatch")
+	}
+	err := json.Unmarshal(data, &record)
+	return record, err
+}
+
+func applyOps(entries state.RedirectMap, ops []journalOp) {
+	for _, op := range ops {
+		switch op.Op {
+		case opPut:
+			entries[op.Key] = op.Target
+		case opDelete:
+			delete(entries, op.Key)
+		}
+	}
+}
+
+// append writes the record and syncs it to disk. If writing fails, the journal is truncated to its previous size,
+// so a partially written record cannot be followed by further records.
+func (j *journal) append(record journalRecord) error {
+	line, err := encodeRecord(record)
+	if err != nil {
+		return err
+	}
+
+	offset, err := j.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err = j.file.Write(line); err == nil {
+		err = j.file.Sync()
+	}
+	if err != nil {
+		_ = j.truncate(offset)
+		return err
+	}
+	j.ops += len(record.Ops)
+	return nil
+}
+
+// compact replaces the journal with a snapshot of entries. The snapshot is written to a temporary file first,
+// which then replaces the journal, so the journal is never left in an incomplete state.
+func (j *journal) compact(entries state.RedirectMap) error {
+	record := journalRecord{Time: time.Now().UTC(), Snapshot: true, Ops: make([]journalOp, 0, len(entries))}
+	for key, target := range entries {
+		record.Ops = append(record.Ops, journalOp{Op: opPut, Key: key, Target: target})
+	}
+	line, err := encodeRecord(record)
+	if err != nil {
+		return err
+	}
+
+	tempPath := j.path + ".tmp"
+	tempFile, err := os.OpenFile(tempPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = tempFile.Write(line); err == nil {
+		err = tempFile.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tempPath, j.path)
+	}
+	if err != nil {
+		_ = tempFile.Close()
+		_ = os.Remove(tempPath)
+		return err
+	}
+	syncDir(filepath.Dir(j.path))
+
+	_ = j.file.Close()
+	j.file = tempFile
+	j.ops = len(record.Ops)
+	return nil
+}
+
+// syncDir makes a rename within the directory durable. Errors are ignored, as not all platforms support it.
+func syncDir(path string) {
+	dir, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	_ = dir.Sync()
+	_ = dir.Close()
+}
+
+func (j *journal) close() error {
+	return j.file.Close()
+}
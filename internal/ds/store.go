@@ -0,0 +1,207 @@
+package ds
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/fanonwue/go-short-link/internal/reqlog"
+	"github.com/fanonwue/go-short-link/internal/state"
+	"github.com/fanonwue/goutils/logging"
+)
+
+// StoreDataSource keeps the redirect mapping in a local journal file, so the application can be run without
+// Google Sheets. Entries are changed using the links API, and are stored in their normalized form.
+type StoreDataSource struct {
+	mutex        sync.RWMutex
+	journal      *journal
+	entries      state.RedirectMap
+	lastUpdate   time.Time
+	lastModified time.Time
+	// compactMinOps is the minimum number of operations in the journal before it gets compacted
+	compactMinOps int
+}
+
+// storeTx is a transaction on a [StoreDataSource]. Changes are collected and only applied on commit.
+type storeTx struct {
+	entries state.RedirectMap
+	changes map[string]journalOp
+	ops     []journalOp
+}
+
+const (
+	storeSource          = "local-store"
+	defaultCompactMinOps = 1000
+)
+
+// CreateStoreDataSource opens the store at path, creating it if it does not exist yet. The store is closed once
+// ctx is done.
+func CreateStoreDataSource(ctx context.Context, path string) (*StoreDataSource, error) {
+	entries := state.RedirectMap{}
+	j, lastModified, err := openJournal(path, entries)
+	if err != nil {
+		return nil, fmt.Errorf("could not open store %s: %w", path, err)
+	}
+
+	store := &StoreDataSource{
+		journal:       j,
+		entries:       entries,
+		lastModified:  lastModified,
+		compactMinOps: defaultCompactMinOps,
+	}
+	store.compactIfNeeded(ctx)
+	logging.Infof("Opened store %s containing %d entries", path, len(entries))
+
+	go func() {
+		<-ctx.Done()
+		store.Close()
+	}()
+
+	return store, nil
+}
+
+func (ds *StoreDataSource) Id() string {
+	return storeSource
+}
+
+func (ds *StoreDataSource) LastUpdate() time.Time {
+	ds.mutex.RLock()
+	defer ds.mutex.RUnlock()
+	return ds.lastUpdate
+}
+
+func (ds *StoreDataSource) LastModified() time.Time {
+	ds.mutex.RLock()
+	defer ds.mutex.RUnlock()
+	return ds.lastModified
+}
+
+func (ds *StoreDataSource) NeedsUpdate(_ context.Context) bool {
+	ds.mutex.RLock()
+	defer ds.mutex.RUnlock()
+	return ds.lastUpdate.IsZero() || ds.lastModified.After(ds.lastUpdate)
+}
+
+func (ds *StoreDataSource) FetchRedirectMapping(_ context.Context) (state.RedirectMap, error) {
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+	ds.lastUpdate = time.Now().UTC()
+	return maps.Clone(ds.entries), nil
+}
+
+// Len returns the number of entries in the store.
+func (ds *StoreDataSource) Len() int {
+	ds.mutex.RLock()
+	defer ds.mutex.RUnlock()
+	return len(ds.entries)
+}
+
+func (ds *StoreDataSource) Writable() bool {
+	return true
+}
+
+// SetKeyNormalizer is a no-op, as all keys are normalized before being stored.
+func (ds *StoreDataSource) SetKeyNormalizer(_ func(string) string) {}
+
+func (ds *StoreDataSource) CreateEntry(ctx context.Context, key string, target string) error {
+	return ds.Transaction(ctx, func(tx Tx) error {
+		if _, found := tx.Get(key); found {
+			return fmt.Errorf("%w: %s", ErrEntryExists, key)
+		}
+		tx.Put(key, target)
+		return nil
+	})
+}
+
+func (ds *StoreDataSource) UpdateEntry(ctx context.Context, key string, target string) error {
+	return ds.Transaction(ctx, func(tx Tx) error {
+		if _, found := tx.Get(key); !found {
+			return fmt.Errorf("%w: %s", ErrEntryNotFound, key)
+		}
+		tx.Put(key, target)
+		return nil
+	})
+}
+
+func (ds *StoreDataSource) DeleteEntry(ctx context.Context, key string) error {
+	return ds.Transaction(ctx, func(tx Tx) error {
+		if !tx.Delete(key) {
+			return fmt.Errorf("%w: %s", ErrEntryNotFound, key)
+		}
+		return nil
+	})
+}
+
+// Transaction calls fn and commits all of its changes as a single journal record. If fn returns an error,
+// none of the changes are applied. Transactions are serialized.
+func (ds *StoreDataSource) Transaction(ctx context.Context, fn func(tx Tx) error) error {
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+
+	tx := &storeTx{entries: ds.entries, changes: map[string]journalOp{}}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if len(tx.ops) == 0 {
+		return nil
+	}
+
+	record := journalRecord{Time: time.Now().UTC(), Ops: tx.ops}
+	if err := ds.journal.append(record); err != nil {
+		return fmt.Errorf("could not write to store: %w", err)
+	}
+	applyOps(ds.entries, tx.ops)
+	ds.lastModified = record.Time
+	ds.compactIfNeeded(ctx)
+	return nil
+}
+
+// compactIfNeeded compacts the journal once it contains at least twice as many operations as there are entries.
+// Errors are only logged, as the journal stays valid if compacting it fails. The caller must hold the lock.
+func (ds *StoreDataSource) compactIfNeeded(ctx context.Context) {
+	if ds.journal.ops < ds.compactMinOps || ds.journal.ops < 2*len(ds.entries) {
+		return
+	}
+	opsBefore := ds.journal.ops
+	if err := ds.journal.compact(ds.entries); err != nil {
+		reqlog.FromContext(ctx).Warnf("Could not compact store %s: %v", ds.journal.path, err)
+		return
+	}
+	reqlog.FromContext(ctx).Infof("Compacted store %s from %d to %d operations", ds.journal.path, opsBefore, ds.journal.ops)
+}
+
+// Close closes the journal file. The store must not be used afterward.
+func (ds *StoreDataSource) Close() {
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+	if err := ds.journal.close(); err != nil {
+		logging.Warnf("Error closing store %s: %v", ds.journal.path, err)
+	}
+}
+
+func (tx *storeTx) Get(key string) (string, bool) {
+	if op, found := tx.changes[key]; found {
+		return op.Target, op.Op == opPut
+	}
+	target, found := tx.entries[key]
+	return target, found
+}
+
+func (tx *storeTx) Put(key string, target string) {
+	tx.record(journalOp{Op: opPut, Key: key, Target: target})
+}
+
+func (tx *storeTx) Delete(key string) bool {
+	if _, found := tx.Get(key); !found {
+		return false
+	}
+	tx.record(journalOp{Op: opDelete, Key: key})
+	return true
+}
+
+func (tx *storeTx) record(op journalOp) {
+	tx.changes[op.Key] = op
+	tx.ops = append(tx.ops, op)
+}
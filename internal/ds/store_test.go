@@ -0,0 +1,127 @@
+package ds
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func openTestStore(t *testing.T, path string) *StoreDataSource {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	store, err := CreateStoreDataSource(ctx, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func assertEntries(t *testing.T, store *StoreDataSource, expected map[string]string) {
+	t.Helper()
+	mapping, _ := store.FetchRedirectMapping(context.Background())
+	if !maps.Equal(map[string]string(mapping), expected) {
+		t.Errorf("expected %v, got %v", expected, mapping)
+	}
+}
+
+func TestStoreTransactions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "links.journal")
+	store := openTestStore(t, path)
+	ctx := context.Background()
+
+	if err := store.CreateEntry(ctx, "docs", "https://example.com/docs"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.CreateEntry(ctx, "docs", "https://example.com"); !errors.Is(err, ErrEntryExists) {
+		t.Errorf("expected existing entry to be rejected, got %v", err)
+	}
+
+	// A failing transaction must not apply any of its changes
+	txErr := errors.New("abort")
+	err := store.Transaction(ctx, func(tx Tx) error {
+		tx.Put("gh", "https://github.com")
+		tx.Delete("docs")
+		return txErr
+	})
+	if !errors.Is(err, txErr) {
+		t.Errorf("expected transaction error, got %v", err)
+	}
+	assertEntries(t, store, map[string]string{"docs": "https://example.com/docs"})
+
+	err = store.Transaction(ctx, func(tx Tx) error {
+		tx.Put("gh", "https://github.com")
+		tx.Delete("docs")
+		if _, found := tx.Get("docs"); found {
+			t.Error("expected deleted entry to be invisible within the transaction")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	reopened := openTestStore(t, path)
+	assertEntries(t, reopened, map[string]string{"gh": "https://github.com"})
+}
+
+func TestStoreRecovery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "links.journal")
+	store := openTestStore(t, path)
+	ctx := context.Background()
+	_ = store.CreateEntry(ctx, "docs", "https://example.com/docs")
+	_ = store.CreateEntry(ctx, "gh", "https://github.com")
+	store.Close()
+
+	data, _ := os.ReadFile(path)
+	// Simulate a crash while writing the last record
+	if err := os.WriteFile(path, data[:len(data)-10], 0644); err != nil {
+		t.Fatal(err)
+	}
+	store = openTestStore(t, path)
+	assertEntries(t, store, map[string]string{"docs": "https://example.com/docs"})
+	if err := store.CreateEntry(ctx, "new", "https://example.com/new"); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+	assertEntries(t, openTestStore(t, path), map[string]string{"docs": "https://example.com/docs", "new": "https://example.com/new"})
+
+	// A damaged record followed by further records is not caused by a crash
+	data, _ = os.ReadFile(path)
+	data[20] ^= 0xff
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateStoreDataSource(ctx, path); !errors.Is(err, ErrJournalCorrupted) {
+		t.Errorf("expected corrupted journal to be rejected, got %v", err)
+	}
+}
+
+func TestStoreCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "links.journal")
+	store := openTestStore(t, path)
+	store.compactMinOps = 10
+	ctx := context.Background()
+
+	for range 10 {
+		_ = store.Transaction(ctx, func(tx Tx) error {
+			tx.Put("docs", "https://example.com/docs")
+			return nil
+		})
+	}
+	if store.journal.ops != 1 {
+		t.Errorf("expected journal to be compacted to a single operation, got %d", store.journal.ops)
+	}
+	_ = store.CreateEntry(ctx, "gh", "https://github.com")
+	store.Close()
+
+	reopened := openTestStore(t, path)
+	if reopened.journal.ops != 2 {
+		t.Errorf("expected 2 operations after reopening, got %d", reopened.journal.ops)
+	}
+	assertEntries(t, reopened, map[string]string{"docs": "https://example.com/docs", "gh": "https://github.com"})
+}
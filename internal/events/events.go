@@ -0,0 +1,223 @@
+package events
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fanonwue/go-short-link/internal/metrics"
+	"github.com/fanonwue/goutils/logging"
+)
+
+type (
+	// Event describes a single redirect. Client information is reduced to coarse, anonymous values.
+	Event struct {
+		Time      time.Time `json:"time"`
+		Key       string    `json:"key"`
+		Target    string    `json:"target"`
+		MatchType string    `json:"matchType,omitempty"`
+		// Client is the anonymized IP address of the client, omitted if IP addresses are not anonymized
+		Client       string `json:"client,omitempty"`
+		AgentClass   string `json:"agentClass,omitempty"`
+		ReferrerHost string `json:"referrerHost,omitempty"`
+		// Bot is the category of automated clients the client has been classified as, empty for humans
+		Bot string `json:"bot,omitempty"`
+	}
+
+	// Sink delivers batches of events to an external system.
+	Sink interface {
+		Send(ctx context.Context, events []Event) error
+		Close() error
+	}
+
+	Options struct {
+		// BufferSize is the number of events that may be queued before new events are dropped
+		BufferSize int
+		// BatchSize is the maximum number of events sent at once
+		BatchSize int
+		// FlushPeriod is the maximum time an event is queued before it is sent, even if the batch is not full
+		FlushPeriod time.Duration
+		// MaxRetries is the number of retries of a failed batch before it is dropped
+		MaxRetries int
+		// RetryBackoff is the delay before the first retry, it doubles with every further retry
+		RetryBackoff time.Duration
+		// MaxRetryBackoff caps the delay between retries
+		MaxRetryBackoff time.Duration
+	}
+
+	// Exporter queues events and sends them to its sink in the background. Publishing never blocks, if the
+	// queue is full or the sink keeps failing, events are dropped and counted instead.
+	Exporter struct {
+		sink    Sink
+		options Options
+		queue   chan Event
+		done    chan struct{}
+		sent    atomic.Uint64
+		dropped atomic.Uint64
+		closed  bool
+		// closeMutex guards closed and the queue against being closed while an event is published
+		closeMutex sync.RWMutex
+		ctx        context.Context
+		cancel     context.CancelFunc
+	}
+)
+
+const (
+	DropReasonBufferFull = "buffer_full"
+	DropReasonSinkError  = "sink_error"
+
+	shutdownTimeout = 5 * time.Second
+)
+
+var (
+	sentEvents    = metrics.NewCounterVec("gsl_events_sent_total", "Number of click events delivered to the sink.")
+	droppedEvents = metrics.NewCounterVec("gsl_events_dropped_total", "Number of click events dropped by reason.", "reason")
+	retries       = metrics.NewCounterVec("gsl_events_retries_total", "Number of retried event batches.")
+)
+
+func DefaultOptions() Options {
+	return Options{
+		BufferSize:      1000,
+		BatchSize:       100,
+		FlushPeriod:     5 * time.Second,
+		MaxRetries:      5,
+		RetryBackoff:    time.Second,
+		MaxRetryBackoff: time.Minute,
+	}
+}
+
+// NewExporter creates an exporter and starts its background worker, which runs until [Exporter.Close] is called.
+func NewExporter(sink Sink, options Options) *Exporter {
+	options.BufferSize = max(options.BufferSize, 1)
+	options.BatchSize = max(options.BatchSize, 1)
+	if options.FlushPeriod <= 0 {
+		options.FlushPeriod = DefaultOptions().FlushPeriod
+	}
+
+	exporter := &Exporter{
+		sink:    sink,
+		options: options,
+		queue:   make(chan Event, options.BufferSize),
+		done:    make(chan struct{}),
+	}
+	exporter.ctx, exporter.cancel = context.WithCancel(context.Background())
+	go exporter.run()
+	return exporter
+}
+
+// Publish queues an event. It returns false if the event has been dropped because the queue is full
+// or the exporter has been closed.
+func (e *Exporter) Publish(event Event) bool {
+	e.closeMutex.RLock()
+	defer e.closeMutex.RUnlock()
+	if e.closed {
+		return false
+	}
+
+	select {
+	case e.queue <- event:
+		return true
+	default:
+		e.drop(1, DropReasonBufferFull)
+		return false
+	}
+}
+
+// Sent returns the number of events delivered successfully.
+func (e *Exporter) Sent() uint64 {
+	return e.sent.Load()
+}
+
+// Dropped returns the number of events that have been dropped.
+func (e *Exporter) Dropped() uint64 {
+	return e.dropped.Load()
+}
+
+// Close stops accepting events, sends the queued events and closes the sink. Sending is aborted if it
+// does not finish within a few seconds, the remaining events are dropped then.
+func (e *Exporter) Close() error {
+	e.closeMutex.Lock()
+	if e.closed {
+		e.closeMutex.Unlock()
+		return nil
+	}
+	e.closed = true
+	close(e.queue)
+	e.closeMutex.Unlock()
+
+	timer := time.AfterFunc(shutdownTimeout, e.cancel)
+	<-e.done
+	timer.Stop()
+	e.cancel()
+	return e.sink.Close()
+}
+
+func (e *Exporter) run() {
+	defer close(e.done)
+
+	ticker := time.NewTicker(e.options.FlushPeriod)
+	defer ticker.Stop()
+
+	batch := make([]Event, 0, e.options.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		e.send(batch)
+		batch = make([]Event, 0, e.options.BatchSize)
+	}
+
+	for {
+		select {
+		case event, ok := <-e.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, event)
+			if len(batch) >= e.options.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// send delivers a batch, retrying with exponential backoff. The batch is dropped once all retries failed.
+func (e *Exporter) send(batch []Event) {
+	backoff := e.options.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		err := e.sink.Send(e.ctx, batch)
+		if err == nil {
+			e.sent.Add(uint64(len(batch)))
+			sentEvents.Add(uint64(len(batch)))
+			return
+		}
+
+		if attempt >= e.options.MaxRetries || e.ctx.Err() != nil {
+			logging.Warnf("Dropping %d click events after %d failed attempts: %v", len(batch), attempt+1, err)
+			e.drop(len(batch), DropReasonSinkError)
+			return
+		}
+
+		logging.Debugf("Sending click events failed, retrying in %s: %v", backoff, err)
+		retries.Inc()
+		select {
+		case <-e.ctx.Done():
+			e.drop(len(batch), DropReasonSinkError)
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, max(e.options.MaxRetryBackoff, e.options.RetryBackoff))
+	}
+}
+
+func (e *Exporter) drop(count int, reason string) {
+	if count <= 0 {
+		return
+	}
+	e.dropped.Add(uint64(count))
+	droppedEvents.Add(uint64(count), reason)
+}
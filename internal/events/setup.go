@@ -0,0 +1,83 @@
+package events
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/fanonwue/go-short-link/internal/bot"
+	"github.com/fanonwue/go-short-link/internal/conf"
+	"github.com/fanonwue/go-short-link/internal/privacy"
+	"github.com/fanonwue/go-short-link/internal/reqctx"
+	"github.com/fanonwue/go-short-link/internal/stats"
+	"github.com/fanonwue/goutils/logging"
+)
+
+var exporter *Exporter
+
+// Enabled returns whether click events are exported.
+func Enabled() bool {
+	return exporter != nil
+}
+
+// Setup creates the exporter for the configured sink. Events are only exported if a sink is configured.
+func Setup() {
+	var sink Sink
+	switch {
+	case len(conf.Config().EventsWebhookUrl) > 0:
+		sink = NewWebhookSink(conf.Config().EventsWebhookUrl, conf.Config().EventsWebhookToken)
+		logging.Infof("Exporting click events to webhook %s", redactUrl(conf.Config().EventsWebhookUrl))
+	case len(conf.Config().EventsFile) > 0:
+		fileSink, err := OpenFileSink(conf.Config().EventsFile)
+		if err != nil {
+			logging.Errorf("Could not open click events file, events will not be exported: %v", err)
+			return
+		}
+		sink = fileSink
+		privacy.RegisterPurger("click events file", fileSink.PurgeBefore)
+		logging.Infof("Exporting click events to file %s", conf.Config().EventsFile)
+	default:
+		return
+	}
+
+	options := DefaultOptions()
+	options.BufferSize = int(conf.Config().EventsBufferSize)
+	options.BatchSize = int(conf.Config().EventsBatchSize)
+	options.FlushPeriod = conf.Config().EventsFlushPeriod
+	options.MaxRetries = int(conf.Config().EventsMaxRetries)
+	exporter = NewExporter(sink, options)
+}
+
+// Shutdown sends the remaining events and closes the sink.
+func Shutdown() {
+	if !Enabled() {
+		return
+	}
+	if err := exporter.Close(); err != nil {
+		logging.Warnf("Error closing click event sink: %v", err)
+	}
+}
+
+// PublishClick publishes the redirect of the given request, if events are exported and the client
+// has not opted out of tracking.
+func PublishClick(r *http.Request, key string, target string, matchType reqctx.MatchType) {
+	if !Enabled() || !privacy.TrackingAllowed(r) {
+		return
+	}
+
+	var client string
+	// Raw IP addresses are never exported
+	if privacy.Mode() != privacy.IpModeNone {
+		client = privacy.ClientAddr(r)
+	}
+
+	exporter.Publish(Event{
+		Time:         time.Now().UTC(),
+		Key:          key,
+		Target:       target,
+		MatchType:    string(matchType),
+		Client:       client,
+		AgentClass:   stats.AgentClass(r.UserAgent()),
+		ReferrerHost: stats.ReferrerHost(r.Referer()),
+		Bot:          string(bot.FromRequest(r).Category),
+	})
+}
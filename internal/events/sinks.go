@@ -0,0 +1,185 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type (
+	// WebhookSink posts batches as JSON object with an "events" array to a URL.
+	WebhookSink struct {
+		url    string
+		token  string
+		client *http.Client
+	}
+
+	// FileSink appends events to a file, one JSON object per line.
+	FileSink struct {
+		path  string
+		file  *os.File
+		mutex sync.Mutex
+	}
+
+	webhookPayload struct {
+		Events []Event `json:"events"`
+	}
+)
+
+const webhookTimeout = 10 * time.Second
+
+// NewWebhookSink creates a sink posting to webhookUrl. If token is not empty, it is sent as bearer token.
+func NewWebhookSink(webhookUrl string, token string) *WebhookSink {
+	return &WebhookSink{
+		url:    webhookUrl,
+		token:  token,
+		client: &http.Client{Timeout: webhookTimeout},
+	}
+}
+
+func (ws *WebhookSink) Send(ctx context.Context, events []Event) error {
+	body, err := json.Marshal(&webhookPayload{Events: events})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ws.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid webhook URL %s", redactUrl(ws.url))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(ws.token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+ws.token)
+	}
+
+	res, err := ws.client.Do(req)
+	if err != nil {
+		// The error contains the URL, which may include credentials
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			urlErr.URL = redactUrl(urlErr.URL)
+		}
+		return err
+	}
+	defer res.Body.Close()
+	// Drain the body, so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 64*1024))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with status %s", res.Status)
+	}
+	return nil
+}
+
+// redactUrl removes the user info, query and fragment from rawUrl, as they may contain credentials.
+func redactUrl(rawUrl string) string {
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return "(invalid URL)"
+	}
+	parsed.User = nil
+	parsed.RawQuery = ""
+	parsed.Fragment = ""
+	return parsed.String()
+}
+
+func (ws *WebhookSink) Close() error {
+	ws.client.CloseIdleConnections()
+	return nil
+}
+
+// OpenFileSink opens (or creates) the file at path for appending.
+func OpenFileSink(path string) (*FileSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{path: path, file: file}, nil
+}
+
+func (fs *FileSink) Send(_ context.Context, events []Event) error {
+	buffer := &bytes.Buffer{}
+	encoder := json.NewEncoder(buffer)
+	for i := range events {
+		if err := encoder.Encode(&events[i]); err != nil {
+			return err
+		}
+	}
+
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	// Write the batch at once, so concurrent readers never see partial batches
+	_, err := fs.file.Write(buffer.Bytes())
+	return err
+}
+
+func (fs *FileSink) Close() error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	return fs.file.Close()
+}
+
+// PurgeBefore rewrites the file without the events that happened before cutoff. Lines that cannot be parsed
+// are kept, so no data is lost by accident.
+func (fs *FileSink) PurgeBefore(cutoff time.Time) (int, error) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	data, err := os.ReadFile(fs.path)
+	if err != nil {
+		return 0, err
+	}
+
+	kept := &bytes.Buffer{}
+	removed := 0
+	for line := range bytes.Lines(data) {
+		var event Event
+		if err = json.Unmarshal(line, &event); err == nil && event.Time.Before(cutoff) {
+			removed++
+			continue
+		}
+		kept.Write(line)
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+
+	// Write to a temporary file in the same directory, so the rename replaces the file atomically
+	tempFile, err := os.CreateTemp(filepath.Dir(fs.path), filepath.Base(fs.path)+".*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	err = tempFile.Chmod(0644)
+	if err == nil {
+		_, err = tempFile.Write(kept.Bytes())
+	}
+	if err == nil {
+		err = tempFile.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tempFile.Name(), fs.path)
+	}
+	if err != nil {
+		_ = tempFile.Close()
+		_ = os.Remove(tempFile.Name())
+		return 0, err
+	}
+
+	// The old file has been replaced, continue appending to the new one. The sink is the only writer and the
+	// temporary file is positioned at its end, so it can be used directly.
+	_ = fs.file.Close()
+	fs.file = tempFile
+	return removed, nil
+}
@@ -0,0 +1,272 @@
+package linkcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fanonwue/go-short-link/internal/policy"
+	"github.com/fanonwue/go-short-link/internal/state"
+)
+
+type (
+	// Hop is a single response on the way to the final target.
+	Hop struct {
+		Url    string `json:"url"`
+		Status int    `json:"status"`
+	}
+
+	// Result is the outcome of checking the target of a single key.
+	Result struct {
+		Key    string `json:"key"`
+		Target string `json:"target"`
+		// Status is the status code of the last response, 0 if no response has been received
+		Status int    `json:"status,omitempty"`
+		Error  string `json:"error,omitempty"`
+		Broken bool   `json:"broken"`
+		// Chain lists all responses in order, including redirects
+		Chain     []Hop     `json:"chain"`
+		CheckedAt time.Time `json:"checkedAt"`
+	}
+
+	// Report contains the results of checking a whole mapping.
+	Report struct {
+		StartedAt  time.Time `json:"startedAt"`
+		FinishedAt time.Time `json:"finishedAt"`
+		Checked    int       `json:"checked"`
+		Results    []Result  `json:"results"`
+	}
+
+	Options struct {
+		// Timeout limits the duration of a single request
+		Timeout time.Duration
+		// Delay is the minimum delay between the start of two requests
+		Delay time.Duration
+		// MaxRedirects is the number of redirects followed before a target is considered broken
+		MaxRedirects int
+		UserAgent    string
+		// AllowPrivateAddresses allows requests to loopback, link-local and private addresses, which are
+		// refused by default, so targets cannot be used to probe the internal network
+		AllowPrivateAddresses bool
+	}
+
+	// Checker checks redirect targets for availability. Requests are rate limited across all checks
+	// performed by the same checker.
+	Checker struct {
+		client      *http.Client
+		options     Options
+		nextRequest time.Time
+		limitMutex  sync.Mutex
+	}
+)
+
+const (
+	defaultMaxRedirects = 10
+	defaultUserAgent    = "go-short-link-checker/1.0"
+	// maxDrainSize limits how much of a response body is read to allow reusing the connection
+	maxDrainSize = 4096
+)
+
+var (
+	ErrTooManyRedirects = errors.New("too many redirects")
+	ErrPrivateAddress   = errors.New("private address refused")
+)
+
+func NewChecker(options Options) *Checker {
+	if options.MaxRedirects <= 0 {
+		options.MaxRedirects = defaultMaxRedirects
+	}
+	if len(options.UserAgent) == 0 {
+		options.UserAgent = defaultUserAgent
+	}
+	dialer := &net.Dialer{}
+	if !options.AllowPrivateAddresses {
+		// The address is checked after resolving the host name, so DNS cannot be used to bypass the check
+		dialer.Control = refusePrivateAddress
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+
+	return &Checker{
+		options: options,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   options.Timeout,
+			// Redirects are followed manually to record the chain
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// Check requests target, following redirects. A target is considered broken if it cannot be reached, redirects
+// too often or finally responds with a status code of 400 or higher.
+func (c *Checker) Check(ctx context.Context, key string, target string) Result {
+	result := Result{Key: key, Target: target, Chain: []Hop{}}
+	err := c.follow(ctx, target, &result)
+	if err != nil {
+		result.Error = err.Error()
+	}
+	result.Broken = err != nil || result.Status >= http.StatusBadRequest
+	result.CheckedAt = time.Now().UTC()
+	return result
+}
+
+func (c *Checker) follow(ctx context.Context, target string, result *Result) error {
+	current := target
+	for redirects := 0; ; redirects++ {
+		status, location, err := c.request(ctx, current)
+		if err != nil {
+			return err
+		}
+		result.Status = status
+		result.Chain = append(result.Chain, Hop{Url: current, Status: status})
+
+		if status < 300 || status >= 400 || len(location) == 0 {
+			return nil
+		}
+		if redirects >= c.options.MaxRedirects {
+			return ErrTooManyRedirects
+		}
+
+		next, err := resolveLocation(current, location)
+		if err != nil {
+			return fmt.Errorf("invalid redirect location '%s': %w", location, err)
+		}
+		current = next
+	}
+}
+
+// request performs a HEAD request, falling back to GET for servers that do not support HEAD properly.
+func (c *Checker) request(ctx context.Context, target string) (int, string, error) {
+	status, location, err := c.do(ctx, http.MethodHead, target)
+	if err == nil && (status == http.StatusMethodNotAllowed || status == http.StatusNotImplemented) {
+		return c.do(ctx, http.MethodGet, target)
+	}
+	return status, location, err
+}
+
+func (c *Checker) do(ctx context.Context, method string, target string) (int, string, error) {
+	if err := c.wait(ctx); err != nil {
+		return 0, "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("User-Agent", c.options.UserAgent)
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	_, _ = io.CopyN(io.Discard, res.Body, maxDrainSize)
+	_ = res.Body.Close()
+	return res.StatusCode, res.Header.Get("Location"), nil
+}
+
+// wait blocks until the next request may be sent according to the configured delay.
+func (c *Checker) wait(ctx context.Context) error {
+	c.limitMutex.Lock()
+	now := time.Now()
+	start := now
+	if c.nextRequest.After(now) {
+		start = c.nextRequest
+	}
+	c.nextRequest = start.Add(c.options.Delay)
+	c.limitMutex.Unlock()
+
+	if !start.After(now) {
+		return nil
+	}
+	timer := time.NewTimer(start.Sub(now))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// CheckAll checks the targets of all keys in mapping, sorted by key. Domain aliases are skipped, as they
+// point to another key instead of a URL. Each distinct target is only requested once.
+func (c *Checker) CheckAll(ctx context.Context, mapping state.RedirectMap) *Report {
+	report := &Report{StartedAt: time.Now().UTC(), Results: []Result{}}
+	keys := make([]string, 0, len(mapping))
+	for key, target := range mapping {
+		if !policy.IsAlias(target) {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+
+	checked := make(map[string]Result)
+	for _, key := range keys {
+		if ctx.Err() != nil {
+			break
+		}
+		target := mapping[key]
+		result, found := checked[target]
+		if !found {
+			result = c.Check(ctx, key, target)
+			checked[target] = result
+		}
+		result.Key = key
+		report.Results = append(report.Results, result)
+	}
+
+	report.Checked = len(report.Results)
+	report.FinishedAt = time.Now().UTC()
+	return report
+}
+
+// Broken returns the results of all broken targets.
+func (r *Report) Broken() []Result {
+	broken := []Result{}
+	for _, result := range r.Results {
+		if result.Broken {
+			broken = append(broken, result)
+		}
+	}
+	return broken
+}
+
+func refusePrivateAddress(_ string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	ip = ip.Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, ip)
+	}
+	return nil
+}
+
+func resolveLocation(base string, location string) (string, error) {
+	baseUrl, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	locationUrl, err := url.Parse(location)
+	if err != nil {
+		return "", err
+	}
+	return baseUrl.ResolveReference(locationUrl).String(), nil
+}
@@ -0,0 +1,113 @@
+package linkcheck
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fanonwue/go-short-link/internal/state"
+)
+
+func newTestServer(requests *atomic.Int32) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/gone", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusGone)
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/ok", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	mux.HandleFunc("/no-head", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		mux.ServeHTTP(w, r)
+	}))
+}
+
+func TestCheck(t *testing.T) {
+	server := newTestServer(&atomic.Int32{})
+	defer server.Close()
+	checker := NewChecker(Options{Timeout: time.Second, MaxRedirects: 3, AllowPrivateAddresses: true})
+
+	tests := []struct {
+		path   string
+		status int
+		broken bool
+		hops   int
+	}{
+		{"/ok", http.StatusOK, false, 1},
+		{"/gone", http.StatusGone, true, 1},
+		{"/moved", http.StatusOK, false, 2},
+		{"/loop", http.StatusFound, true, 4},
+		{"/no-head", http.StatusOK, false, 1},
+	}
+	for _, test := range tests {
+		result := checker.Check(context.Background(), "key", server.URL+test.path)
+		if result.Status != test.status || result.Broken != test.broken || len(result.Chain) != test.hops {
+			t.Errorf("%s: expected status %d, broken %t and %d hops, got %d, %t and %d hops (%s)",
+				test.path, test.status, test.broken, test.hops, result.Status, result.Broken, len(result.Chain), result.Error)
+		}
+	}
+
+	result := checker.Check(context.Background(), "key", "http://127.0.0.1:1/unreachable")
+	if !result.Broken || len(result.Error) == 0 {
+		t.Errorf("expected unreachable target to be broken with an error, got %+v", result)
+	}
+}
+
+func TestCheckPrivateAddress(t *testing.T) {
+	requests := &atomic.Int32{}
+	server := newTestServer(requests)
+	defer server.Close()
+	checker := NewChecker(Options{Timeout: time.Second})
+
+	for _, target := range []string{server.URL + "/ok", "http://localhost:1/", "http://[::1]:1/", "http://169.254.169.254/"} {
+		result := checker.Check(context.Background(), "key", target)
+		if !result.Broken || !strings.Contains(result.Error, ErrPrivateAddress.Error()) {
+			t.Errorf("%s: expected private address to be refused, got %+v", target, result)
+		}
+	}
+	if count := requests.Load(); count != 0 {
+		t.Errorf("expected no request to reach the server, got %d", count)
+	}
+}
+
+func TestCheckAll(t *testing.T) {
+	requests := &atomic.Int32{}
+	server := newTestServer(requests)
+	defer server.Close()
+
+	delay := 20 * time.Millisecond
+	checker := NewChecker(Options{Timeout: time.Second, Delay: delay, AllowPrivateAddresses: true})
+	report := checker.CheckAll(context.Background(), state.RedirectMap{
+		"a":     server.URL + "/ok",
+		"b":     server.URL + "/ok",
+		"c":     server.URL + "/gone",
+		"alias": "a",
+	})
+
+	if report.Checked != 3 {
+		t.Errorf("expected 3 checked keys, the alias must be skipped, got %d", report.Checked)
+	}
+	if broken := report.Broken(); len(broken) != 1 || broken[0].Key != "c" {
+		t.Errorf("expected only key c to be broken, got %+v", broken)
+	}
+	// Duplicate targets are only requested once
+	if count := requests.Load(); count != 2 {
+		t.Errorf("expected 2 requests, got %d", count)
+	}
+	if elapsed := report.FinishedAt.Sub(report.StartedAt); elapsed < delay {
+		t.Errorf("expected requests to be rate limited, finished after %s", elapsed)
+	}
+}
@@ -0,0 +1,84 @@
+package linkcheck
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/fanonwue/go-short-link/internal/conf"
+	"github.com/fanonwue/go-short-link/internal/metrics"
+	"github.com/fanonwue/go-short-link/internal/repo"
+	"github.com/fanonwue/goutils/logging"
+)
+
+// initialCheckDelay gives the data source time to deliver the first mapping after startup
+const initialCheckDelay = time.Minute
+
+var (
+	latestReport *Report
+	reportMutex  sync.RWMutex
+)
+
+func Enabled() bool {
+	return conf.Config().LinkCheckEnabled
+}
+
+// Setup starts the background job checking all targets periodically, if enabled.
+func Setup(ctx context.Context) {
+	if !Enabled() {
+		return
+	}
+
+	checker := NewChecker(Options{
+		Timeout:               conf.Config().LinkCheckTimeout,
+		Delay:                 conf.Config().LinkCheckDelay,
+		AllowPrivateAddresses: conf.Config().LinkCheckAllowPrivate,
+	})
+	metrics.NewGaugeFunc("gsl_link_check_broken", "Number of broken targets found by the last link check.", func() float64 {
+		if report := LatestReport(); report != nil {
+			return float64(len(report.Broken()))
+		}
+		return 0
+	})
+
+	logging.Infof("Link check enabled, checking all targets every %s", conf.Config().LinkCheckPeriod)
+	go startCheckJob(ctx, checker, conf.Config().LinkCheckPeriod)
+}
+
+// LatestReport returns the report of the last completed check, or nil if no check has completed yet.
+func LatestReport() *Report {
+	reportMutex.RLock()
+	defer reportMutex.RUnlock()
+	return latestReport
+}
+
+func startCheckJob(ctx context.Context, checker *Checker, period time.Duration) {
+	timer := time.NewTimer(initialCheckDelay)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			runCheck(ctx, checker)
+			if period <= 0 {
+				return
+			}
+			timer.Reset(period)
+		}
+	}
+}
+
+func runCheck(ctx context.Context, checker *Checker) {
+	report := checker.CheckAll(ctx, repo.RedirectState().CurrentMapping())
+	if ctx.Err() != nil {
+		return
+	}
+
+	reportMutex.Lock()
+	latestReport = report
+	reportMutex.Unlock()
+
+	logging.Infof("Link check finished, %d of %d targets are broken (took %s)",
+		len(report.Broken()), report.Checked, report.FinishedAt.Sub(report.StartedAt).Round(time.Millisecond))
+}
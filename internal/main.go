@@ -3,21 +3,34 @@ package internal
 import (
 	"context"
 	"errors"
+	"fmt"
 	"html/template"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/fanonwue/go-short-link/internal/auth"
+	"github.com/fanonwue/go-short-link/internal/bot"
 	"github.com/fanonwue/go-short-link/internal/conf"
+	"github.com/fanonwue/go-short-link/internal/events"
+	"github.com/fanonwue/go-short-link/internal/linkcheck"
+	"github.com/fanonwue/go-short-link/internal/metrics"
+	"github.com/fanonwue/go-short-link/internal/privacy"
 	"github.com/fanonwue/go-short-link/internal/repo"
+	"github.com/fanonwue/go-short-link/internal/reqctx"
+	"github.com/fanonwue/go-short-link/internal/reqlog"
 	"github.com/fanonwue/go-short-link/internal/srv"
 	"github.com/fanonwue/go-short-link/internal/state"
+	"github.com/fanonwue/go-short-link/internal/stats"
 	"github.com/fanonwue/go-short-link/internal/tmpl"
 	"github.com/fanonwue/go-short-link/internal/tmpl/minify"
+	"github.com/fanonwue/go-short-link/internal/tracing"
 	"github.com/fanonwue/go-short-link/internal/util"
 	"github.com/fanonwue/goutils/logging"
 	"github.com/joho/godotenv"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type (
@@ -28,9 +41,17 @@ type (
 	RedirectInfoTemplateData struct {
 		RedirectName string
 		Target       string
+		ShowClicks   bool
+		Clicks       uint64
+		// Chart shows the daily clicks of the last ChartDays days, nil if analytics are disabled
+		Chart     *stats.Chart
+		ChartDays int
 	}
 
 	ParsedRequest struct {
+		// Key is the key of the mapping entry the request has been resolved to
+		Key            string
+		MatchType      reqctx.MatchType
 		Target         string
 		OriginalPath   string
 		NormalizedPath string
@@ -42,7 +63,10 @@ type (
 
 const (
 	infoRequestIdentifier = "+"
-	rootRedirectPath      = "__root"
+	// infoChartDays is the number of days shown in the chart, including today
+	infoChartDays   = 30
+	infoChartWidth  = 300
+	infoChartHeight = 60
 )
 
 var (
@@ -89,6 +113,7 @@ func Setup(appContext context.Context) {
 
 	conf.CreateAppConfig()
 	repo.Setup(appContext)
+	auth.Setup()
 
 	var err error
 
@@ -114,6 +139,8 @@ func Setup(appContext context.Context) {
 		logging.Warnf("Could not load redirect-info template file %s: %v", redirectInfoTemplatePath, err)
 	}
 
+	setupAdmin(tpc)
+
 	if conf.Config().UseFallbackFile() {
 		logging.Infof("Fallback file enabled at path: %s", conf.Config().FallbackFile)
 	}
@@ -123,8 +150,14 @@ func Setup(appContext context.Context) {
 	}
 
 	addDefaultRedirectMapHooks(repo.RedirectState())
-
-	_, _ = repo.UpdateRedirectMappingDefault(false)
+	privacy.Setup(appContext)
+	bot.Setup()
+	stats.Setup(appContext)
+	events.Setup()
+	linkcheck.Setup(appContext)
+	tracing.Setup(appContext)
+
+	_, _ = repo.UpdateRedirectMappingDefault(appContext, false)
 	go StartBackgroundUpdates(appContext)
 }
 
@@ -139,17 +172,29 @@ func SetupLogging() {
 }
 
 func ServerHandler(w http.ResponseWriter, r *http.Request) {
-	var startTime time.Time
-	if conf.LogResponseTimes {
-		startTime = time.Now()
-	}
+	startTime := time.Now()
+	var outcome string
+	// The attributes are added to the server span created by the tracing middleware
+	span := trace.SpanFromContext(r.Context())
 
 	pr := RedirectTargetForRequest(r)
+	if pr.Found {
+		reqctx.FromContext(r.Context()).SetMatch(pr.Key, pr.Target, pr.MatchType)
+		span.SetAttributes(
+			attribute.String("redirect.key", pr.Key),
+			attribute.String("redirect.target", pr.Target),
+			attribute.String("redirect.match_type", string(pr.MatchType)),
+		)
+	}
+
 	if !pr.Found {
-		NotFoundHandler(w, pr)
+		outcome = metrics.OutcomeNotFound
+		NotFoundHandler(w, r, pr)
 	} else if pr.InfoRequest && redirectInfoEndpointEnabled() {
-		RedirectInfoHandler(w, pr)
+		outcome = metrics.OutcomeInfo
+		RedirectInfoHandler(w, r, pr)
 	} else {
+		outcome = metrics.OutcomeRedirect
 		responseHeader := w.Header()
 		srv.AddDefaultHeadersWithCache(responseHeader)
 
@@ -163,12 +208,15 @@ func ServerHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		http.Redirect(w, r, pr.Target, http.StatusTemporaryRedirect)
+
+		if botResult := bot.FromRequest(r); botResult.IsBot() {
+			bot.CountClick(botResult)
+		}
+		stats.RecordClick(pr.Key, r)
+		events.PublishClick(r, pr.Key, pr.Target, pr.MatchType)
 	}
-	if conf.LogResponseTimes {
-		endTime := time.Now()
-		duration := endTime.Sub(startTime)
-		logging.Debugf("Request evaluation took %dµs", duration.Microseconds())
-	}
+	span.SetAttributes(attribute.String("redirect.outcome", outcome))
+	metrics.ObserveRequest(outcome, time.Since(startTime).Seconds())
 }
 
 func FaviconHandler(w http.ResponseWriter, r *http.Request, favicon string) {
@@ -184,16 +232,21 @@ func RedirectTargetForRequest(r *http.Request) *ParsedRequest {
 
 	pathEmpty := len(normalizedPath) == 0
 
+	matchType := reqctx.MatchPath
 	// Try to find target by hostname if Path is empty
 	if pathEmpty {
 		normalizedPath, _ = normalizeRedirectPath(r.Host)
+		matchType = reqctx.MatchHost
 	}
 
-	target, found := repo.RedirectState().GetTarget(normalizedPath)
+	key := normalizedPath
+	target, found := repo.RedirectState().GetTarget(key)
 
 	// Assume it's a domain alias when the target does not start with "http"
 	if found && !strings.HasPrefix(target, "http") {
 		normalizedPath, _ = normalizeRedirectPath(target)
+		key = target
+		matchType = reqctx.MatchAlias
 		target, found = repo.RedirectState().GetTarget(target)
 	}
 
@@ -204,9 +257,17 @@ func RedirectTargetForRequest(r *http.Request) *ParsedRequest {
 
 	// If there's no entry based on hostname, try to use the special root redirect key
 	if !found && pathEmpty && conf.Config().AllowRootRedirect {
-		target, found = repo.RedirectState().GetTarget(rootRedirectPath)
+		key = repo.RootKey
+		matchType = reqctx.MatchRoot
+		target, found = repo.RedirectState().GetTarget(repo.RootKey)
+	}
+
+	if !found {
+		matchType = reqctx.MatchNone
 	}
 
+	pr.Key = key
+	pr.MatchType = matchType
 	pr.NormalizedPath = normalizedPath
 	pr.InfoRequest = infoRequest
 	pr.Found = found
@@ -228,25 +289,43 @@ func normalizeRedirectPath(path string) (string, bool) {
 	return path, infoRequest
 }
 
-func RedirectInfoHandler(w http.ResponseWriter, pr *ParsedRequest) {
+func RedirectInfoHandler(w http.ResponseWriter, r *http.Request, pr *ParsedRequest) {
 	// Pre initialize to the specified buffer size, as the response will be bigger than 1KiB due to the size of the template
 	renderedBuf := util.NewBuffer(conf.DefaultBufferSize)
 
-	err := redirectInfoTemplate.Execute(renderedBuf, &RedirectInfoTemplateData{
+	templateData := &RedirectInfoTemplateData{
 		RedirectName: pr.OriginalPath,
 		Target:       pr.Target,
-	})
+		ShowClicks:   stats.Enabled() && conf.Config().ShowClicksOnInfoPage,
+	}
+	if templateData.ShowClicks {
+		templateData.Clicks = stats.Clicks().Count(pr.Key)
+		if stats.AnalyticsEnabled() {
+			now := time.Now().UTC()
+			from := now.Truncate(stats.GranularityDay.Duration()).AddDate(0, 0, 1-infoChartDays)
+			result := stats.Analytics().Query(pr.Key, from, now, stats.GranularityDay)
+			templateData.Chart = stats.NewChart(result.Series, infoChartWidth, infoChartHeight)
+			templateData.ChartDays = infoChartDays
+		}
+	}
+
+	err := redirectInfoTemplate.Execute(renderedBuf, templateData)
 
 	if err != nil {
-		logging.Errorf("Could not render redirect-info template: %v", err)
+		reqlog.FromRequest(r).Errorf("Could not render redirect-info template: %v", err)
 	}
 
-	etagData := util.RedirectEtag(pr.NormalizedPath, pr.Target, "info")
+	etagType := "info"
+	if templateData.ShowClicks {
+		// The page changes with every click, so the count has to be part of the ETag
+		etagType = "info-" + strconv.FormatUint(templateData.Clicks, 10)
+	}
+	etagData := util.RedirectEtag(pr.NormalizedPath, pr.Target, etagType)
 
-	srv.HtmlResponse(w, !pr.NoBodyRequest, http.StatusOK, renderedBuf, etagData)
+	srv.HtmlResponse(w, r, http.StatusOK, renderedBuf, etagData)
 }
 
-func NotFoundHandler(w http.ResponseWriter, pr *ParsedRequest) {
+func NotFoundHandler(w http.ResponseWriter, r *http.Request, pr *ParsedRequest) {
 	if strings.HasPrefix(pr.NormalizedPath, "favicon.") {
 		srv.AddDefaultHeaders(w.Header())
 		w.WriteHeader(404)
@@ -261,10 +340,10 @@ func NotFoundHandler(w http.ResponseWriter, pr *ParsedRequest) {
 	})
 
 	if err != nil {
-		logging.Errorf("Could not render not-found template: %v", err)
+		reqlog.FromRequest(r).Errorf("Could not render not-found template: %v", err)
 	}
 
-	srv.HtmlResponse(w, !pr.NoBodyRequest, http.StatusNotFound, renderedBuf, "")
+	srv.HtmlResponse(w, r, http.StatusNotFound, renderedBuf, "")
 }
 
 func StartBackgroundUpdates(ctx context.Context) {
@@ -277,69 +356,52 @@ func StartBackgroundUpdates(ctx context.Context) {
 			logging.Info("Update context cancelled")
 			return
 		case <-ticker.C:
-			repo.UpdateRedirectMappingChannels(nil, nil, false)
+			repo.UpdateRedirectMappingChannels(ctx, nil, nil, false)
 		}
 	}
 }
 
-func updateMapping(newMap state.RedirectMap, target chan<- state.RedirectMap) {
-	for _, hook := range repo.RedirectState().Hooks() {
-		newMap = hook(newMap)
-	}
-	target <- newMap
-}
-
 func redirectInfoEndpointEnabled() bool {
 	return redirectInfoTemplate != nil
 }
 
 func addDefaultRedirectMapHooks(mapState *state.RedirectMapState) {
-	// This helper function allows modification of a key using the supplied keyModifierFunc
-	// When the modified key differs from the original key, the modified key replaces the
-	// original key
-	modifyKey := func(redirectMap state.RedirectMap, key string, keyModifierFunc func(string) string) {
-		newKey := keyModifierFunc(key)
-		if key != newKey {
-			value := redirectMap[key]
-			delete(redirectMap, key)
-			redirectMap[newKey] = value
+	// This helper function creates a hook that renames every key using the supplied keyModifierFunc.
+	// Keys colliding after the modification are resolved deterministically and recorded in the report.
+	renameKeysHook := func(cause string, keyModifierFunc func(string) string) state.RedirectMapHook {
+		return func(originalMap state.RedirectMap, report *state.MappingReport) (state.RedirectMap, error) {
+			return state.RenameKeys(originalMap, report, cause, keyModifierFunc), nil
 		}
 	}
 
 	logging.Debug("Adding update hook to strip leading and trailing slashes from redirect paths")
-	mapState.AddHook(func(originalMap state.RedirectMap) state.RedirectMap {
-		for key := range originalMap {
-			modifyKey(originalMap, key, func(s string) string {
-				return strings.Trim(s, "/")
-			})
-		}
-		return originalMap
-	})
+	mapState.AddHook(renameKeysHook("stripping slashes", func(s string) string {
+		return strings.Trim(s, "/")
+	}))
 
 	if redirectInfoEndpointEnabled() {
 		logging.Debug("Adding update hook to remove info-request suffix from redirect paths")
-		mapState.AddHook(func(originalMap state.RedirectMap) state.RedirectMap {
-			// Edit map in place
-			for key := range originalMap {
-				modifyKey(originalMap, key, func(s string) string {
-					return strings.TrimRight(s, infoRequestIdentifier)
-				})
+		trimSuffix := func(s string) string {
+			return strings.TrimRight(s, infoRequestIdentifier)
+		}
+		mapState.AddHook(func(originalMap state.RedirectMap, report *state.MappingReport) (state.RedirectMap, error) {
+			renamed := state.RenameKeys(originalMap, report, "removing the info-request suffix", trimSuffix)
+			// The key still works, but requesting it as written shows the info page instead of redirecting
+			for key, target := range originalMap {
+				if newKey := trimSuffix(key); newKey != key && renamed[newKey] == target {
+					report.Warn(newKey, target, fmt.Sprintf("key '%s' is served as '%s', as a trailing '%s' requests the info page",
+						key, newKey, infoRequestIdentifier))
+				}
 			}
-			return originalMap
+			return renamed, nil
 		})
 	}
 
 	if conf.Config().IgnoreCaseInPath {
 		logging.Debug("Adding update hook to make redirect paths lowercase")
-		mapState.AddHook(func(originalMap state.RedirectMap) state.RedirectMap {
-			// Edit map in place
-			for key := range originalMap {
-				modifyKey(originalMap, key, func(s string) string {
-					return strings.ToLower(s)
-				})
-			}
-			return originalMap
-		})
+		mapState.AddHook(renameKeysHook("converting to lowercase", func(s string) string {
+			return strings.ToLower(s)
+		}))
 	}
 }
 
@@ -365,6 +427,10 @@ func Run(ctx context.Context) error {
 		defer cancel()
 		logging.Infof("Shutting down HTTP server")
 		err := server.Shutdown(shutdownContext)
+		stats.Shutdown()
+		events.Shutdown()
+		tracing.Shutdown()
+		closeAccessLog()
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,46 @@
+package metrics
+
+// Request outcomes used as the value of the "outcome" label of the request metrics
+const (
+	OutcomeRedirect = "redirect"
+	OutcomeInfo     = "info"
+	OutcomeNotFound = "not_found"
+	OutcomeAsset    = "asset"
+)
+
+// Results used as the value of the "result" label
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+	ResultHeld    = "held"
+)
+
+var (
+	Requests = NewCounterVec("gsl_http_requests_total",
+		"Number of handled requests by outcome.", "outcome")
+	RequestDuration = NewHistogramVec("gsl_http_request_duration_seconds",
+		"Time taken to handle a request by outcome.", DefaultDurationBuckets, "outcome")
+	MappingUpdates = NewCounterVec("gsl_mapping_updates_total",
+		"Number of mapping updates by result.", "result")
+	MappingUpdateDuration = NewHistogramVec("gsl_mapping_update_duration_seconds",
+		"Time taken to fetch, validate and apply a mapping update.",
+		[]float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30}, "result")
+	FallbackReads = NewCounterVec("gsl_fallback_file_reads_total",
+		"Number of times the fallback file has been used because the data source could not be read.", "result")
+	DataSourceCalls = NewCounterVec("gsl_datasource_api_calls_total",
+		"Number of calls to the API of the data source by call and result.", "call", "result")
+)
+
+// ObserveRequest records a handled request.
+func ObserveRequest(outcome string, seconds float64) {
+	Requests.Inc(outcome)
+	RequestDuration.Observe(seconds, outcome)
+}
+
+// Result maps an error to the value of a "result" label.
+func Result(err error) string {
+	if err != nil {
+		return ResultFailure
+	}
+	return ResultSuccess
+}
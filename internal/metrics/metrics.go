@@ -0,0 +1,302 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// Registry holds all metrics and writes them in the Prometheus text exposition format.
+	Registry struct {
+		collectors []collector
+		mutex      sync.RWMutex
+	}
+
+	collector interface {
+		write(w *bufio.Writer)
+	}
+
+	metricDesc struct {
+		name       string
+		help       string
+		metricType string
+		labels     []string
+	}
+
+	// CounterVec is a monotonically increasing counter, partitioned by label values.
+	CounterVec struct {
+		metricDesc
+		series sync.Map
+	}
+
+	// HistogramVec counts observations in configurable buckets, partitioned by label values.
+	HistogramVec struct {
+		metricDesc
+		buckets []float64
+		series  sync.Map
+	}
+
+	// GaugeFunc is a gauge whose value is determined by calling a function at collection time.
+	GaugeFunc struct {
+		metricDesc
+		valueFunc func() float64
+	}
+
+	histogramSeries struct {
+		bucketCounts []atomic.Uint64
+		count        atomic.Uint64
+		sumBits      atomic.Uint64
+	}
+)
+
+const (
+	ContentType = "text/plain; version=0.0.4; charset=utf-8"
+	// labelSeparator separates label values in the keys of the series maps. It cannot occur in valid UTF-8 text.
+	labelSeparator = "\xff"
+)
+
+var (
+	// DefaultDurationBuckets are suitable for request latencies, ranging from 50µs to 10s
+	DefaultDurationBuckets = []float64{.00005, .0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	defaultRegistry        = &Registry{}
+)
+
+func Default() *Registry {
+	return defaultRegistry
+}
+
+// NewRegistry creates an empty registry. Metrics created by the package-level constructors are registered in the
+// default registry instead.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(c collector) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+// WriteTo writes all registered metrics to w in the Prometheus text exposition format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mutex.RLock()
+	collectors := slices.Clone(r.collectors)
+	r.mutex.RUnlock()
+
+	counter := &countingWriter{w: w}
+	bw := bufio.NewWriter(counter)
+	for _, c := range collectors {
+		c.write(bw)
+	}
+	err := bw.Flush()
+	return counter.n, err
+}
+
+func NewCounterVec(name string, help string, labels ...string) *CounterVec {
+	return defaultRegistry.NewCounterVec(name, help, labels...)
+}
+
+// NewCounterVec creates a counter and registers it in r.
+func (r *Registry) NewCounterVec(name string, help string, labels ...string) *CounterVec {
+	c := &CounterVec{metricDesc: metricDesc{name: name, help: help, metricType: "counter", labels: labels}}
+	r.register(c)
+	return c
+}
+
+// Inc increments the counter identified by the label values by one.
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increments the counter identified by the label values by n.
+func (c *CounterVec) Add(n uint64, labelValues ...string) {
+	key := seriesKey(labelValues)
+	counter, found := c.series.Load(key)
+	if !found {
+		counter, _ = c.series.LoadOrStore(key, &atomic.Uint64{})
+	}
+	counter.(*atomic.Uint64).Add(n)
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.writeHeader(w)
+	for _, key := range sortedKeys(&c.series) {
+		counter, _ := c.series.Load(key)
+		c.writeSample(w, c.name, key, nil, float64(counter.(*atomic.Uint64).Load()))
+	}
+}
+
+func NewHistogramVec(name string, help string, buckets []float64, labels ...string) *HistogramVec {
+	return defaultRegistry.NewHistogramVec(name, help, buckets, labels...)
+}
+
+// NewHistogramVec creates a histogram and registers it in r.
+func (r *Registry) NewHistogramVec(name string, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{
+		metricDesc: metricDesc{name: name, help: help, metricType: "histogram", labels: labels},
+		buckets:    buckets,
+	}
+	r.register(h)
+	return h
+}
+
+// Observe records a single observation for the series identified by the label values.
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	key := seriesKey(labelValues)
+	series, found := h.series.Load(key)
+	if !found {
+		series, _ = h.series.LoadOrStore(key, &histogramSeries{bucketCounts: make([]atomic.Uint64, len(h.buckets))})
+	}
+	s := series.(*histogramSeries)
+
+	// Buckets are counted non-cumulatively, the cumulative counts are calculated when writing
+	index, _ := slices.BinarySearch(h.buckets, value)
+	if index < len(h.buckets) {
+		s.bucketCounts[index].Add(1)
+	}
+	for {
+		oldBits := s.sumBits.Load()
+		newBits := math.Float64bits(math.Float64frombits(oldBits) + value)
+		if s.sumBits.CompareAndSwap(oldBits, newBits) {
+			break
+		}
+	}
+	s.count.Add(1)
+}
+
+// ObserveDuration records the duration in seconds.
+func (h *HistogramVec) ObserveDuration(duration time.Duration, labelValues ...string) {
+	h.Observe(duration.Seconds(), labelValues...)
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.writeHeader(w)
+	for _, key := range sortedKeys(&h.series) {
+		series, _ := h.series.Load(key)
+		s := series.(*histogramSeries)
+
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.bucketCounts[i].Load()
+			h.writeSample(w, h.name+"_bucket", key, []string{"le", formatFloat(bound)}, float64(cumulative))
+		}
+		count := s.count.Load()
+		h.writeSample(w, h.name+"_bucket", key, []string{"le", "+Inf"}, float64(count))
+		h.writeSample(w, h.name+"_sum", key, nil, math.Float64frombits(s.sumBits.Load()))
+		h.writeSample(w, h.name+"_count", key, nil, float64(count))
+	}
+}
+
+func NewGaugeFunc(name string, help string, valueFunc func() float64) *GaugeFunc {
+	return defaultRegistry.NewGaugeFunc(name, help, valueFunc)
+}
+
+// NewGaugeFunc creates a gauge and registers it in r.
+func (r *Registry) NewGaugeFunc(name string, help string, valueFunc func() float64) *GaugeFunc {
+	g := &GaugeFunc{
+		metricDesc: metricDesc{name: name, help: help, metricType: "gauge"},
+		valueFunc:  valueFunc,
+	}
+	r.register(g)
+	return g
+}
+
+func (g *GaugeFunc) write(w *bufio.Writer) {
+	g.writeHeader(w)
+	g.writeSample(w, g.name, "", nil, g.valueFunc())
+}
+
+func (d *metricDesc) writeHeader(w *bufio.Writer) {
+	_, _ = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, escapeHelp(d.help), d.name, d.metricType)
+}
+
+// writeSample writes a single sample. extraLabel is an optional name-value pair appended to the labels of the series.
+func (d *metricDesc) writeSample(w *bufio.Writer, name string, key string, extraLabel []string, value float64) {
+	_, _ = w.WriteString(name)
+
+	var labelValues []string
+	if len(d.labels) > 0 {
+		labelValues = strings.Split(key, labelSeparator)
+	}
+
+	if len(labelValues) > 0 || len(extraLabel) > 0 {
+		_ = w.WriteByte('{')
+		first := true
+		writeLabel := func(labelName, labelValue string) {
+			if !first {
+				_ = w.WriteByte(',')
+			}
+			first = false
+			_, _ = w.WriteString(labelName + `="` + escapeLabelValue(labelValue) + `"`)
+		}
+		for i, labelName := range d.labels {
+			if i < len(labelValues) {
+				writeLabel(labelName, labelValues[i])
+			}
+		}
+		if len(extraLabel) == 2 {
+			writeLabel(extraLabel[0], extraLabel[1])
+		}
+		_ = w.WriteByte('}')
+	}
+
+	_ = w.WriteByte(' ')
+	_, _ = w.WriteString(formatFloat(value))
+	_ = w.WriteByte('\n')
+}
+
+func seriesKey(labelValues []string) string {
+	return strings.Join(labelValues, labelSeparator)
+}
+
+func sortedKeys(series *sync.Map) []string {
+	var keys []string
+	series.Range(func(key, _ any) bool {
+		keys = append(keys, key.(string))
+		return true
+	})
+	slices.Sort(keys)
+	return keys
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,44 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExposition(t *testing.T) {
+	registry := NewRegistry()
+	counter := registry.NewCounterVec("test_events_total", "Test events.", "kind")
+	counter.Inc("a")
+	counter.Add(2, `quo"te`)
+
+	histogram := registry.NewHistogramVec("test_duration_seconds", "Test durations.", []float64{0.1, 1}, "kind")
+	histogram.Observe(0.05, "a")
+	histogram.Observe(0.5, "a")
+	histogram.Observe(5, "a")
+
+	registry.NewGaugeFunc("test_gauge", "Test gauge.", func() float64 { return 42 })
+
+	var builder strings.Builder
+	if _, err := registry.WriteTo(&builder); err != nil {
+		t.Fatal(err)
+	}
+	output := builder.String()
+
+	expected := []string{
+		"# TYPE test_events_total counter\n",
+		"test_events_total{kind=\"a\"} 1\n",
+		"test_events_total{kind=\"quo\\\"te\"} 2\n",
+		"# TYPE test_duration_seconds histogram\n",
+		"test_duration_seconds_bucket{kind=\"a\",le=\"0.1\"} 1\n",
+		"test_duration_seconds_bucket{kind=\"a\",le=\"1\"} 2\n",
+		"test_duration_seconds_bucket{kind=\"a\",le=\"+Inf\"} 3\n",
+		"test_duration_seconds_sum{kind=\"a\"} 5.55\n",
+		"test_duration_seconds_count{kind=\"a\"} 3\n",
+		"test_gauge 42\n",
+	}
+	for _, line := range expected {
+		if !strings.Contains(output, line) {
+			t.Errorf("expected output to contain %q, got:\n%s", line, output)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/fanonwue/go-short-link/internal/conf"
+)
+
+type (
+	// TargetPolicy describes which redirect targets are acceptable. Hosts are matched using shell-like patterns
+	// (see [path.Match]), so "*.example.com" matches every subdomain of example.com, but not example.com itself.
+	TargetPolicy struct {
+		// AllowedSchemes lists the URL schemes a target may use. An empty list allows every scheme.
+		AllowedSchemes []string
+		// AllowedHosts lists host patterns a target must match. An empty list allows every host.
+		AllowedHosts []string
+		// DeniedHosts lists host patterns a target must not match. Denied hosts take precedence over allowed hosts.
+		DeniedHosts []string
+	}
+)
+
+var (
+	ErrInvalidTarget     = errors.New("invalid target URL")
+	ErrSchemeNotAllowed  = errors.New("scheme not allowed")
+	ErrHostNotAllowed    = errors.New("host not allowed")
+	ErrHostDenied        = errors.New("host denied")
+	ErrInvalidHostFilter = errors.New("invalid host pattern")
+)
+
+// FromConfig creates a TargetPolicy based on the current application configuration.
+func FromConfig() *TargetPolicy {
+	return &TargetPolicy{
+		AllowedSchemes: conf.Config().AllowedTargetSchemes,
+		AllowedHosts:   conf.Config().AllowedTargetHosts,
+		DeniedHosts:    conf.Config().DeniedTargetHosts,
+	}
+}
+
+// IsAlias reports whether the target refers to another redirect key instead of an actual URL.
+// This mirrors the lookup logic used when serving requests.
+func IsAlias(target string) bool {
+	return !strings.HasPrefix(target, "http")
+}
+
+// Check validates the target against the policy. Aliases are not checked, as they never leave the server.
+// The returned error wraps one of the package's sentinel errors.
+func (p *TargetPolicy) Check(target string) error {
+	if IsAlias(target) {
+		return nil
+	}
+
+	parsed, err := url.Parse(target)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidTarget, err)
+	}
+
+	scheme := strings.ToLower(parsed.Scheme)
+	if len(p.AllowedSchemes) > 0 && !slices.Contains(p.AllowedSchemes, scheme) {
+		return fmt.Errorf("%w: %s", ErrSchemeNotAllowed, scheme)
+	}
+
+	host := strings.ToLower(parsed.Hostname())
+	if len(host) == 0 {
+		return fmt.Errorf("%w: missing host", ErrInvalidTarget)
+	}
+
+	denied, err := matchesAny(host, p.DeniedHosts)
+	if err != nil {
+		return err
+	}
+	if denied {
+		return fmt.Errorf("%w: %s", ErrHostDenied, host)
+	}
+
+	if len(p.AllowedHosts) == 0 {
+		return nil
+	}
+
+	allowed, err := matchesAny(host, p.AllowedHosts)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return fmt.Errorf("%w: %s", ErrHostNotAllowed, host)
+	}
+
+	return nil
+}
+
+func matchesAny(host string, patterns []string) (bool, error) {
+	for _, pattern := range patterns {
+		matched, err := path.Match(pattern, host)
+		if err != nil {
+			return false, fmt.Errorf("%w '%s': %v", ErrInvalidHostFilter, pattern, err)
+		}
+		if matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,35 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTargetPolicyCheck(t *testing.T) {
+	p := &TargetPolicy{
+		AllowedSchemes: []string{"https"},
+		AllowedHosts:   []string{"example.com", "*.example.com"},
+		DeniedHosts:    []string{"evil.example.com"},
+	}
+
+	tests := []struct {
+		target string
+		err    error
+	}{
+		{"https://example.com/path", nil},
+		{"https://docs.example.com", nil},
+		{"HTTPS://Docs.Example.com", nil},
+		{"some-alias", nil},
+		{"http://example.com", ErrSchemeNotAllowed},
+		{"https://evil.example.com", ErrHostDenied},
+		{"https://example.org", ErrHostNotAllowed},
+		{"https://", ErrInvalidTarget},
+	}
+
+	for _, test := range tests {
+		err := p.Check(test.target)
+		if !errors.Is(err, test.err) {
+			t.Errorf("Check(%q) = %v, expected %v", test.target, err, test.err)
+		}
+	}
+}
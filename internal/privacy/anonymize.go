@@ -0,0 +1,120 @@
+package privacy
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// IpMode determines how client IP addresses are anonymized before they are recorded.
+	IpMode string
+
+	// Anonymizer anonymizes IP addresses. Hashes use a random salt that is rotated periodically and never
+	// persisted, so hashes from different periods cannot be linked to each other.
+	Anonymizer struct {
+		mode          IpMode
+		saltRotation  time.Duration
+		salt          []byte
+		saltCreatedAt time.Time
+		mutex         sync.Mutex
+	}
+)
+
+const (
+	// IpModeNone records IP addresses as they are
+	IpModeNone IpMode = "none"
+	// IpModeTruncate zeroes the host part of IP addresses (IPv4: last octet, IPv6: last 80 bits)
+	IpModeTruncate IpMode = "truncate"
+	// IpModeHash replaces IP addresses with a salted hash
+	IpModeHash IpMode = "hash"
+
+	ipv4PrefixBits = 24
+	ipv6PrefixBits = 48
+	hashLength     = 16
+	saltLength     = 32
+)
+
+func ParseIpMode(value string) (IpMode, error) {
+	mode := IpMode(strings.ToLower(strings.TrimSpace(value)))
+	switch mode {
+	case IpModeNone, IpModeTruncate, IpModeHash:
+		return mode, nil
+	case "":
+		return IpModeTruncate, nil
+	}
+	return IpModeTruncate, fmt.Errorf("unknown IP mode '%s'", value)
+}
+
+func NewAnonymizer(mode IpMode, saltRotation time.Duration) *Anonymizer {
+	return &Anonymizer{
+		mode:         mode,
+		saltRotation: saltRotation,
+	}
+}
+
+func (a *Anonymizer) Mode() IpMode {
+	return a.mode
+}
+
+// Anonymize anonymizes an IP address, which may include a port. Values that are not IP addresses are
+// replaced completely in all modes except [IpModeNone].
+func (a *Anonymizer) Anonymize(addr string) string {
+	if a.mode == IpModeNone || len(addr) == 0 {
+		return addr
+	}
+
+	host := addr
+	if splitHost, _, err := net.SplitHostPort(addr); err == nil {
+		host = splitHost
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return "invalid"
+	}
+	ip = ip.Unmap()
+
+	if a.mode == IpModeHash {
+		return a.hash(ip)
+	}
+	return truncate(ip).String()
+}
+
+func truncate(ip netip.Addr) netip.Addr {
+	bits := ipv6PrefixBits
+	if ip.Is4() {
+		bits = ipv4PrefixBits
+	}
+	prefix, err := ip.WithZone("").Prefix(bits)
+	if err != nil {
+		return netip.Addr{}
+	}
+	return prefix.Addr()
+}
+
+func (a *Anonymizer) hash(ip netip.Addr) string {
+	mac := hmac.New(sha256.New, a.currentSalt())
+	mac.Write(ip.AsSlice())
+	return hex.EncodeToString(mac.Sum(nil))[:hashLength]
+}
+
+func (a *Anonymizer) currentSalt() []byte {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.salt == nil || (a.saltRotation > 0 && time.Since(a.saltCreatedAt) >= a.saltRotation) {
+		salt := make([]byte, saltLength)
+		// crypto/rand.Read never returns an error
+		_, _ = rand.Read(salt)
+		a.salt = salt
+		a.saltCreatedAt = time.Now()
+	}
+	return a.salt
+}
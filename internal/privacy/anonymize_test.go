@@ -0,0 +1,49 @@
+package privacy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTruncate(t *testing.T) {
+	anonymizer := NewAnonymizer(IpModeTruncate, 0)
+	tests := map[string]string{
+		"192.0.2.123":                 "192.0.2.0",
+		"192.0.2.123:54321":           "192.0.2.0",
+		"[2001:db8:1234:5678::1]:443": "2001:db8:1234::",
+		"2001:db8:1234:5678:9abc::1":  "2001:db8:1234::",
+		"::ffff:192.0.2.123":          "192.0.2.0",
+		"not-an-ip":                   "invalid",
+	}
+	for addr, expected := range tests {
+		if actual := anonymizer.Anonymize(addr); actual != expected {
+			t.Errorf("%s: expected %s, got %s", addr, expected, actual)
+		}
+	}
+}
+
+func TestHash(t *testing.T) {
+	anonymizer := NewAnonymizer(IpModeHash, time.Hour)
+	first := anonymizer.Anonymize("192.0.2.1:1234")
+	if len(first) != hashLength {
+		t.Errorf("expected hash of length %d, got %q", hashLength, first)
+	}
+	if second := anonymizer.Anonymize("192.0.2.1:5678"); second != first {
+		t.Errorf("expected the same address to be hashed consistently, got %s and %s", first, second)
+	}
+	if other := anonymizer.Anonymize("192.0.2.2"); other == first {
+		t.Errorf("expected different addresses to have different hashes")
+	}
+
+	// Force a rotation of the salt
+	anonymizer.saltCreatedAt = time.Now().Add(-2 * time.Hour)
+	if rotated := anonymizer.Anonymize("192.0.2.1"); rotated == first {
+		t.Errorf("expected the hash to change after the salt has been rotated")
+	}
+}
+
+func TestNone(t *testing.T) {
+	if actual := NewAnonymizer(IpModeNone, 0).Anonymize("192.0.2.1"); actual != "192.0.2.1" {
+		t.Errorf("expected address to be unchanged, got %s", actual)
+	}
+}
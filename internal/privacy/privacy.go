@@ -0,0 +1,113 @@
+package privacy
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fanonwue/go-short-link/internal/conf"
+	"github.com/fanonwue/go-short-link/internal/util"
+	"github.com/fanonwue/goutils/logging"
+)
+
+type (
+	// PurgeFunc removes all click data recorded before cutoff and returns the number of removed records.
+	PurgeFunc func(cutoff time.Time) (int, error)
+
+	purger struct {
+		name  string
+		purge PurgeFunc
+	}
+)
+
+const (
+	purgePeriod = time.Hour
+	// initialPurgeDelay gives the other components time to register their purgers after startup
+	initialPurgeDelay = time.Minute
+)
+
+var (
+	anonymizer   = NewAnonymizer(IpModeTruncate, 24*time.Hour)
+	purgers      []purger
+	purgersMutex sync.Mutex
+)
+
+// Setup configures the anonymizer and starts the retention purge job, if a retention is configured.
+func Setup(ctx context.Context) {
+	mode, err := ParseIpMode(conf.Config().PrivacyIpMode)
+	if err != nil {
+		logging.Warnf("Invalid %s, falling back to '%s': %v", util.PrefixedEnvVar("PRIVACY_IP_MODE"), mode, err)
+	}
+	anonymizer = NewAnonymizer(mode, conf.Config().PrivacySaltRotation)
+	logging.Infof("Client IP addresses are recorded in '%s' mode", mode)
+
+	if retention := conf.Config().PrivacyRetention; retention > 0 {
+		logging.Infof("Click data is purged after %s", retention)
+		go startPurgeJob(ctx, retention)
+	}
+}
+
+// ClientAddr returns the anonymized IP address of the client.
+func ClientAddr(r *http.Request) string {
+	return anonymizer.Anonymize(r.RemoteAddr)
+}
+
+// Mode returns the configured IP mode.
+func Mode() IpMode {
+	return anonymizer.Mode()
+}
+
+// Anonymize anonymizes the given IP address using the configured mode.
+func Anonymize(addr string) string {
+	return anonymizer.Anonymize(addr)
+}
+
+// TrackingAllowed returns false if the client opted out of tracking using the DNT or Sec-GPC header, and
+// these headers are honored.
+func TrackingAllowed(r *http.Request) bool {
+	if !conf.Config().PrivacyHonorDnt {
+		return true
+	}
+	return r.Header.Get("DNT") != "1" && r.Header.Get("Sec-GPC") != "1"
+}
+
+// RegisterPurger adds a function removing click data that is older than the retention window.
+func RegisterPurger(name string, purge PurgeFunc) {
+	purgersMutex.Lock()
+	defer purgersMutex.Unlock()
+	purgers = append(purgers, purger{name: name, purge: purge})
+}
+
+// Purge runs all registered purgers, removing click data recorded before cutoff.
+func Purge(cutoff time.Time) {
+	purgersMutex.Lock()
+	registered := slices.Clone(purgers)
+	purgersMutex.Unlock()
+
+	for _, p := range registered {
+		removed, err := p.purge(cutoff)
+		if err != nil {
+			logging.Warnf("Error purging %s: %v", p.name, err)
+			continue
+		}
+		if removed > 0 {
+			logging.Infof("Purged %d records from %s older than %s", removed, p.name, cutoff.Format(time.RFC3339))
+		}
+	}
+}
+
+func startPurgeJob(ctx context.Context, retention time.Duration) {
+	timer := time.NewTimer(initialPurgeDelay)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			Purge(time.Now().Add(-retention))
+			timer.Reset(purgePeriod)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fanonwue/go-short-link/internal/conf"
+	"github.com/fanonwue/go-short-link/internal/reqlog"
+	"github.com/fanonwue/go-short-link/internal/state"
+)
+
+type (
+	// PendingUpdate is an update that has been held back by the mass-change guard. It will not be applied
+	// until it gets approved by an administrator, or a subsequent update passes the guard.
+	PendingUpdate struct {
+		Source      string    `json:"source"`
+		HeldAt      time.Time `json:"heldAt"`
+		Reason      string    `json:"reason"`
+		CurrentSize int       `json:"currentSize"`
+		NewSize     int       `json:"newSize"`
+		Removed     []string  `json:"removed"`
+		mapping     state.RedirectMap
+		report      *state.MappingReport
+	}
+)
+
+var (
+	ErrUpdateHeld      = errors.New("update held back by the mass-change guard")
+	ErrNoPendingUpdate = errors.New("no pending update")
+	pendingUpdate      *PendingUpdate
+	pendingUpdateMutex sync.RWMutex
+)
+
+// PendingMappingUpdate returns the update which is currently held back, or nil if there is none.
+func PendingMappingUpdate() *PendingUpdate {
+	pendingUpdateMutex.RLock()
+	defer pendingUpdateMutex.RUnlock()
+	return pendingUpdate
+}
+
+// HasPendingUpdate returns true when an update is held back. The service is considered degraded in that case.
+func HasPendingUpdate() bool {
+	return PendingMappingUpdate() != nil
+}
+
+// ApprovePendingUpdate applies the update which is currently held back, bypassing the mass-change guard.
+func ApprovePendingUpdate(ctx context.Context) (state.RedirectMap, error) {
+	mappingMutex.Lock()
+	defer mappingMutex.Unlock()
+	if pinned := PinnedVersion(); pinned != 0 {
+		return nil, fmt.Errorf("%w: version %d", ErrMappingPinned, pinned)
+	}
+
+	pendingUpdateMutex.Lock()
+	pending := pendingUpdate
+	pendingUpdate = nil
+	pendingUpdateMutex.Unlock()
+
+	if pending == nil {
+		return nil, ErrNoPendingUpdate
+	}
+
+	reqlog.FromContext(ctx).Infof("Pending update with %d entries has been approved", pending.NewSize)
+	applyMapping(ctx, pending.mapping, pending.report, nil)
+	return pending.mapping, nil
+}
+
+// DiscardPendingUpdate drops the update which is currently held back. The current mapping stays active.
+func DiscardPendingUpdate(ctx context.Context) error {
+	pendingUpdateMutex.Lock()
+	defer pendingUpdateMutex.Unlock()
+
+	if pendingUpdate == nil {
+		return ErrNoPendingUpdate
+	}
+
+	reqlog.FromContext(ctx).Infof("Pending update with %d entries has been discarded", pendingUpdate.NewSize)
+	pendingUpdate = nil
+	return nil
+}
+
+func setPendingUpdate(pending *PendingUpdate) {
+	pendingUpdateMutex.Lock()
+	defer pendingUpdateMutex.Unlock()
+	pendingUpdate = pending
+}
+
+// checkMassChange compares the new mapping against the currently active one. If more keys would be removed
+// than allowed by the configuration, the update is held back and an error wrapping ErrUpdateHeld is returned.
+func checkMassChange(ctx context.Context, newMap state.RedirectMap, report *state.MappingReport) error {
+	currentMap := RedirectState().CurrentMapping()
+	removed, reason := massRemoval(currentMap, newMap)
+	if len(reason) == 0 {
+		setPendingUpdate(nil)
+		return nil
+	}
+
+	reqlog.FromContext(ctx).Warnf("Holding back update from %s: %s", report.Source, reason)
+	setPendingUpdate(&PendingUpdate{
+		Source:      report.Source,
+		HeldAt:      time.Now().UTC(),
+		Reason:      reason,
+		CurrentSize: len(currentMap),
+		NewSize:     len(newMap),
+		Removed:     removed,
+		mapping:     newMap,
+		report:      report,
+	})
+	return fmt.Errorf("%w: %s", ErrUpdateHeld, reason)
+}
+
+// massRemoval returns the sorted keys of currentMap missing in newMap. If more of them would be removed than
+// allowed by the configuration, the reason is returned as well; otherwise it is empty.
+func massRemoval(currentMap state.RedirectMap, newMap state.RedirectMap) ([]string, string) {
+	maxRemoved := conf.Config().UpdateGuardMaxRemoved
+	maxRemovedPercent := conf.Config().UpdateGuardMaxRemovedPercent
+	// Nothing can be removed on the initial update
+	if (maxRemoved == 0 && maxRemovedPercent == 0) || len(currentMap) == 0 {
+		return nil, ""
+	}
+
+	var removed []string
+	for key := range currentMap {
+		if _, found := newMap[key]; !found {
+			removed = append(removed, key)
+		}
+	}
+	slices.Sort(removed)
+
+	removedPercent := float64(len(removed)) * 100 / float64(len(currentMap))
+	if maxRemoved > 0 && uint(len(removed)) > maxRemoved {
+		return removed, fmt.Sprintf("%d keys would be removed, at most %d are allowed", len(removed), maxRemoved)
+	}
+	if maxRemovedPercent > 0 && removedPercent > float64(maxRemovedPercent) {
+		return removed, fmt.Sprintf("%.1f%% of all keys would be removed, at most %d%% are allowed", removedPercent, maxRemovedPercent)
+	}
+	return removed, ""
+}
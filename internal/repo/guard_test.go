@@ -0,0 +1,84 @@
+package repo
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/fanonwue/go-short-link/internal/conf"
+	"github.com/fanonwue/go-short-link/internal/ds"
+	"github.com/fanonwue/go-short-link/internal/state"
+)
+
+// holdTestUpdate removes all but one key from a store with three entries and updates the mapping from it,
+// which is held back by the mass-change guard allowing one removal.
+func holdTestUpdate(t *testing.T) {
+	store := useTestStore(t, state.RedirectMap{
+		"docs": "https://docs.example.org",
+		"gh":   "https://github.com",
+		"blog": "https://blog.example.org",
+	})
+	previous := conf.Config().UpdateGuardMaxRemoved
+	conf.Config().UpdateGuardMaxRemoved = 1
+	t.Cleanup(func() {
+		conf.Config().UpdateGuardMaxRemoved = previous
+		setPendingUpdate(nil)
+	})
+
+	err := store.Transaction(t.Context(), func(tx ds.Tx) error {
+		tx.Delete("gh")
+		tx.Delete("blog")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = UpdateRedirectMappingDefault(t.Context(), true); !errors.Is(err, ErrUpdateHeld) {
+		t.Fatalf("expected the update to be held back, got %v", err)
+	}
+	if !HasPendingUpdate() {
+		t.Fatal("expected the service to be degraded while an update is held back")
+	}
+	if pending := PendingMappingUpdate(); !slices.Equal(pending.Removed, []string{"blog", "gh"}) || pending.NewSize != 1 {
+		t.Errorf("expected the pending update to remove blog and gh, got %+v", pending)
+	}
+	if mapping := RedirectState().CurrentMapping(); len(mapping) != 3 {
+		t.Errorf("expected the held back update not to be applied, got %v", mapping)
+	}
+}
+
+func TestApprovePendingUpdate(t *testing.T) {
+	holdTestUpdate(t)
+
+	newMap, err := ApprovePendingUpdate(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mapping := RedirectState().CurrentMapping(); len(mapping) != 1 || len(newMap) != 1 {
+		t.Errorf("expected the approved update to be applied, got %v", mapping)
+	}
+	if HasPendingUpdate() {
+		t.Error("expected no pending update after approving it")
+	}
+	if _, err = ApprovePendingUpdate(t.Context()); !errors.Is(err, ErrNoPendingUpdate) {
+		t.Errorf("expected approving twice to fail, got %v", err)
+	}
+}
+
+func TestDiscardPendingUpdate(t *testing.T) {
+	holdTestUpdate(t)
+
+	if err := DiscardPendingUpdate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if mapping := RedirectState().CurrentMapping(); len(mapping) != 3 {
+		t.Errorf("expected the current mapping to stay active, got %v", mapping)
+	}
+	if HasPendingUpdate() {
+		t.Error("expected no pending update after discarding it")
+	}
+	if err := DiscardPendingUpdate(t.Context()); !errors.Is(err, ErrNoPendingUpdate) {
+		t.Errorf("expected discarding twice to fail, got %v", err)
+	}
+}
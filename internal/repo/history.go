@@ -0,0 +1,166 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/fanonwue/go-short-link/internal/conf"
+	"github.com/fanonwue/go-short-link/internal/reqlog"
+	"github.com/fanonwue/go-short-link/internal/state"
+	"github.com/fanonwue/goutils/logging"
+)
+
+type (
+	historyFile struct {
+		PinnedId uint64               `json:"pinnedId,omitempty"`
+		Entries  []state.HistoryEntry `json:"entries"`
+	}
+)
+
+const historyFileName = "history.json"
+
+var (
+	ErrMappingPinned  = errors.New("mapping is pinned to a previous version")
+	ErrNotPinned      = errors.New("mapping is not pinned")
+	ErrUnknownVersion = errors.New("unknown mapping version")
+	mappingHistory    = state.NewHistory(0)
+	pinnedId          uint64
+	pinnedIdMutex     sync.RWMutex
+	historyFileMutex  sync.Mutex
+)
+
+func MappingHistory() *state.History {
+	return mappingHistory
+}
+
+// PinnedVersion returns the ID of the history entry the mapping is pinned to, or zero if it is not pinned.
+func PinnedVersion() uint64 {
+	pinnedIdMutex.RLock()
+	defer pinnedIdMutex.RUnlock()
+	return pinnedId
+}
+
+func setPinnedVersion(id uint64) {
+	pinnedIdMutex.Lock()
+	defer pinnedIdMutex.Unlock()
+	pinnedId = id
+}
+
+// Rollback applies the mapping of a previous version and pins it. Regular updates are skipped until [Unpin] is called.
+func Rollback(ctx context.Context, id uint64) (state.HistoryEntry, error) {
+	entry, found := MappingHistory().Get(id)
+	if !found {
+		return entry, fmt.Errorf("%w: %d", ErrUnknownVersion, id)
+	}
+
+	mappingMutex.Lock()
+	defer mappingMutex.Unlock()
+	reqlog.FromContext(ctx).Infof("Rolling back to mapping version %d, pinning it until explicitly unpinned", id)
+	setPinnedVersion(id)
+	// The rollback is not recorded in the history, as a new entry might evict the pinned one
+	publishMapping(ctx, entry.Mapping, state.NewMappingReport(historySource(id)), nil)
+	saveHistoryLog()
+	return entry, nil
+}
+
+// Unpin removes the pin created by [Rollback], so the mapping is updated from the data source again.
+func Unpin(ctx context.Context) error {
+	mappingMutex.Lock()
+	defer mappingMutex.Unlock()
+	if PinnedVersion() == 0 {
+		return ErrNotPinned
+	}
+	setPinnedVersion(0)
+	reqlog.FromContext(ctx).Infof("Mapping has been unpinned")
+	saveHistoryLog()
+	return nil
+}
+
+// restorePinnedMapping publishes the pinned mapping after a restart, so the pin survives restarts as well.
+func restorePinnedMapping(ctx context.Context) {
+	id := PinnedVersion()
+	if id == 0 {
+		return
+	}
+
+	entry, found := MappingHistory().Get(id)
+	if !found {
+		logging.Warnf("Pinned mapping version %d is not part of the history anymore, unpinning", id)
+		setPinnedVersion(0)
+		return
+	}
+
+	logging.Infof("Mapping is pinned to version %d, restoring it", id)
+	publishMapping(ctx, entry.Mapping, state.NewMappingReport(historySource(id)), nil)
+}
+
+func historySource(id uint64) string {
+	return fmt.Sprintf("history#%d", id)
+}
+
+func setupHistory() {
+	mappingHistory = state.NewHistory(int(conf.Config().HistorySize))
+
+	path := historyFilePath()
+	if len(path) == 0 {
+		return
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			logging.Warnf("Error reading history file: %v", err)
+		}
+		return
+	}
+
+	var persisted historyFile
+	if err = json.Unmarshal(data, &persisted); err != nil {
+		logging.Warnf("Error unmarshaling history file: %v", err)
+		return
+	}
+
+	mappingHistory.Restore(persisted.Entries)
+	setPinnedVersion(persisted.PinnedId)
+	logging.Infof("Restored %d mapping versions from history file", len(persisted.Entries))
+}
+
+// historyFilePath returns the path of the history file, which is placed next to the fallback file.
+// An empty string is returned if the history should not be persisted.
+func historyFilePath() string {
+	if !conf.Config().PersistHistory || !conf.Config().UseFallbackFile() {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(conf.Config().FallbackFile), historyFileName)
+}
+
+func saveHistory() error {
+	path := historyFilePath()
+	if len(path) == 0 {
+		return nil
+	}
+
+	historyFileMutex.Lock()
+	defer historyFileMutex.Unlock()
+
+	jsonBytes, err := json.Marshal(&historyFile{
+		PinnedId: PinnedVersion(),
+		Entries:  MappingHistory().Snapshot(),
+	})
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, jsonBytes, 0644)
+}
+
+func saveHistoryLog() {
+	if err := saveHistory(); err != nil {
+		logging.Warnf("Error writing history file: %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+package repo
+
+import (
+	"encoding/json"
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fanonwue/go-short-link/internal/conf"
+	"github.com/fanonwue/go-short-link/internal/ds"
+	"github.com/fanonwue/go-short-link/internal/state"
+)
+
+// useTestHistory replaces the mapping history with an empty one, which is unpinned again after the test.
+func useTestHistory(t *testing.T) {
+	previous := mappingHistory
+	mappingHistory = state.NewHistory(10)
+	t.Cleanup(func() {
+		mappingHistory = previous
+		setPinnedVersion(0)
+	})
+}
+
+func TestRollback(t *testing.T) {
+	store := useTestStore(t, state.RedirectMap{
+		"docs": "https://docs.example.org/v1",
+		"gh":   "https://github.com",
+	})
+	useTestHistory(t)
+	if _, err := UpdateRedirectMappingDefault(t.Context(), true); err != nil {
+		t.Fatal(err)
+	}
+	err := store.Transaction(t.Context(), func(tx ds.Tx) error {
+		tx.Put("docs", "https://docs.example.org/v2")
+		tx.Delete("gh")
+		tx.Put("blog", "https://blog.example.org")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = UpdateRedirectMappingDefault(t.Context(), true); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := MappingHistory().Entries()
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 history entries, got %d", len(entries))
+	}
+	first, _ := MappingHistory().Get(entries[0].Id)
+	second, _ := MappingHistory().Get(entries[1].Id)
+	diff := state.Diff(first.Mapping, second.Mapping)
+	expectedChange := state.TargetChange{Old: "https://docs.example.org/v1", New: "https://docs.example.org/v2"}
+	if !maps.Equal(diff.Added, state.RedirectMap{"blog": "https://blog.example.org"}) ||
+		!maps.Equal(diff.Removed, state.RedirectMap{"gh": "https://github.com"}) ||
+		len(diff.Changed) != 1 || diff.Changed["docs"] != expectedChange {
+		t.Errorf("unexpected diff %+v", diff)
+	}
+
+	if _, err = Rollback(t.Context(), first.Id); err != nil {
+		t.Fatal(err)
+	}
+	if PinnedVersion() != first.Id || !maps.Equal(RedirectState().CurrentMapping(), first.Mapping) {
+		t.Errorf("expected version %d to be active and pinned, got %v (pinned %d)", first.Id, RedirectState().CurrentMapping(), PinnedVersion())
+	}
+	if _, err = UpdateRedirectMappingDefault(t.Context(), true); !errors.Is(err, ErrMappingPinned) {
+		t.Errorf("expected forced update to be refused while pinned, got %v", err)
+	}
+	if !maps.Equal(RedirectState().CurrentMapping(), first.Mapping) {
+		t.Errorf("expected the pinned mapping to stay active, got %v", RedirectState().CurrentMapping())
+	}
+	if len(MappingHistory().Entries()) != 2 {
+		t.Error("expected the rollback not to be recorded in the history")
+	}
+
+	if err = Unpin(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if err = Unpin(t.Context()); !errors.Is(err, ErrNotPinned) {
+		t.Errorf("expected unpinning twice to fail, got %v", err)
+	}
+	if _, err = UpdateRedirectMappingDefault(t.Context(), true); err != nil {
+		t.Fatal(err)
+	}
+	if !maps.Equal(RedirectState().CurrentMapping(), second.Mapping) {
+		t.Errorf("expected the mapping to be updated after unpinning, got %v", RedirectState().CurrentMapping())
+	}
+
+	if _, err = Rollback(t.Context(), 999); !errors.Is(err, ErrUnknownVersion) {
+		t.Errorf("expected rollback to an unknown version to fail, got %v", err)
+	}
+}
+
+func TestRestoreHistory(t *testing.T) {
+	useTestStore(t, state.RedirectMap{"docs": "https://docs.example.org/v3"})
+	useTestHistory(t)
+	dir := t.TempDir()
+	previousPersist, previousFallback := conf.Config().PersistHistory, conf.Config().FallbackFile
+	conf.Config().PersistHistory = true
+	conf.Config().FallbackFile = filepath.Join(dir, "fallback.json")
+	t.Cleanup(func() {
+		conf.Config().PersistHistory = previousPersist
+		conf.Config().FallbackFile = previousFallback
+	})
+
+	persisted, _ := json.Marshal(historyFile{
+		PinnedId: 2,
+		Entries: []state.HistoryEntry{
+			{Id: 1, Source: "store", Size: 1, Mapping: state.RedirectMap{"docs": "https://docs.example.org/v1"}},
+			{Id: 2, Source: "store", Size: 1, Mapping: state.RedirectMap{"docs": "https://docs.example.org/v2"}},
+		},
+	})
+	if err := os.WriteFile(filepath.Join(dir, historyFileName), persisted, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	setupHistory()
+	restorePinnedMapping(t.Context())
+	if len(MappingHistory().Entries()) != 2 || PinnedVersion() != 2 {
+		t.Fatalf("expected 2 restored entries pinned to version 2, got %d (pinned %d)", len(MappingHistory().Entries()), PinnedVersion())
+	}
+	if target, _ := RedirectState().GetTarget("docs"); target != "https://docs.example.org/v2" {
+		t.Errorf("expected the pinned version to be restored, got %s", target)
+	}
+
+	if err := Unpin(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := UpdateRedirectMappingDefault(t.Context(), true); err != nil {
+		t.Fatal(err)
+	}
+	entries := MappingHistory().Entries()
+	if len(entries) != 3 || entries[2].Id != 3 {
+		t.Errorf("expected the next entry to continue the restored IDs, got %+v", entries)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, historyFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved historyFile
+	if err = json.Unmarshal(data, &saved); err != nil || saved.PinnedId != 0 || len(saved.Entries) != 3 {
+		t.Errorf("expected the unpinned history to be saved, got %+v (%v)", saved, err)
+	}
+}
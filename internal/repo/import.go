@@ -0,0 +1,235 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/fanonwue/go-short-link/internal/ds"
+	"github.com/fanonwue/go-short-link/internal/policy"
+	"github.com/fanonwue/go-short-link/internal/state"
+	"github.com/fanonwue/go-short-link/internal/transfer"
+)
+
+type (
+	ImportMode string
+
+	ImportRejection struct {
+		Key    string `json:"key"`
+		Target string `json:"target"`
+		Reason string `json:"reason"`
+	}
+
+	// ImportResult describes the changes an import applies (or would apply, for dry runs) to the active mapping.
+	ImportResult struct {
+		Mode   ImportMode `json:"mode"`
+		DryRun bool       `json:"dryRun"`
+		state.MappingDiff
+		Rejected []ImportRejection `json:"rejected,omitempty"`
+		// Notes lists the features of a foreign export that could not be imported
+		Notes []transfer.Note `json:"notes,omitempty"`
+	}
+)
+
+const (
+	// ImportMerge adds and changes the imported entries, keeping all other entries
+	ImportMerge ImportMode = "merge"
+	// ImportReplace makes the imported entries the new mapping, removing all other entries
+	ImportReplace ImportMode = "replace"
+	importSource             = "import"
+)
+
+var (
+	ErrInvalidImportMode = errors.New("invalid import mode")
+	ErrImportRejected    = errors.New("the import contains invalid entries, no changes have been applied")
+	ErrPartialImport     = errors.New("the import has only been applied partially")
+	ErrEmptyImport       = errors.New("the import does not contain any entries")
+	ErrImportGuarded     = errors.New("the import has been refused by the mass-change guard")
+	errNoChanges         = errors.New("no changes")
+)
+
+func ParseImportMode(value string) (ImportMode, error) {
+	switch mode := ImportMode(strings.ToLower(value)); mode {
+	case "", ImportMerge:
+		return ImportMerge, nil
+	case ImportReplace:
+		return mode, nil
+	}
+	return "", fmt.Errorf("%w '%s', must be one of [%s, %s]", ErrInvalidImportMode, value, ImportMerge, ImportReplace)
+}
+
+// ImportLinks applies the entries to the data source and the active mapping. All entries are validated first; if any
+// of them is invalid, [ErrImportRejected] is returned and nothing is changed. Imports in replace mode removing more
+// keys than allowed by the mass-change guard are refused with [ErrImportGuarded] unless they have been confirmed.
+// Data sources supporting transactions apply the import atomically, other data sources write it in batches or one
+// entry after another. If that fails, [ErrPartialImport] is returned and the mapping is reloaded from the data source.
+func ImportLinks(ctx context.Context, entries []transfer.Entry, mode ImportMode, dryRun bool, confirmed bool) (ImportResult, error) {
+	if len(entries) == 0 {
+		return ImportResult{Mode: mode, DryRun: dryRun}, ErrEmptyImport
+	}
+
+	var result ImportResult
+	if dryRun {
+		current := RedirectState().CurrentMapping()
+		var newMapping state.RedirectMap
+		newMapping, result = planImport(current, entries, mode)
+		result.DryRun = true
+		if len(result.Rejected) > 0 {
+			return result, ErrImportRejected
+		}
+		return result, checkImportGuard(current, newMapping, mode, confirmed)
+	}
+
+	err := modifyLinks(ctx, importSource, func(source ds.WritableDataSource, mapping state.RedirectMap) error {
+		var newMapping state.RedirectMap
+		newMapping, result = planImport(mapping, entries, mode)
+		if len(result.Rejected) > 0 {
+			return ErrImportRejected
+		}
+		if len(result.Added)+len(result.Changed)+len(result.Removed) == 0 {
+			return errNoChanges
+		}
+		if err := checkImportGuard(mapping, newMapping, mode, confirmed); err != nil {
+			return err
+		}
+		if err := writeImport(ctx, source, result.MappingDiff); err != nil {
+			return err
+		}
+		clear(mapping)
+		maps.Copy(mapping, newMapping)
+		return nil
+	})
+
+	switch {
+	case errors.Is(err, errNoChanges):
+		return result, nil
+	case errors.Is(err, ErrPartialImport):
+		_, _ = UpdateRedirectMappingDefault(ctx, true)
+	}
+	return result, err
+}
+
+// checkImportGuard refuses unconfirmed imports in replace mode which would remove more keys than allowed by the
+// mass-change guard.
+func checkImportGuard(current state.RedirectMap, newMapping state.RedirectMap, mode ImportMode, confirmed bool) error {
+	if mode != ImportReplace || confirmed {
+		return nil
+	}
+	if _, reason := massRemoval(current, newMapping); len(reason) > 0 {
+		return fmt.Errorf("%w: %s", ErrImportGuarded, reason)
+	}
+	return nil
+}
+
+// planImport computes the mapping resulting from the import and validates all new or changed entries.
+func planImport(current state.RedirectMap, entries []transfer.Entry, mode ImportMode) (state.RedirectMap, ImportResult) {
+	result := ImportResult{Mode: mode}
+	imported := make(state.RedirectMap, len(entries))
+	for _, entry := range entries {
+		key, err := NormalizeKey(entry.Key)
+		if err == nil {
+			if _, duplicate := imported[key]; duplicate {
+				err = fmt.Errorf("%w: duplicate key", ErrInvalidKey)
+			}
+		}
+		if err != nil {
+			result.Rejected = append(result.Rejected, ImportRejection{Key: entry.Key, Target: entry.Target, Reason: err.Error()})
+			continue
+		}
+		target := entry.Target
+		if policy.IsAlias(target) {
+			// Aliases refer to keys as written in the source, so they have to be normalized like the keys
+			if normalized, err := NormalizeKey(target); err == nil {
+				target = normalized
+			}
+		}
+		imported[key] = target
+	}
+
+	newMapping := imported
+	if mode == ImportMerge {
+		newMapping = maps.Clone(current)
+		maps.Copy(newMapping, imported)
+	}
+	result.MappingDiff = state.Diff(current, newMapping)
+
+	for _, key := range slices.Sorted(maps.Keys(newMapping)) {
+		target := newMapping[key]
+		_, added := result.Added[key]
+		_, changed := result.Changed[key]
+
+		var err error
+		if added || changed {
+			err = validateTarget(key, target, newMapping)
+		} else if _, removed := result.Removed[target]; policy.IsAlias(target) && removed {
+			// Unchanged aliases break if the entry they refer to has been removed
+			err = fmt.Errorf("%w: alias of removed key '%s'", policy.ErrInvalidTarget, target)
+		}
+		if err != nil {
+			result.Rejected = append(result.Rejected, ImportRejection{Key: key, Target: target, Reason: err.Error()})
+		}
+	}
+
+	return newMapping, result
+}
+
+func writeImport(ctx context.Context, source ds.WritableDataSource, diff state.MappingDiff) error {
+	if transactional, ok := source.(ds.TransactionalDataSource); ok {
+		return transactional.Transaction(ctx, func(tx ds.Tx) error {
+			for key, target := range diff.Added {
+				tx.Put(key, target)
+			}
+			for key, change := range diff.Changed {
+				tx.Put(key, change.New)
+			}
+			for key := range diff.Removed {
+				tx.Delete(key)
+			}
+			return nil
+		})
+	}
+
+	if batch, ok := source.(ds.BatchDataSource); ok {
+		puts := make(map[string]string, len(diff.Added)+len(diff.Changed))
+		maps.Copy(puts, diff.Added)
+		for key, change := range diff.Changed {
+			puts[key] = change.New
+		}
+		if err := batch.WriteBatch(ctx, puts, slices.Collect(maps.Keys(diff.Removed))); err != nil {
+			return fmt.Errorf("%w: %w", ErrPartialImport, err)
+		}
+		return nil
+	}
+
+	total := len(diff.Added) + len(diff.Changed) + len(diff.Removed)
+	written := 0
+	partialErr := func(err error) error {
+		if written == 0 {
+			return err
+		}
+		return fmt.Errorf("%w (%d of %d changes written): %w", ErrPartialImport, written, total, err)
+	}
+
+	for key, target := range diff.Added {
+		if err := source.CreateEntry(ctx, key, target); err != nil {
+			return partialErr(err)
+		}
+		written++
+	}
+	for key, change := range diff.Changed {
+		if err := source.UpdateEntry(ctx, key, change.New); err != nil {
+			return partialErr(err)
+		}
+		written++
+	}
+	for key := range diff.Removed {
+		if err := source.DeleteEntry(ctx, key); err != nil {
+			return partialErr(err)
+		}
+		written++
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package repo
+
+import (
+	"errors"
+	"maps"
+	"strings"
+	"testing"
+
+	"github.com/fanonwue/go-short-link/internal/conf"
+	"github.com/fanonwue/go-short-link/internal/state"
+	"github.com/fanonwue/go-short-link/internal/transfer"
+)
+
+func TestImportLinksGuard(t *testing.T) {
+	useTestStore(t, state.RedirectMap{
+		"docs": "https://docs.example.org",
+		"gh":   "https://github.com",
+		"blog": "https://blog.example.org",
+	})
+	previous := conf.Config().UpdateGuardMaxRemoved
+	conf.Config().UpdateGuardMaxRemoved = 1
+	t.Cleanup(func() { conf.Config().UpdateGuardMaxRemoved = previous })
+
+	for _, mode := range []ImportMode{ImportMerge, ImportReplace} {
+		if _, err := ImportLinks(t.Context(), nil, mode, false, true); !errors.Is(err, ErrEmptyImport) {
+			t.Errorf("%s: expected empty import to be rejected, got %v", mode, err)
+		}
+	}
+
+	entries := []transfer.Entry{{Key: "docs", Target: "https://docs.example.org/v2"}}
+	for _, dryRun := range []bool{true, false} {
+		if _, err := ImportLinks(t.Context(), entries, ImportReplace, dryRun, false); !errors.Is(err, ErrImportGuarded) {
+			t.Errorf("dry run %v: expected unconfirmed import to be refused, got %v", dryRun, err)
+		}
+	}
+	if len(RedirectState().CurrentMapping()) != 3 {
+		t.Fatal("expected refused import not to change the mapping")
+	}
+
+	if _, err := ImportLinks(t.Context(), entries, ImportMerge, false, false); err != nil {
+		t.Errorf("expected merge import to pass the guard, got %v", err)
+	}
+	result, err := ImportLinks(t.Context(), entries, ImportReplace, false, true)
+	if err != nil || len(result.Removed) != 2 {
+		t.Fatalf("expected confirmed import to remove 2 keys, got %v (%v)", result.Removed, err)
+	}
+	if mapping := RedirectState().CurrentMapping(); len(mapping) != 1 {
+		t.Errorf("expected only the imported entry to remain, got %v", mapping)
+	}
+}
+
+func TestImportLinksAliases(t *testing.T) {
+	useTestStore(t, state.RedirectMap{})
+	entries, _, err := transfer.DecodeReport(strings.NewReader("Bitlink,Long_URL,Custom Bitlinks\n"+
+		"https://bit.ly/3AbCdEf,https://example.org/page,https://bit.ly/my-page\n"), transfer.FormatBitly)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := ImportLinks(t.Context(), entries, ImportMerge, false, false)
+	if err != nil || len(result.Rejected) > 0 {
+		t.Fatalf("expected the import to succeed, got %v (%v)", result.Rejected, err)
+	}
+	expected := state.RedirectMap{"3abcdef": "https://example.org/page", "my-page": "3abcdef"}
+	if mapping := RedirectState().CurrentMapping(); !maps.Equal(mapping, expected) {
+		t.Errorf("expected %v, got %v", expected, mapping)
+	}
+}
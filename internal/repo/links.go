@@ -0,0 +1,248 @@
+package repo
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/fanonwue/go-short-link/internal/conf"
+	"github.com/fanonwue/go-short-link/internal/ds"
+	"github.com/fanonwue/go-short-link/internal/policy"
+	"github.com/fanonwue/go-short-link/internal/reqlog"
+	"github.com/fanonwue/go-short-link/internal/state"
+)
+
+type (
+	// Link is a single entry of the active mapping, together with its entity tag used for optimistic concurrency.
+	Link struct {
+		Key    string `json:"key"`
+		Target string `json:"target"`
+		ETag   string `json:"etag"`
+	}
+)
+
+const (
+	// linksSource is recorded as source in the mapping history for changes made using the links API
+	linksSource = "links-api"
+	// RootKey is the key of the entry used for requests to the root path, if root redirects are allowed
+	RootKey = "__root"
+)
+
+var (
+	ErrReadOnly           = errors.New("the data source is read-only, links have to be changed in the data source itself")
+	ErrPreconditionFailed = errors.New("the link has been modified in the meantime")
+	ErrInvalidKey         = errors.New("invalid key")
+	ErrLinkReferenced     = errors.New("the link is the target of an alias")
+)
+
+func newLink(key string, target string) Link {
+	hash := sha256.Sum256([]byte(key + "\x00" + target))
+	return Link{
+		Key:    key,
+		Target: target,
+		ETag:   "\"" + hex.EncodeToString(hash[:conf.EtagLength]) + "\"",
+	}
+}
+
+// IsWritable reports whether the active data source supports changing links.
+func IsWritable() bool {
+	source, ok := DataSource().(ds.WritableDataSource)
+	return ok && source.Writable()
+}
+
+// Links returns all entries of the active mapping, sorted by key.
+func Links() []Link {
+	mapping := RedirectState().CurrentMapping()
+	links := make([]Link, 0, len(mapping))
+	for key, target := range mapping {
+		links = append(links, newLink(key, target))
+	}
+	slices.SortFunc(links, func(a, b Link) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+	return links
+}
+
+// GetLink returns the entry for the given (normalized) key.
+func GetLink(key string) (Link, bool) {
+	target, found := RedirectState().GetTarget(key)
+	if !found {
+		return Link{}, false
+	}
+	return newLink(key, target), true
+}
+
+// NormalizeKey applies the same normalization to key that is applied to all keys fetched from the data source,
+// e.g. stripping slashes or converting it to lowercase.
+func NormalizeKey(key string) (string, error) {
+	for _, r := range key {
+		if unicode.IsSpace(r) || unicode.IsControl(r) {
+			return "", fmt.Errorf("%w: must not contain whitespace", ErrInvalidKey)
+		}
+	}
+
+	normalized, err := applyHooks(state.RedirectMap{key: ""}, state.NewMappingReport(linksSource))
+	if err != nil {
+		return "", err
+	}
+	for normalizedKey := range normalized {
+		if len(normalizedKey) > 0 {
+			return normalizedKey, nil
+		}
+	}
+	return "", fmt.Errorf("%w: must not be empty", ErrInvalidKey)
+}
+
+// CreateLink adds a new entry to the data source and the active mapping.
+func CreateLink(ctx context.Context, key string, target string) (Link, error) {
+	err := modifyLinks(ctx, linksSource, func(source ds.WritableDataSource, mapping state.RedirectMap) error {
+		if _, found := mapping[key]; found {
+			return fmt.Errorf("%w: %s", ds.ErrEntryExists, key)
+		}
+		if err := validateTarget(key, target, mapping); err != nil {
+			return err
+		}
+		if err := source.CreateEntry(ctx, key, target); err != nil {
+			return err
+		}
+		mapping[key] = target
+		return nil
+	})
+	if err != nil {
+		return Link{}, err
+	}
+	reqlog.FromContext(ctx).Infof("Created link '%s' to %s", key, target)
+	return newLink(key, target), nil
+}
+
+// UpdateLink changes the target of an existing entry. If ifMatch is not empty, it has to match the current
+// entity tag of the entry (or be "*"), otherwise [ErrPreconditionFailed] is returned.
+func UpdateLink(ctx context.Context, key string, target string, ifMatch string) (Link, error) {
+	err := modifyLinks(ctx, linksSource, func(source ds.WritableDataSource, mapping state.RedirectMap) error {
+		if err := checkPrecondition(mapping, key, ifMatch); err != nil {
+			return err
+		}
+		if err := validateTarget(key, target, mapping); err != nil {
+			return err
+		}
+		if err := source.UpdateEntry(ctx, key, target); err != nil {
+			return err
+		}
+		mapping[key] = target
+		return nil
+	})
+	if err != nil {
+		return Link{}, err
+	}
+	reqlog.FromContext(ctx).Infof("Updated link '%s' to %s", key, target)
+	return newLink(key, target), nil
+}
+
+// DeleteLink removes an entry. The precondition is handled like in [UpdateLink].
+func DeleteLink(ctx context.Context, key string, ifMatch string) error {
+	err := modifyLinks(ctx, linksSource, func(source ds.WritableDataSource, mapping state.RedirectMap) error {
+		if err := checkPrecondition(mapping, key, ifMatch); err != nil {
+			return err
+		}
+		// Deleting the target of an alias would silently break the alias
+		for aliasKey, target := range mapping {
+			if target == key {
+				return fmt.Errorf("%w '%s'", ErrLinkReferenced, aliasKey)
+			}
+		}
+		if err := source.DeleteEntry(ctx, key); err != nil {
+			return err
+		}
+		delete(mapping, key)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	reqlog.FromContext(ctx).Infof("Deleted link '%s'", key)
+	return nil
+}
+
+// modifyLinks writes a change to the data source using modify, which also applies the change to the supplied copy
+// of the active mapping. If modify succeeds, the copy becomes the active mapping immediately, without waiting
+// for the next update. The change is recorded in the history using source.
+func modifyLinks(ctx context.Context, source string, modify func(source ds.WritableDataSource, mapping state.RedirectMap) error) error {
+	writable, ok := DataSource().(ds.WritableDataSource)
+	if !ok || !writable.Writable() {
+		return ErrReadOnly
+	}
+
+	// Holding the lock keeps the precondition check and the write together, and prevents an update from the data
+	// source or a rollback from replacing the mapping in the meantime
+	mappingMutex.Lock()
+	defer mappingMutex.Unlock()
+	if pinned := PinnedVersion(); pinned != 0 {
+		return fmt.Errorf("%w: version %d", ErrMappingPinned, pinned)
+	}
+
+	mapping := RedirectState().CurrentMapping()
+	if err := modify(writable, mapping); err != nil {
+		return err
+	}
+
+	RedirectState().UpdateMapping(mapping)
+	if conf.Config().UseFallbackFile() {
+		_ = writeFallbackFileLog(conf.Config().FallbackFile, mapping)
+	}
+	MappingHistory().Add(source, mapping)
+	saveHistoryLog()
+	return nil
+}
+
+func checkPrecondition(mapping state.RedirectMap, key string, ifMatch string) error {
+	target, found := mapping[key]
+	if !found {
+		return fmt.Errorf("%w: %s", ds.ErrEntryNotFound, key)
+	}
+	if len(ifMatch) == 0 {
+		return nil
+	}
+
+	current := newLink(key, target).ETag
+	for _, tag := range strings.Split(ifMatch, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == current {
+			return nil
+		}
+	}
+	return ErrPreconditionFailed
+}
+
+// validateTarget applies the target policy. Aliases have to refer to an existing entry that is not an alias itself.
+func validateTarget(key string, target string, mapping state.RedirectMap) error {
+	if len(target) == 0 {
+		return fmt.Errorf("%w: must not be empty", policy.ErrInvalidTarget)
+	}
+	if !policy.IsAlias(target) {
+		return policy.FromConfig().Check(target)
+	}
+
+	aliasTarget, found := mapping[target]
+	if !found || target == key {
+		return fmt.Errorf("%w: alias of unknown key '%s'", policy.ErrInvalidTarget, target)
+	}
+	if policy.IsAlias(aliasTarget) {
+		return fmt.Errorf("%w: alias of another alias '%s'", policy.ErrInvalidTarget, target)
+	}
+	return nil
+}
+
+// normalizeSourceKey normalizes a key read by a writable data source. Invalid keys are normalized to an empty string,
+// as they never match an entry of the mapping.
+func normalizeSourceKey(key string) string {
+	normalized, err := NormalizeKey(key)
+	if err != nil {
+		return ""
+	}
+	return normalized
+}
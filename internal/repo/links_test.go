@@ -0,0 +1,155 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/fanonwue/go-short-link/internal/ds"
+	"github.com/fanonwue/go-short-link/internal/policy"
+	"github.com/fanonwue/go-short-link/internal/state"
+)
+
+var addTestHooks = sync.OnceFunc(func() {
+	RedirectState().AddHook(func(mapping state.RedirectMap, report *state.MappingReport) (state.RedirectMap, error) {
+		return state.RenameKeys(mapping, report, "normalizing", func(key string) string {
+			return strings.ToLower(strings.Trim(key, "/"))
+		}), nil
+	})
+})
+
+// useTestStore replaces the data source with an empty store and makes mapping the active mapping.
+func useTestStore(t *testing.T, mapping state.RedirectMap) *ds.StoreDataSource {
+	addTestHooks()
+	// The store is closed once the test context is cancelled
+	store, err := ds.CreateStoreDataSource(t.Context(), filepath.Join(t.TempDir(), "store"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Transaction(t.Context(), func(tx ds.Tx) error {
+		for key, target := range mapping {
+			tx.Put(key, target)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	UseDataSource(store)
+	RedirectState().UpdateMapping(mapping)
+	return store
+}
+
+func TestNormalizeKey(t *testing.T) {
+	addTestHooks()
+	valid := map[string]string{
+		"docs":       "docs",
+		"/Docs/":     "docs",
+		"team/Wiki/": "team/wiki",
+	}
+	for key, expected := range valid {
+		if normalized, err := NormalizeKey(key); err != nil || normalized != expected {
+			t.Errorf("%q: expected %q, got %q (%v)", key, expected, normalized, err)
+		}
+	}
+	for _, key := range []string{"", "/", "with space", "tab\tkey", "line\nbreak"} {
+		if _, err := NormalizeKey(key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("%q: expected key to be rejected, got %v", key, err)
+		}
+	}
+}
+
+func TestUpdateLinkPrecondition(t *testing.T) {
+	store := useTestStore(t, state.RedirectMap{"docs": "https://docs.example.org"})
+	current, _ := GetLink("docs")
+
+	for _, ifMatch := range []string{`"0000"`, `W/"0000", "1111"`} {
+		if _, err := UpdateLink(t.Context(), "docs", "https://new.example.org", ifMatch); !errors.Is(err, ErrPreconditionFailed) {
+			t.Errorf("%s: expected precondition to fail, got %v", ifMatch, err)
+		}
+	}
+	if _, err := UpdateLink(t.Context(), "unknown", "https://new.example.org", ""); !errors.Is(err, ds.ErrEntryNotFound) {
+		t.Errorf("expected unknown link to be rejected, got %v", err)
+	}
+
+	ifMatchHeaders := []func(etag string) string{
+		func(etag string) string { return etag },
+		func(etag string) string { return `"0000", W/` + etag },
+		func(string) string { return "*" },
+		func(string) string { return "" },
+	}
+	for i, header := range ifMatchHeaders {
+		ifMatch := header(current.ETag)
+		link, err := UpdateLink(t.Context(), "docs", fmt.Sprintf("https://new.example.org/%d", i), ifMatch)
+		if err != nil {
+			t.Fatalf("%s: expected update to succeed, got %v", ifMatch, err)
+		}
+		current = link
+		if target, _ := RedirectState().GetTarget("docs"); target != link.Target {
+			t.Errorf("expected the active mapping to contain the new target, got %s", target)
+		}
+	}
+
+	stored, err := store.FetchRedirectMapping(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target, _ := RedirectState().GetTarget("docs"); stored["docs"] != target {
+		t.Errorf("expected the store to contain %s, got %s", target, stored["docs"])
+	}
+}
+
+func TestLinkAliases(t *testing.T) {
+	useTestStore(t, state.RedirectMap{"docs": "https://docs.example.org"})
+
+	if _, err := CreateLink(t.Context(), "d", "docs"); err != nil {
+		t.Fatalf("expected alias of an existing link to be created, got %v", err)
+	}
+	invalid := map[string]string{
+		"unknown": "missing",
+		"self":    "self",
+		"chained": "d",
+		"empty":   "",
+	}
+	for key, target := range invalid {
+		if _, err := CreateLink(t.Context(), key, target); !errors.Is(err, policy.ErrInvalidTarget) {
+			t.Errorf("%s -> %q: expected alias to be rejected, got %v", key, target, err)
+		}
+	}
+	if _, err := CreateLink(t.Context(), "docs", "https://other.example.org"); !errors.Is(err, ds.ErrEntryExists) {
+		t.Errorf("expected existing key to be rejected, got %v", err)
+	}
+
+	if err := DeleteLink(t.Context(), "docs", ""); !errors.Is(err, ErrLinkReferenced) {
+		t.Errorf("expected deleting the target of an alias to be rejected, got %v", err)
+	}
+	if err := DeleteLink(t.Context(), "d", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteLink(t.Context(), "docs", ""); err != nil {
+		t.Errorf("expected link to be deleted once the alias is gone, got %v", err)
+	}
+	if mapping := RedirectState().CurrentMapping(); len(mapping) != 0 {
+		t.Errorf("expected all links to be deleted, got %v", mapping)
+	}
+}
+
+func TestModifyLinksRejected(t *testing.T) {
+	useTestStore(t, state.RedirectMap{"docs": "https://docs.example.org"})
+	setPinnedVersion(1)
+	t.Cleanup(func() { setPinnedVersion(0) })
+	if _, err := CreateLink(t.Context(), "new", "https://new.example.org"); !errors.Is(err, ErrMappingPinned) {
+		t.Errorf("expected change of a pinned mapping to be rejected, got %v", err)
+	}
+
+	UseDataSource(ds.CreateCsvDataSource(filepath.Join(t.TempDir(), "links.csv"), false))
+	if IsWritable() {
+		t.Error("expected CSV data source not to be writable")
+	}
+	if _, err := CreateLink(t.Context(), "new", "https://new.example.org"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("expected change of a read-only data source to be rejected, got %v", err)
+	}
+}
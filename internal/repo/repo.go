@@ -3,14 +3,24 @@ package repo
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 
 	"github.com/fanonwue/go-short-link/internal/conf"
 	"github.com/fanonwue/go-short-link/internal/ds"
+	"github.com/fanonwue/go-short-link/internal/metrics"
+	"github.com/fanonwue/go-short-link/internal/policy"
+	"github.com/fanonwue/go-short-link/internal/reqlog"
 	"github.com/fanonwue/go-short-link/internal/state"
+	"github.com/fanonwue/go-short-link/internal/tracing"
 	"github.com/fanonwue/goutils/logging"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	"os"
 	"path/filepath"
+	"sync"
+	"time"
 )
 
 type (
@@ -18,17 +28,100 @@ type (
 		Key    string `json:"key"`
 		Target string `json:"target"`
 	}
+
+	// validationStage checks the entries of a new mapping before it gets applied. Entries failing the validation
+	// are removed from the mapping and recorded in the report.
+	validationStage func(context.Context, state.RedirectMap, *state.MappingReport) state.RedirectMap
+)
+
+const (
+	fallbackSource         = "fallback-file"
+	dataSourceGoogleSheets = "google-sheets"
+	dataSourceStore        = "store"
 )
 
 var (
-	dataSource    ds.RedirectDataSource
-	redirectState = state.NewState()
+	dataSource       ds.RedirectDataSource
+	redirectState    = state.NewState()
+	validationStages = []validationStage{applyTargetPolicy}
+	// mappingMutex serializes all changes of the active mapping: updates from the data source, changes made using
+	// the links API, rollbacks and approvals of held back updates
+	mappingMutex sync.Mutex
 )
 
 func Setup(ctx context.Context) {
-	dataSource = ds.CreateSheetsDataSource(ctx)
+	UseDataSource(createDataSource(ctx))
 	RedirectState().ListenForUpdates()
 	RedirectState().ListenForUpdateErrors()
+	setupHistory()
+	restorePinnedMapping(ctx)
+	setupMetrics()
+}
+
+// UseDataSource sets the data source the mapping is fetched from and links are written to.
+func UseDataSource(source ds.RedirectDataSource) {
+	if writable, ok := source.(ds.WritableDataSource); ok {
+		writable.SetKeyNormalizer(normalizeSourceKey)
+	}
+	dataSource = source
+}
+
+// createDataSource creates the data source configured using APP_DATA_SOURCE.
+func createDataSource(ctx context.Context) ds.RedirectDataSource {
+	switch conf.Config().DataSource {
+	case "", dataSourceGoogleSheets:
+		return ds.CreateSheetsDataSource(ctx)
+	case dataSourceStore:
+		store, err := ds.CreateStoreDataSource(ctx, conf.Config().StoreFile)
+		if err != nil {
+			logging.Panicf("Could not create store data source: %v", err)
+		}
+		importFallbackFile(ctx, store)
+		return store
+	}
+	logging.Panicf("Invalid DATA_SOURCE '%s', must be one of [%s, %s]", conf.Config().DataSource, dataSourceGoogleSheets, dataSourceStore)
+	return nil
+}
+
+// importFallbackFile seeds an empty store with the entries of the fallback file, which allows migrating
+// from another data source by keeping its fallback file.
+func importFallbackFile(ctx context.Context, store *ds.StoreDataSource) {
+	path := conf.Config().FallbackFile
+	if store.Len() > 0 || !conf.Config().UseFallbackFile() {
+		return
+	}
+	if _, err := os.Stat(path); err != nil {
+		return
+	}
+
+	mapping, err := readFallbackFile(path)
+	if err != nil {
+		logging.Warnf("Could not import fallback file %s into store: %v", path, err)
+		return
+	}
+	err = store.Transaction(ctx, func(tx ds.Tx) error {
+		for key, target := range mapping {
+			tx.Put(key, target)
+		}
+		return nil
+	})
+	if err != nil {
+		logging.Warnf("Could not import fallback file %s into store: %v", path, err)
+		return
+	}
+	logging.Infof("Imported %d entries from fallback file %s into store", len(mapping), path)
+}
+
+func setupMetrics() {
+	metrics.NewGaugeFunc("gsl_mapping_size", "Number of entries in the currently active mapping.", func() float64 {
+		return float64(RedirectState().MappingSize())
+	})
+	metrics.NewGaugeFunc("gsl_mapping_pending_update", "Whether an update is being held back until approved (1) or not (0).", func() float64 {
+		if HasPendingUpdate() {
+			return 1
+		}
+		return 0
+	})
 }
 
 func DataSource() ds.RedirectDataSource {
@@ -42,48 +135,136 @@ func RedirectState() *state.RedirectMapState {
 	return &redirectState
 }
 
-func UpdateRedirectMappingDefault(force bool) (state.RedirectMap, error) {
-	return UpdateRedirectMapping(nil, force)
+func UpdateRedirectMappingDefault(ctx context.Context, force bool) (state.RedirectMap, error) {
+	return UpdateRedirectMapping(ctx, nil, force)
 }
-func UpdateRedirectMapping(target chan<- state.RedirectMap, force bool) (state.RedirectMap, error) {
-	if !force && !DataSource().NeedsUpdate() && RedirectState().LastError() == nil {
-		logging.Debugf("File has not changed since last update, skipping update")
-		return nil, nil
+
+// UpdateRedirectMapping fetches the mapping from the data source, validates it and publishes it to the target
+// channel (or the redirect state if target is nil). The context is only used to propagate the trace of the caller.
+func UpdateRedirectMapping(ctx context.Context, target chan<- state.RedirectMap, force bool) (state.RedirectMap, error) {
+	ctx, span := tracing.Start(ctx, "repo.UpdateRedirectMapping", attribute.Bool("mapping.force", force))
+	startTime := time.Now()
+	newMap, err := updateRedirectMapping(ctx, target, force)
+	// Skipped updates (no changes or pinned) are not recorded, as nothing has been fetched
+	if (newMap == nil && err == nil) || errors.Is(err, ErrMappingPinned) {
+		span.SetAttributes(attribute.Bool("mapping.skipped", true))
+		span.End()
+		return newMap, err
+	}
+
+	result := metrics.Result(err)
+	if errors.Is(err, ErrUpdateHeld) {
+		result = metrics.ResultHeld
+	}
+	span.SetAttributes(attribute.String("mapping.result", result), attribute.Int("mapping.size", len(newMap)))
+	// A held back update is not an error of the update itself
+	if result == metrics.ResultHeld {
+		span.End()
+	} else {
+		tracing.End(span, err)
 	}
+	metrics.MappingUpdates.Inc(result)
+	metrics.MappingUpdateDuration.ObserveDuration(time.Since(startTime), result)
+	return newMap, err
+}
 
-	if target == nil {
-		target = RedirectState().MappingChannel()
+func updateRedirectMapping(ctx context.Context, target chan<- state.RedirectMap, force bool) (state.RedirectMap, error) {
+	log := reqlog.FromContext(ctx)
+	mappingMutex.Lock()
+	defer mappingMutex.Unlock()
+	if pinned := PinnedVersion(); pinned != 0 {
+		log.Debugf("Mapping is pinned to version %d, skipping update", pinned)
+		return nil, fmt.Errorf("%w: version %d", ErrMappingPinned, pinned)
 	}
 
-	fetchedMapping, fetchErr := DataSource().FetchRedirectMapping()
+	if !force && !DataSource().NeedsUpdate(ctx) && RedirectState().LastError() == nil {
+		log.Debugf("File has not changed since last update, skipping update")
+		return nil, nil
+	}
+
+	fetchedMapping, report, fetchErr := fetchRedirectMapping(ctx)
 	if fetchErr != nil {
-		logging.Warnf("Error fetching new redirect mapping: %s", fetchErr)
+		log.Warnf("Error fetching new redirect mapping: %s", fetchErr)
 		if conf.Config().UseFallbackFile() {
 			fallbackMap, err := readFallbackFileLog(conf.Config().FallbackFile)
 			if err != nil {
 				return nil, err
 			}
 			fetchedMapping = fallbackMap
-			logging.Infof("Read from fallback file")
+			report = newMappingReport(fallbackSource)
+			trace.SpanFromContext(ctx).AddEvent("read fallback file")
+			log.Infof("Read from fallback file")
 		} else {
-			logging.Warnf("Fallback file disabled")
+			log.Warnf("Fallback file disabled")
 			return nil, fetchErr
 		}
 	}
 
-	applyHooks(fetchedMapping)
+	fetchedMapping, hookErr := applyHooks(fetchedMapping, report)
+	if hookErr != nil {
+		log.Errorf("Error applying hooks to new redirect mapping: %v", hookErr)
+		return nil, hookErr
+	}
+	fetchedMapping = applyValidationStages(ctx, fetchedMapping, report)
+	report.Sort()
+
+	if err := checkMassChange(ctx, fetchedMapping, report); err != nil {
+		return nil, err
+	}
+
+	applyMapping(ctx, fetchedMapping, report, target)
+	return fetchedMapping, nil
+}
+
+// applyMapping publishes the mapping and records it in the mapping history.
+func applyMapping(ctx context.Context, newMap state.RedirectMap, report *state.MappingReport, target chan<- state.RedirectMap) {
+	publishMapping(ctx, newMap, report, target)
+	MappingHistory().Add(report.Source, newMap)
+	saveHistoryLog()
+}
 
+// publishMapping publishes the mapping to the target channel (or the redirect state if target is nil)
+// and persists it to the fallback file.
+func publishMapping(ctx context.Context, newMap state.RedirectMap, report *state.MappingReport, target chan<- state.RedirectMap) {
 	if conf.Config().UseFallbackFile() {
-		_ = writeFallbackFileLog(conf.Config().FallbackFile, fetchedMapping)
+		_ = writeFallbackFileLog(conf.Config().FallbackFile, newMap)
 	}
 
-	target <- fetchedMapping
+	RedirectState().UpdateReport(report)
+	if target != nil {
+		target <- newMap
+		return
+	}
+	// The mapping is applied directly instead of using the mapping channel, so it is active before mappingMutex is
+	// released and cannot overwrite a change made right after the update
+	RedirectState().UpdateMapping(newMap)
+	reqlog.FromContext(ctx).Infof("Updated redirect mapping, number of entries: %d", len(newMap))
+}
 
-	return fetchedMapping, nil
+// fetchRedirectMapping fetches the mapping from the data source. If the data source is not able to create
+// a report by itself, an empty report will be returned instead.
+func fetchRedirectMapping(ctx context.Context) (state.RedirectMap, *state.MappingReport, error) {
+	report := newMappingReport(DataSource().Id())
+	if reportingSource, ok := DataSource().(ds.ReportingDataSource); ok {
+		mapping, err := reportingSource.FetchRedirectMappingReport(ctx, report)
+		return mapping, report, err
+	}
+	mapping, err := DataSource().FetchRedirectMapping(ctx)
+	return mapping, report, err
 }
 
-func UpdateRedirectMappingChannels(target chan<- state.RedirectMap, lastError chan<- error, force bool) {
-	_, fetchErr := UpdateRedirectMapping(target, force)
+func newMappingReport(source string) *state.MappingReport {
+	report := state.NewMappingReport(source)
+	report.Strategy = conf.Config().KeyCollisionStrategy
+	return report
+}
+
+func UpdateRedirectMappingChannels(ctx context.Context, target chan<- state.RedirectMap, lastError chan<- error, force bool) {
+	_, fetchErr := UpdateRedirectMapping(ctx, target, force)
+	// Neither a held back update nor a pinned mapping are errors, the service keeps serving the current mapping
+	if errors.Is(fetchErr, ErrUpdateHeld) || errors.Is(fetchErr, ErrMappingPinned) {
+		fetchErr = nil
+	}
 
 	if lastError == nil {
 		lastError = RedirectState().ErrorChannel()
@@ -92,13 +273,47 @@ func UpdateRedirectMappingChannels(target chan<- state.RedirectMap, lastError ch
 	lastError <- fetchErr
 }
 
-func applyHooks(newMap state.RedirectMap) state.RedirectMap {
+func applyHooks(newMap state.RedirectMap, report *state.MappingReport) (state.RedirectMap, error) {
 	for _, hook := range RedirectState().Hooks() {
-		newMap = hook(newMap)
+		var err error
+		newMap, err = hook(newMap, report)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return newMap, nil
+}
+
+func applyValidationStages(ctx context.Context, newMap state.RedirectMap, report *state.MappingReport) state.RedirectMap {
+	for _, stage := range validationStages {
+		newMap = stage(ctx, newMap, report)
 	}
 	return newMap
 }
 
+// applyTargetPolicy removes all entries whose target violates the configured [policy.TargetPolicy].
+// Rejected entries are recorded in the report, so they can be inspected using the status API.
+func applyTargetPolicy(ctx context.Context, newMap state.RedirectMap, report *state.MappingReport) state.RedirectMap {
+	targetPolicy := policy.FromConfig()
+	rejectedCount := 0
+
+	for key, target := range newMap {
+		err := targetPolicy.Check(target)
+		if err == nil {
+			continue
+		}
+		delete(newMap, key)
+		report.Reject(key, target, err.Error())
+		rejectedCount++
+	}
+
+	if rejectedCount > 0 {
+		reqlog.FromContext(ctx).Warnf("Rejected %d redirect entries due to the target policy", rejectedCount)
+	}
+
+	return newMap
+}
+
 func writeFallbackFile(path string, newMapping state.RedirectMap) error {
 	if len(path) == 0 {
 		logging.Debugf("Fallback file path is empty, skipping write")
@@ -168,6 +383,7 @@ func readFallbackFile(path string) (state.RedirectMap, error) {
 func readFallbackFileLog(path string) (state.RedirectMap, error) {
 	logging.Infof("Reading fallback file")
 	fallbackMap, fallbackErr := readFallbackFile(path)
+	metrics.FallbackReads.Inc(metrics.Result(fallbackErr))
 	if fallbackErr != nil {
 		logging.Warnf("Could not read fallback file %s: %v", conf.Config().FallbackFile, fallbackErr)
 	}
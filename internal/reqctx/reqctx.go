@@ -0,0 +1,104 @@
+package reqctx
+
+import (
+	"context"
+	"sync"
+)
+
+type (
+	// MatchType describes how a request has been resolved to a mapping entry.
+	MatchType string
+
+	// Info carries information about a request that is determined by the handlers, but needed by middlewares
+	// wrapping them, like the access log. It is safe for concurrent use, since handlers may run in a separate
+	// goroutine when a timeout is applied.
+	Info struct {
+		key       string
+		target    string
+		matchType MatchType
+		user      string
+		mutex     sync.RWMutex
+	}
+
+	contextKey struct{}
+
+	requestIdKey struct{}
+)
+
+const (
+	// MatchNone means the request could not be resolved to a mapping entry
+	MatchNone MatchType = ""
+	// MatchPath means the key has been taken from the request path
+	MatchPath MatchType = "path"
+	// MatchHost means the key has been taken from the host name of the request
+	MatchHost MatchType = "host"
+	// MatchAlias means the key resolved to a domain alias, which in turn resolved to the target
+	MatchAlias MatchType = "alias"
+	// MatchRoot means the special root redirect has been used
+	MatchRoot MatchType = "root"
+)
+
+// WithInfo returns a copy of ctx carrying a new, empty Info.
+func WithInfo(ctx context.Context) (context.Context, *Info) {
+	info := &Info{}
+	return context.WithValue(ctx, contextKey{}, info), info
+}
+
+// FromContext returns the Info carried by ctx, or nil if there is none. All methods of Info may be called on nil.
+func FromContext(ctx context.Context) *Info {
+	info, _ := ctx.Value(contextKey{}).(*Info)
+	return info
+}
+
+// WithRequestId returns a copy of ctx carrying the given request ID.
+func WithRequestId(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIdKey{}, id)
+}
+
+// RequestId returns the request ID carried by ctx, or an empty string if there is none.
+func RequestId(ctx context.Context) string {
+	id, _ := ctx.Value(requestIdKey{}).(string)
+	return id
+}
+
+// SetMatch records the mapping entry the request has been resolved to.
+func (i *Info) SetMatch(key string, target string, matchType MatchType) {
+	if i == nil {
+		return
+	}
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.key = key
+	i.target = target
+	i.matchType = matchType
+}
+
+// Match returns the mapping entry the request has been resolved to.
+func (i *Info) Match() (key string, target string, matchType MatchType) {
+	if i == nil {
+		return "", "", MatchNone
+	}
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	return i.key, i.target, i.matchType
+}
+
+// SetUser records the name of the authenticated user, if it is not given by the Authorization header itself.
+func (i *Info) SetUser(user string) {
+	if i == nil {
+		return
+	}
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.user = user
+}
+
+// User returns the name recorded by [Info.SetUser].
+func (i *Info) User() string {
+	if i == nil {
+		return ""
+	}
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	return i.user
+}
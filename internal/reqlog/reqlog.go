@@ -0,0 +1,93 @@
+package reqlog
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/fanonwue/go-short-link/internal/reqctx"
+	"github.com/fanonwue/goutils/logging"
+)
+
+// Logger writes log messages prefixed with the ID of the request they have been emitted for. A Logger without
+// request ID (including a nil Logger) behaves exactly like the global logging functions.
+type Logger struct {
+	requestId string
+}
+
+const (
+	// HeaderRequestId is the header carrying the request ID, both in requests and responses
+	HeaderRequestId = "X-Request-ID"
+	// maxRequestIdLength limits the length of request IDs accepted from clients
+	maxRequestIdLength = 128
+	requestIdBytes     = 16
+)
+
+// Middleware assigns an ID to every request and echoes it in the response. An ID sent by the client (or a proxy)
+// using the X-Request-ID header is reused, as long as it is reasonably short and printable.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(HeaderRequestId)
+		if !validRequestId(id) {
+			id = newRequestId()
+		}
+		w.Header().Set(HeaderRequestId, id)
+		next.ServeHTTP(w, r.WithContext(reqctx.WithRequestId(r.Context(), id)))
+	})
+}
+
+// FromContext returns a logger for the request ID carried by ctx.
+func FromContext(ctx context.Context) *Logger {
+	return &Logger{requestId: reqctx.RequestId(ctx)}
+}
+
+// FromRequest returns a logger for the ID of the given request.
+func FromRequest(r *http.Request) *Logger {
+	return FromContext(r.Context())
+}
+
+func (l *Logger) Infof(msg string, args ...any) {
+	l.logf(logging.LevelInfo, msg, args...)
+}
+
+func (l *Logger) Warnf(msg string, args ...any) {
+	l.logf(logging.LevelWarn, msg, args...)
+}
+
+func (l *Logger) Errorf(msg string, args ...any) {
+	l.logf(logging.LevelError, msg, args...)
+}
+
+func (l *Logger) Debugf(msg string, args ...any) {
+	l.logf(logging.LevelDebug, msg, args...)
+}
+
+func (l *Logger) logf(level logging.LogLevel, msg string, args ...any) {
+	// One additional frame compared to the global functions, so the caller of Infof etc. is reported
+	calldepth := logging.DefaultCalldepth + 1
+	if l == nil || len(l.requestId) == 0 {
+		logging.Logf(level, calldepth, msg, args...)
+		return
+	}
+	logging.Logf(level, calldepth, "[%s] "+msg, append([]any{l.requestId}, args...)...)
+}
+
+func validRequestId(id string) bool {
+	if len(id) == 0 || len(id) > maxRequestIdLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		// Printable ASCII without spaces, so the ID can be logged verbatim
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestId() string {
+	buf := make([]byte, requestIdBytes)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,112 @@
+package reqlog
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/fanonwue/go-short-link/internal/reqctx"
+	"github.com/fanonwue/goutils/logging"
+)
+
+func TestValidRequestId(t *testing.T) {
+	tests := []struct {
+		id       string
+		expected bool
+	}{
+		{"0123456789abcdef", true},
+		{"proxy-1:abc/def_~", true},
+		{strings.Repeat("a", maxRequestIdLength), true},
+		{"", false},
+		{strings.Repeat("a", maxRequestIdLength+1), false},
+		{"with space", false},
+		{"line\nbreak", false},
+		{"tab\t", false},
+		{"del\x7f", false},
+		{"ümlaut", false},
+	}
+	for _, test := range tests {
+		if actual := validRequestId(test.id); actual != test.expected {
+			t.Errorf("%q: expected %v, got %v", test.id, test.expected, actual)
+		}
+	}
+}
+
+func TestNewRequestId(t *testing.T) {
+	seen := make(map[string]bool)
+	for range 100 {
+		id := newRequestId()
+		if len(id) != 2*requestIdBytes || !validRequestId(id) {
+			t.Fatalf("generated invalid request ID %q", id)
+		}
+		if seen[id] {
+			t.Fatalf("generated duplicate request ID %q", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var received string
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = reqctx.RequestId(r.Context())
+	}))
+
+	tests := []struct {
+		name     string
+		incoming string
+		reused   bool
+	}{
+		{"without header", "", false},
+		{"valid header", "upstream-1234", true},
+		{"invalid header", "contains spaces", false},
+		{"overlong header", strings.Repeat("x", maxRequestIdLength+1), false},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/docs", nil)
+		if len(test.incoming) > 0 {
+			r.Header.Set(HeaderRequestId, test.incoming)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, r)
+
+		echoed := recorder.Header().Get(HeaderRequestId)
+		if echoed != received || !validRequestId(echoed) {
+			t.Errorf("%s: expected the ID %q passed to the handler to be echoed, got %q", test.name, received, echoed)
+		}
+		if reused := echoed == test.incoming; reused != test.reused {
+			t.Errorf("%s: expected incoming ID to be reused: %v, got ID %q", test.name, test.reused, echoed)
+		}
+	}
+}
+
+func TestLoggerPrefix(t *testing.T) {
+	var output strings.Builder
+	logging.LevelInfo.Logger().SetOutput(&output)
+	t.Cleanup(func() { logging.LevelInfo.Logger().SetOutput(os.Stdout) })
+
+	r := httptest.NewRequest(http.MethodGet, "/docs", nil)
+	FromRequest(r.WithContext(reqctx.WithRequestId(r.Context(), "abc123"))).Infof("hello %s", "world")
+	FromRequest(r).Infof("without id")
+	var nilLogger *Logger
+	nilLogger.Infof("nil logger")
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 log lines, got %q", output.String())
+	}
+	if !strings.HasSuffix(lines[0], "[abc123] hello world") {
+		t.Errorf("expected message to be prefixed with the request ID, got %q", lines[0])
+	}
+	if strings.Contains(lines[1], "[]") || !strings.HasSuffix(lines[1], " without id") {
+		t.Errorf("expected message without request ID to be logged unchanged, got %q", lines[1])
+	}
+	// The caller is reported, not the logger itself
+	for _, line := range lines {
+		if !strings.Contains(line, " reqlog_test.go:") {
+			t.Errorf("expected the test to be reported as caller, got %q", line)
+		}
+	}
+}
@@ -7,14 +7,22 @@ import (
 	"io/fs"
 	"net"
 	"net/http"
+	"os"
 	"slices"
 	"strings"
 	"time"
 
+	"github.com/fanonwue/go-short-link/internal/accesslog"
 	"github.com/fanonwue/go-short-link/internal/api"
+	"github.com/fanonwue/go-short-link/internal/bot"
 	"github.com/fanonwue/go-short-link/internal/conf"
+	"github.com/fanonwue/go-short-link/internal/metrics"
+	"github.com/fanonwue/go-short-link/internal/privacy"
+	"github.com/fanonwue/go-short-link/internal/reqlog"
 	"github.com/fanonwue/go-short-link/internal/srv"
 	"github.com/fanonwue/go-short-link/internal/tmpl"
+	"github.com/fanonwue/go-short-link/internal/tracing"
+	"github.com/fanonwue/go-short-link/internal/util"
 	"github.com/fanonwue/goutils/logging"
 )
 
@@ -24,39 +32,41 @@ const (
 
 var (
 	supportedMethods = []srv.HttpMethod{srv.GET, srv.HEAD, srv.OPTIONS}
+	accessLogger     *accesslog.Logger
 )
 
 type wrappedHandler struct {
 	handler http.HandlerFunc
+	methods []srv.HttpMethod
 }
 
-func supportedMethodsStringSlice() []string {
-	methodsStringSlice := make([]string, len(supportedMethods))
-	for i, method := range supportedMethods {
+func methodsStringSlice(methods []srv.HttpMethod) []string {
+	methodsStringSlice := make([]string, len(methods))
+	for i, method := range methods {
 		methodsStringSlice[i] = string(method)
 	}
 	return methodsStringSlice
 }
 
-func supportedMethodsString() string {
-	return strings.Join(supportedMethodsStringSlice(), ", ")
+func methodsString(methods []srv.HttpMethod) string {
+	return strings.Join(methodsStringSlice(methods), ", ")
 }
 
-func OptionsHandler(w http.ResponseWriter) {
+func OptionsHandler(w http.ResponseWriter, methods []srv.HttpMethod) {
 	h := w.Header()
 	srv.AddDefaultHeadersWithCache(h)
-	h.Set("Allow", supportedMethodsString())
+	h.Set("Allow", methodsString(methods))
 	w.WriteHeader(http.StatusOK)
 }
 
 func (wh wrappedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if srv.HttpMethod(r.Method) == srv.OPTIONS {
-		OptionsHandler(w)
+		OptionsHandler(w, wh.methods)
 		return
 	}
 
-	if !slices.Contains(supportedMethods, srv.HttpMethod(r.Method)) {
-		errMsg := fmt.Sprintf("Method is not supported - only [%s] are allowed", supportedMethodsString())
+	if !slices.Contains(wh.methods, srv.HttpMethod(r.Method)) {
+		errMsg := fmt.Sprintf("Method is not supported - only [%s] are allowed", methodsString(wh.methods))
 		http.Error(w, errMsg, http.StatusMethodNotAllowed)
 		return
 	}
@@ -79,13 +89,26 @@ func checkBasicAuth(w http.ResponseWriter, r *http.Request) bool {
 }
 
 func wrapHandler(handlerFunc func(http.ResponseWriter, *http.Request)) wrappedHandler {
+	return wrapHandlerMethods(handlerFunc, supportedMethods)
+}
+
+// wrapHandlerMethods wraps the handler, only allowing the given methods. OPTIONS requests are always answered.
+func wrapHandlerMethods(handlerFunc func(http.ResponseWriter, *http.Request), methods []srv.HttpMethod) wrappedHandler {
+	if !slices.Contains(methods, srv.OPTIONS) {
+		methods = append(slices.Clone(methods), srv.OPTIONS)
+	}
 	return wrappedHandler{
 		handler: handlerFunc,
+		methods: methods,
 	}
 }
 
 func wrapHandlerTimeout(handlerFunc func(http.ResponseWriter, *http.Request)) http.Handler {
-	return http.TimeoutHandler(wrapHandler(handlerFunc), requestTimeout, "Request timeout exceeded")
+	return timeoutHandler(wrapHandler(handlerFunc))
+}
+
+func timeoutHandler(handler http.Handler) http.Handler {
+	return http.TimeoutHandler(handler, requestTimeout, "Request timeout exceeded")
 }
 
 func addFaviconHandler(iconType conf.FaviconType, mux *http.ServeMux) {
@@ -115,11 +138,12 @@ func defaultHandlerWithAssets(defaultHandler http.HandlerFunc) http.HandlerFunc
 		logging.Infof("Assets are served from local file system: %s", localPath)
 	}
 	return func(w http.ResponseWriter, r *http.Request) {
+		startTime := time.Now()
 		assetFile, err := tmpl.AssetsFS().OpenAssetFile(r.URL.Path)
 		if err != nil {
 			acceptedError := errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission)
 			if !acceptedError {
-				logging.Errorf("Unhandled error while handling asset request: %v", err)
+				reqlog.FromRequest(r).Errorf("Unhandled error while handling asset request: %v", err)
 			}
 
 			defaultHandler(w, r)
@@ -130,9 +154,10 @@ func defaultHandlerWithAssets(defaultHandler http.HandlerFunc) http.HandlerFunc
 		defaultTimestamp, _ := conf.BuildTimestamp()
 		modTime, statErr := assetFile.ModTimeOrDefault(defaultTimestamp)
 		if statErr != nil {
-			logging.Errorf("Could not stat asset file %s: %v", r.URL.Path, statErr)
+			reqlog.FromRequest(r).Errorf("Could not stat asset file %s: %v", r.URL.Path, statErr)
 		}
 		http.ServeContent(w, r, r.URL.Path, modTime, assetFile)
+		metrics.ObserveRequest(metrics.OutcomeAsset, time.Since(startTime).Seconds())
 	}
 }
 
@@ -152,16 +177,22 @@ func CreateHttpServer(ctx context.Context) *http.Server {
 	}
 
 	for _, endpoint := range api.Endpoints() {
-		mux.Handle(endpoint.Pattern, wrapHandlerTimeout(endpoint.Handler))
+		methods := endpoint.Methods
+		if len(methods) == 0 {
+			methods = supportedMethods
+		}
+		mux.Handle(endpoint.Pattern, timeoutHandler(wrapHandlerMethods(endpoint.Handler, methods)))
 	}
 
+	addAdminHandlers(mux)
+
 	for _, wellKnownFile := range wellKnownFiles() {
 		mux.Handle(wellKnownFile, http.StripPrefix(srv.WellKnownPrefix, defaultHandler))
 	}
 
 	httpServer := &http.Server{
 		Addr:         fmt.Sprintf(":%d", conf.Config().Port),
-		Handler:      mux,
+		Handler:      reqlog.Middleware(bot.Middleware(accessLogHandler(tracing.Middleware(mux)))),
 		ReadTimeout:  requestTimeout,
 		WriteTimeout: requestTimeout,
 		IdleTimeout:  requestTimeout * 2,
@@ -173,6 +204,60 @@ func CreateHttpServer(ctx context.Context) *http.Server {
 	return httpServer
 }
 
+// accessLogHandler wraps handler with the access log middleware, if access logging is enabled.
+func accessLogHandler(handler http.Handler) http.Handler {
+	redact := conf.Config().AccessLogRedactFields
+	if err := accesslog.ValidateFields(redact); err != nil {
+		logging.Panicf("Invalid %s: %v", util.PrefixedEnvVar("ACCESS_LOG_REDACT"), err)
+	}
+	format, err := accesslog.ParseFormat(conf.Config().AccessLogFormat)
+	if err != nil {
+		logging.Warnf("Invalid %s, access logging disabled: %v", util.PrefixedEnvVar("ACCESS_LOG"), err)
+	}
+	if format == accesslog.FormatDisabled {
+		return handler
+	}
+
+	if path := conf.Config().AccessLogFile; len(path) > 0 {
+		maxSize := int64(conf.Config().AccessLogMaxSize) * 1024 * 1024
+		logger, err := accesslog.OpenFile(format, path, maxSize, int(conf.Config().AccessLogMaxBackups), redact)
+		if err != nil {
+			logging.Errorf("Could not open access log file %s, falling back to stdout: %v", path, err)
+		} else {
+			accessLogger = logger
+			privacy.RegisterPurger("rotated access logs", logger.PurgeBackups)
+			logging.Infof("Access log enabled, writing %s format to %s", format, path)
+		}
+	}
+	if accessLogger == nil {
+		accessLogger = accesslog.New(format, os.Stdout, redact)
+		logging.Infof("Access log enabled, writing %s format to stdout", format)
+	}
+
+	accessLogger.SetFilter(anonymizeAccessLogEntry)
+	return accessLogger.Middleware(handler)
+}
+
+// anonymizeAccessLogEntry applies the privacy settings to access log entries. For clients that opted out
+// of tracking, the user agent and referer are omitted as well.
+func anonymizeAccessLogEntry(r *http.Request, entry *accesslog.Entry) {
+	entry.RemoteAddr = privacy.Anonymize(entry.RemoteAddr)
+	entry.Bot = string(bot.FromRequest(r).Category)
+	if !privacy.TrackingAllowed(r) {
+		entry.UserAgent = ""
+		entry.Referer = ""
+	}
+}
+
+func closeAccessLog() {
+	if accessLogger == nil {
+		return
+	}
+	if err := accessLogger.Close(); err != nil {
+		logging.Warnf("Error closing access log: %v", err)
+	}
+}
+
 func wellKnownFiles() []string {
 	return []string{srv.WellKnownPrefix + "/security.txt"}
 }
@@ -8,9 +8,9 @@ import (
 	"fmt"
 
 	"github.com/fanonwue/go-short-link/internal/conf"
+	"github.com/fanonwue/go-short-link/internal/reqlog"
 	"github.com/fanonwue/go-short-link/internal/tmpl/minify"
 	"github.com/fanonwue/go-short-link/internal/util"
-	"github.com/fanonwue/goutils/logging"
 
 	"net/http"
 	"strconv"
@@ -73,7 +73,7 @@ func StatusResponse(
 	contentType, body, err := bodyFunc()
 
 	if err != nil {
-		logging.Errorf("Error writing status data to buffer: %v", err)
+		reqlog.FromRequest(r).Errorf("Error writing status data to buffer: %v", err)
 		http.Error(w, "Unknown Error", http.StatusInternalServerError)
 		return err
 	}
@@ -88,7 +88,7 @@ func StatusResponse(
 	if WithBodyRequest(r) {
 		_, err = body.WriteTo(w)
 		if err != nil {
-			logging.Errorf("Error writing status data to response body: %v", err)
+			reqlog.FromRequest(r).Errorf("Error writing status data to response body: %v", err)
 		}
 		return err
 	}
@@ -120,7 +120,7 @@ func StatusResponseTimeMapper(t time.Time) *time.Time {
 	return &t
 }
 
-func HtmlResponse(w http.ResponseWriter, withBody bool, status int, buffer *bytes.Buffer, etagData string) {
+func HtmlResponse(w http.ResponseWriter, r *http.Request, status int, buffer *bytes.Buffer, etagData string) {
 	responseHeader := w.Header()
 
 	AddDefaultHeadersWithCache(responseHeader)
@@ -129,7 +129,7 @@ func HtmlResponse(w http.ResponseWriter, withBody bool, status int, buffer *byte
 		newBuf := util.NewBuffer(buffer.Len())
 		_, err := newBuf.ReadFrom(minify.FromReader(buffer))
 		if err != nil {
-			logging.Errorf("Could not minify response: %v", err)
+			reqlog.FromRequest(r).Errorf("Could not minify response: %v", err)
 		}
 		buffer = newBuf
 	}
@@ -143,10 +143,10 @@ func HtmlResponse(w http.ResponseWriter, withBody bool, status int, buffer *byte
 
 	w.WriteHeader(status)
 
-	if withBody {
+	if WithBodyRequest(r) {
 		_, err := buffer.WriteTo(w)
 		if err != nil {
-			logging.Errorf("Could not write response body: %v", err)
+			reqlog.FromRequest(r).Errorf("Could not write response body: %v", err)
 		}
 	}
 }
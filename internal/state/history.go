@@ -0,0 +1,158 @@
+package state
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+type (
+	// HistoryEntry is a mapping that has been applied at some point in time.
+	HistoryEntry struct {
+		Id        uint64      `json:"id"`
+		AppliedAt time.Time   `json:"appliedAt"`
+		Source    string      `json:"source"`
+		Size      int         `json:"size"`
+		Mapping   RedirectMap `json:"mapping,omitempty"`
+	}
+
+	// History keeps the last applied mappings, up to a fixed capacity. The oldest entries are dropped first.
+	History struct {
+		entries  []HistoryEntry
+		nextId   uint64
+		capacity int
+		mutex    sync.RWMutex
+	}
+
+	TargetChange struct {
+		Old string `json:"old"`
+		New string `json:"new"`
+	}
+
+	// MappingDiff describes the changes necessary to get from one mapping to another.
+	MappingDiff struct {
+		Added   RedirectMap             `json:"added"`
+		Removed RedirectMap             `json:"removed"`
+		Changed map[string]TargetChange `json:"changed"`
+	}
+)
+
+func NewHistory(capacity int) *History {
+	return &History{
+		entries:  make([]HistoryEntry, 0, capacity),
+		nextId:   1,
+		capacity: capacity,
+	}
+}
+
+// Add records a newly applied mapping. The mapping must not be modified afterward.
+func (h *History) Add(source string, mapping RedirectMap) HistoryEntry {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	entry := HistoryEntry{
+		Id:        h.nextId,
+		AppliedAt: time.Now().UTC(),
+		Source:    source,
+		Size:      len(mapping),
+		Mapping:   mapping,
+	}
+	h.nextId++
+
+	if h.capacity <= 0 {
+		return entry
+	}
+
+	if len(h.entries) >= h.capacity {
+		h.entries = slices.Delete(h.entries, 0, len(h.entries)-h.capacity+1)
+	}
+	h.entries = append(h.entries, entry)
+	return entry
+}
+
+// Get returns the entry with the given ID, including its mapping.
+func (h *History) Get(id uint64) (HistoryEntry, bool) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	index := h.indexOf(id)
+	if index < 0 {
+		return HistoryEntry{}, false
+	}
+	return h.entries[index], true
+}
+
+// Previous returns the entry that has been applied right before the entry with the given ID.
+func (h *History) Previous(id uint64) (HistoryEntry, bool) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	index := h.indexOf(id)
+	if index <= 0 {
+		return HistoryEntry{}, false
+	}
+	return h.entries[index-1], true
+}
+
+// Entries returns all entries, oldest first. The mappings are not included.
+func (h *History) Entries() []HistoryEntry {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	entries := make([]HistoryEntry, len(h.entries))
+	for i, entry := range h.entries {
+		entry.Mapping = nil
+		entries[i] = entry
+	}
+	return entries
+}
+
+// Snapshot returns all entries including their mappings, oldest first.
+func (h *History) Snapshot() []HistoryEntry {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return slices.Clone(h.entries)
+}
+
+// Restore replaces the entries of the history, e.g. with entries read from disk.
+func (h *History) Restore(entries []HistoryEntry) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if len(entries) > h.capacity {
+		entries = entries[len(entries)-h.capacity:]
+	}
+	h.entries = slices.Clone(entries)
+	for _, entry := range entries {
+		h.nextId = max(h.nextId, entry.Id+1)
+	}
+}
+
+func (h *History) indexOf(id uint64) int {
+	return slices.IndexFunc(h.entries, func(entry HistoryEntry) bool {
+		return entry.Id == id
+	})
+}
+
+// Diff computes the changes between oldMap and newMap.
+func Diff(oldMap RedirectMap, newMap RedirectMap) MappingDiff {
+	diff := MappingDiff{
+		Added:   RedirectMap{},
+		Removed: RedirectMap{},
+		Changed: map[string]TargetChange{},
+	}
+
+	for key, newTarget := range newMap {
+		oldTarget, found := oldMap[key]
+		if !found {
+			diff.Added[key] = newTarget
+		} else if oldTarget != newTarget {
+			diff.Changed[key] = TargetChange{Old: oldTarget, New: newTarget}
+		}
+	}
+
+	for key, oldTarget := range oldMap {
+		if _, found := newMap[key]; !found {
+			diff.Removed[key] = oldTarget
+		}
+	}
+
+	return diff
+}
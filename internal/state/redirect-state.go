@@ -13,8 +13,17 @@ type (
 	RedirectMap map[string]string
 
 	// RedirectMapHook A function that takes a RedirectMap, processes it and returns a new RedirectMap with
-	// the processed result.
-	RedirectMapHook func(RedirectMap) RedirectMap
+	// the processed result. Warnings and dropped entries should be recorded in the supplied report. Returning
+	// an error aborts the update, keeping the current mapping active.
+	RedirectMapHook func(RedirectMap, *MappingReport) (RedirectMap, error)
+
+	// RejectedEntry describes a mapping entry that has been dropped during an update, together with the reason
+	// why it has been rejected.
+	RejectedEntry struct {
+		Key    string `json:"key"`
+		Target string `json:"target"`
+		Reason string `json:"reason"`
+	}
 
 	RedirectMapState struct {
 		mapping          RedirectMap
@@ -24,6 +33,8 @@ type (
 		lastError        error
 		lastErrorChannel chan error
 		lastErrorMutex   sync.RWMutex
+		report           *MappingReport
+		reportMutex      sync.RWMutex
 	}
 )
 
@@ -53,6 +64,40 @@ func (state *RedirectMapState) UpdateLastError(err error) {
 	state.lastError = err
 }
 
+// Report returns the report created during the last update, or nil if no update has been performed yet.
+func (state *RedirectMapState) Report() *MappingReport {
+	state.reportMutex.RLock()
+	defer state.reportMutex.RUnlock()
+	return state.report
+}
+
+func (state *RedirectMapState) UpdateReport(report *MappingReport) {
+	state.reportMutex.Lock()
+	defer state.reportMutex.Unlock()
+	state.report = report
+}
+
+// Rejected returns the entries that have been rejected by a validation stage during the last update.
+func (state *RedirectMapState) Rejected() []RejectedEntry {
+	report := state.Report()
+	if report == nil {
+		return nil
+	}
+
+	var rejected []RejectedEntry
+	for _, d := range report.Diagnostics {
+		if d.Action != ActionRejected {
+			continue
+		}
+		rejected = append(rejected, RejectedEntry{
+			Key:    d.Key,
+			Target: d.Target,
+			Reason: d.Reason,
+		})
+	}
+	return rejected
+}
+
 func (state *RedirectMapState) UpdateMapping(newMap RedirectMap) {
 	// Synchronize using a mappingMutex to prevent race conditions
 	state.mappingMutex.Lock()
@@ -0,0 +1,207 @@
+package state
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/fanonwue/go-short-link/internal/conf"
+)
+
+type (
+	// DiagnosticAction describes what happened to a row of the data source during an update.
+	DiagnosticAction string
+
+	// Diagnostic describes a single row which has not been applied as-is during an update.
+	Diagnostic struct {
+		// Row is the row number within the data source. It is zero if the row is unknown.
+		Row    int              `json:"row,omitempty"`
+		Key    string           `json:"key,omitempty"`
+		Target string           `json:"target,omitempty"`
+		Action DiagnosticAction `json:"action"`
+		Reason string           `json:"reason"`
+	}
+
+	// MappingReport collects diagnostics while a new mapping passes through the update pipeline.
+	MappingReport struct {
+		Source      string       `json:"source"`
+		CreatedAt   time.Time    `json:"createdAt"`
+		Diagnostics []Diagnostic `json:"diagnostics"`
+		// Strategy is used to resolve collisions between rows using the same key
+		Strategy conf.CollisionStrategy `json:"-"`
+		// rows maps each key of the mapping to the row it originates from
+		rows map[string]int
+	}
+)
+
+const (
+	// ActionSkipped is used for rows which could not be parsed into a mapping entry.
+	ActionSkipped DiagnosticAction = "skipped"
+	// ActionCollision is used for rows which have been dropped because another row uses the same key,
+	// either directly or after the key has been normalized by a hook.
+	ActionCollision DiagnosticAction = "collision"
+	// ActionRejected is used for entries which have been dropped by a validation stage.
+	ActionRejected DiagnosticAction = "rejected"
+	// ActionWarning is used for entries which have been applied, but might not behave as expected.
+	ActionWarning DiagnosticAction = "warning"
+)
+
+func NewMappingReport(source string) *MappingReport {
+	return &MappingReport{
+		Source:      source,
+		CreatedAt:   time.Now().UTC(),
+		Diagnostics: make([]Diagnostic, 0),
+		rows:        make(map[string]int),
+	}
+}
+
+// Add records a diagnostic. Missing row numbers are filled in using the known origin of the key.
+func (r *MappingReport) Add(d Diagnostic) {
+	if d.Row == 0 && len(d.Key) > 0 {
+		d.Row = r.Row(d.Key)
+	}
+	r.Diagnostics = append(r.Diagnostics, d)
+}
+
+// Skip records a row that could not be turned into a mapping entry.
+func (r *MappingReport) Skip(row int, key string, reason string, args ...any) {
+	r.Add(Diagnostic{
+		Row:    row,
+		Key:    key,
+		Action: ActionSkipped,
+		Reason: fmt.Sprintf(reason, args...),
+	})
+}
+
+// Reject records an entry that has been dropped from the mapping by a validation stage.
+func (r *MappingReport) Reject(key string, target string, reason string) {
+	r.Add(Diagnostic{
+		Key:    key,
+		Target: target,
+		Action: ActionRejected,
+		Reason: reason,
+	})
+}
+
+// Warn records an entry that has been applied, but might not behave as expected.
+func (r *MappingReport) Warn(key string, target string, reason string) {
+	r.Add(Diagnostic{
+		Key:    key,
+		Target: target,
+		Action: ActionWarning,
+		Reason: reason,
+	})
+}
+
+// Assign stores the entry in the mapping and remembers the row it originates from. If the key is already
+// present, the collision is resolved using the report's strategy and the losing row is recorded.
+func (r *MappingReport) Assign(mapping RedirectMap, row int, key string, target string) {
+	previousTarget, found := mapping[key]
+	if !found {
+		mapping[key] = target
+		r.SetRow(key, row)
+		return
+	}
+
+	previousRow := r.Row(key)
+	if r.Strategy == conf.CollisionKeepLast {
+		r.collision(previousRow, key, previousTarget, "duplicate key", row)
+		mapping[key] = target
+		r.SetRow(key, row)
+	} else {
+		r.collision(row, key, target, "duplicate key", previousRow)
+	}
+}
+
+func (r *MappingReport) collision(row int, key string, target string, cause string, winnerRow int) {
+	r.Add(Diagnostic{
+		Row:    row,
+		Key:    key,
+		Target: target,
+		Action: ActionCollision,
+		Reason: fmt.Sprintf("%s, row %d takes precedence", cause, winnerRow),
+	})
+}
+
+// Row returns the row the key originates from, or zero if it is unknown.
+func (r *MappingReport) Row(key string) int {
+	return r.rows[key]
+}
+
+func (r *MappingReport) SetRow(key string, row int) {
+	if row > 0 {
+		r.rows[key] = row
+	}
+}
+
+// Count returns the number of diagnostics with the given action.
+func (r *MappingReport) Count(action DiagnosticAction) int {
+	count := 0
+	for _, d := range r.Diagnostics {
+		if d.Action == action {
+			count++
+		}
+	}
+	return count
+}
+
+// Sort orders the diagnostics by row number first, and by key second.
+func (r *MappingReport) Sort() {
+	slices.SortStableFunc(r.Diagnostics, func(a, b Diagnostic) int {
+		return cmp.Or(cmp.Compare(a.Row, b.Row), cmp.Compare(a.Key, b.Key))
+	})
+}
+
+// RenameKeys creates a new mapping with every key replaced by the result of rename. Keys are processed in the order
+// of the rows they originate from, so collisions are resolved deterministically using the report's strategy.
+// The cause describes the renaming and is used when reporting collisions.
+func RenameKeys(mapping RedirectMap, report *MappingReport, cause string, rename func(string) string) RedirectMap {
+	keys := make([]string, 0, len(mapping))
+	for key := range mapping {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b string) int {
+		rowA, rowB := report.Row(a), report.Row(b)
+		// Keys of unknown origin are processed last
+		if (rowA == 0) != (rowB == 0) {
+			return cmp.Compare(rowB, rowA)
+		}
+		return cmp.Or(cmp.Compare(rowA, rowB), cmp.Compare(a, b))
+	})
+
+	renamed := make(RedirectMap, len(mapping))
+	origins := make(map[string]string, len(mapping))
+	rows := make(map[string]int, len(mapping))
+
+	for _, key := range keys {
+		newKey := rename(key)
+		target := mapping[key]
+		row := report.Row(key)
+
+		previousKey, found := origins[newKey]
+		if !found {
+			renamed[newKey] = target
+			origins[newKey] = key
+			rows[newKey] = row
+			continue
+		}
+
+		previousRow := rows[newKey]
+		if report.Strategy == conf.CollisionKeepLast {
+			report.collision(previousRow, previousKey, renamed[newKey], collisionCause(previousKey, key, cause), row)
+			renamed[newKey] = target
+			origins[newKey] = key
+			rows[newKey] = row
+		} else {
+			report.collision(row, key, target, collisionCause(key, previousKey, cause), previousRow)
+		}
+	}
+
+	report.rows = rows
+	return renamed
+}
+
+func collisionCause(key string, otherKey string, cause string) string {
+	return fmt.Sprintf("key '%s' collides with '%s' after %s", key, otherKey, cause)
+}
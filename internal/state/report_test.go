@@ -0,0 +1,45 @@
+package state
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fanonwue/go-short-link/internal/conf"
+)
+
+func TestRenameKeysKeepsFirstRow(t *testing.T) {
+	report := NewMappingReport("test")
+	mapping := RedirectMap{}
+	report.Assign(mapping, 5, "docs", "https://example.com/new")
+	report.Assign(mapping, 3, "Docs", "https://example.com/old")
+
+	renamed := RenameKeys(mapping, report, "converting to lowercase", strings.ToLower)
+
+	if target := renamed["docs"]; target != "https://example.com/old" {
+		t.Errorf("expected target of row 3 to be kept, got %s", target)
+	}
+	if row := report.Row("docs"); row != 3 {
+		t.Errorf("expected key to originate from row 3, got %d", row)
+	}
+	if count := report.Count(ActionCollision); count != 1 {
+		t.Fatalf("expected exactly one collision, got %d", count)
+	}
+	if row := report.Diagnostics[0].Row; row != 5 {
+		t.Errorf("expected collision to be reported for row 5, got %d", row)
+	}
+}
+
+func TestAssignKeepsLastRow(t *testing.T) {
+	report := NewMappingReport("test")
+	report.Strategy = conf.CollisionKeepLast
+	mapping := RedirectMap{}
+	report.Assign(mapping, 1, "docs", "https://example.com/old")
+	report.Assign(mapping, 2, "docs", "https://example.com/new")
+
+	if target := mapping["docs"]; target != "https://example.com/new" {
+		t.Errorf("expected target of row 2 to be kept, got %s", target)
+	}
+	if row := report.Diagnostics[0].Row; row != 1 {
+		t.Errorf("expected collision to be reported for row 1, got %d", row)
+	}
+}
@@ -0,0 +1,44 @@
+package stats
+
+import (
+	"strings"
+
+	"github.com/fanonwue/go-short-link/internal/bot"
+)
+
+// Classes of user agents recorded by the analytics
+const (
+	AgentBrowser = "browser"
+	AgentMobile  = "mobile"
+	AgentBot     = "bot"
+	AgentCli     = "cli"
+	AgentOther   = "other"
+	AgentUnknown = "unknown"
+)
+
+var mobileAgentMarkers = []string{"mobile", "android", "iphone", "ipad"}
+
+// AgentClass reduces a user agent string to a coarse class, so no fingerprintable details are recorded.
+func AgentClass(userAgent string) string {
+	if len(userAgent) == 0 {
+		return AgentUnknown
+	}
+	ua := strings.ToLower(userAgent)
+
+	// Tools are recognized by the patterns of the bot detection, so both agree on what counts as a tool
+	if result := bot.ClassifyUserAgent(ua); result.Category == bot.CategoryTool {
+		return AgentCli
+	} else if result.IsBot() {
+		return AgentBot
+	}
+
+	if !strings.HasPrefix(ua, "mozilla/") {
+		return AgentOther
+	}
+	for _, marker := range mobileAgentMarkers {
+		if strings.Contains(ua, marker) {
+			return AgentMobile
+		}
+	}
+	return AgentBrowser
+}
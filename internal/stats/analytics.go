@@ -0,0 +1,378 @@
+package stats
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// Granularity is the size of the buckets returned by [ClickAnalytics.Query].
+	Granularity string
+
+	// Bucket aggregates the clicks of a single key within one hour. Referrer hosts and user agent classes are
+	// capped per bucket, the remaining values are counted as [OtherValue].
+	Bucket struct {
+		Clicks    uint64
+		Referrers map[string]uint64
+		Agents    map[string]uint64
+	}
+
+	// ClickAnalytics keeps hourly click buckets per key, for a limited retention window. Recording is lock-free
+	// once the bucket exists, so it does not add contention to the request path.
+	ClickAnalytics struct {
+		// series maps the key to its *keyBuckets
+		series    sync.Map
+		retention time.Duration
+		// mutex is only held exclusively while buckets are removed or replaced, so recording never writes to a
+		// bucket that is being dropped
+		mutex sync.RWMutex
+	}
+
+	// keyBuckets maps the hour (in Unix seconds) a bucket starts at to its *liveBucket.
+	keyBuckets struct {
+		buckets sync.Map
+	}
+
+	liveBucket struct {
+		clicks    atomic.Uint64
+		referrers cappedCounter
+		agents    cappedCounter
+	}
+
+	// cappedCounter counts up to maxValuesPerBucket distinct values, further values are counted as [OtherValue].
+	cappedCounter struct {
+		// values maps the value to its *atomic.Uint64
+		values   sync.Map
+		distinct atomic.Int32
+	}
+
+	// SeriesPoint is the number of clicks within the bucket starting at Time.
+	SeriesPoint struct {
+		Time   time.Time `json:"time"`
+		Clicks uint64    `json:"clicks"`
+	}
+
+	// QueryResult is the aggregated analytics of a single key within a time range.
+	QueryResult struct {
+		Key       string            `json:"key"`
+		Bucket    Granularity       `json:"bucket"`
+		From      time.Time         `json:"from"`
+		To        time.Time         `json:"to"`
+		Total     uint64            `json:"total"`
+		Series    []SeriesPoint     `json:"series"`
+		Referrers map[string]uint64 `json:"referrers"`
+		Agents    map[string]uint64 `json:"agents"`
+	}
+
+	analyticsFile struct {
+		Version int
+		Series  map[string]map[int64]*Bucket
+	}
+)
+
+const (
+	GranularityHour Granularity = "hour"
+	GranularityDay  Granularity = "day"
+
+	// DirectReferrer is recorded for clicks without a (parseable) referrer
+	DirectReferrer = "(direct)"
+	// OtherValue collects the values exceeding the per-bucket limit
+	OtherValue = "(other)"
+
+	maxValuesPerBucket    = 50
+	analyticsFileVersion  = 1
+	defaultQueryHourRange = 24 * time.Hour
+	defaultQueryDayRange  = 30 * 24 * time.Hour
+)
+
+var ErrInvalidGranularity = errors.New("invalid bucket size, must be 'hour' or 'day'")
+
+func ParseGranularity(value string) (Granularity, error) {
+	switch Granularity(value) {
+	case "", GranularityDay:
+		return GranularityDay, nil
+	case GranularityHour:
+		return GranularityHour, nil
+	}
+	return "", ErrInvalidGranularity
+}
+
+// Duration returns the length of a single bucket.
+func (g Granularity) Duration() time.Duration {
+	if g == GranularityHour {
+		return time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// DefaultRange returns the range queried if the caller does not specify one.
+func (g Granularity) DefaultRange() time.Duration {
+	if g == GranularityHour {
+		return defaultQueryHourRange
+	}
+	return defaultQueryDayRange
+}
+
+func NewClickAnalytics(retention time.Duration) *ClickAnalytics {
+	return &ClickAnalytics{retention: retention}
+}
+
+// Record adds a click of the given key at the given time.
+func (a *ClickAnalytics) Record(key string, at time.Time, referrer string, agentClass string) {
+	hour := at.UTC().Truncate(time.Hour).Unix()
+
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	bucket := a.keyBuckets(key).bucket(hour)
+	bucket.clicks.Add(1)
+	bucket.referrers.increment(ReferrerHost(referrer))
+	bucket.agents.increment(agentClass)
+}
+
+func (a *ClickAnalytics) keyBuckets(key string) *keyBuckets {
+	// Fast path, avoids an allocation for keys that have been recorded already
+	if buckets, found := a.series.Load(key); found {
+		return buckets.(*keyBuckets)
+	}
+	buckets, _ := a.series.LoadOrStore(key, &keyBuckets{})
+	return buckets.(*keyBuckets)
+}
+
+func (kb *keyBuckets) bucket(hour int64) *liveBucket {
+	if bucket, found := kb.buckets.Load(hour); found {
+		return bucket.(*liveBucket)
+	}
+	bucket, _ := kb.buckets.LoadOrStore(hour, &liveBucket{})
+	return bucket.(*liveBucket)
+}
+
+// snapshot copies the counts of the bucket.
+func (b *liveBucket) snapshot() *Bucket {
+	return &Bucket{
+		Clicks:    b.clicks.Load(),
+		Referrers: b.referrers.snapshot(),
+		Agents:    b.agents.snapshot(),
+	}
+}
+
+func newLiveBucket(bucket *Bucket) *liveBucket {
+	live := &liveBucket{}
+	live.clicks.Store(bucket.Clicks)
+	live.referrers.restore(bucket.Referrers)
+	live.agents.restore(bucket.Agents)
+	return live
+}
+
+func (c *cappedCounter) increment(value string) {
+	if counter, found := c.values.Load(value); found {
+		counter.(*atomic.Uint64).Add(1)
+		return
+	}
+	if value != OtherValue {
+		// Reserve a slot for the value first, so concurrent increments cannot exceed the limit
+		if c.distinct.Add(1) <= maxValuesPerBucket {
+			counter, loaded := c.values.LoadOrStore(value, &atomic.Uint64{})
+			if loaded {
+				c.distinct.Add(-1)
+			}
+			counter.(*atomic.Uint64).Add(1)
+			return
+		}
+		c.distinct.Add(-1)
+	}
+	counter, _ := c.values.LoadOrStore(OtherValue, &atomic.Uint64{})
+	counter.(*atomic.Uint64).Add(1)
+}
+
+func (c *cappedCounter) snapshot() map[string]uint64 {
+	values := map[string]uint64{}
+	c.values.Range(func(value, counter any) bool {
+		values[value.(string)] = counter.(*atomic.Uint64).Load()
+		return true
+	})
+	return values
+}
+
+func (c *cappedCounter) restore(values map[string]uint64) {
+	for value, count := range values {
+		counter := &atomic.Uint64{}
+		counter.Store(count)
+		c.values.Store(value, counter)
+		if value != OtherValue {
+			c.distinct.Add(1)
+		}
+	}
+}
+
+// Query aggregates the buckets of key within [from, to). Buckets without clicks are included in the series,
+// so it can be plotted directly.
+func (a *ClickAnalytics) Query(key string, from time.Time, to time.Time, granularity Granularity) QueryResult {
+	step := granularity.Duration()
+	from = from.UTC().Truncate(step)
+	to = to.UTC()
+
+	result := QueryResult{
+		Key:       key,
+		Bucket:    granularity,
+		From:      from,
+		To:        to,
+		Series:    []SeriesPoint{},
+		Referrers: map[string]uint64{},
+		Agents:    map[string]uint64{},
+	}
+
+	for t := from; t.Before(to); t = t.Add(step) {
+		result.Series = append(result.Series, SeriesPoint{Time: t})
+	}
+
+	buckets, found := a.series.Load(key)
+	if !found {
+		return result
+	}
+	buckets.(*keyBuckets).buckets.Range(func(hour, live any) bool {
+		bucket := live.(*liveBucket).snapshot()
+		bucketTime := time.Unix(hour.(int64), 0).UTC()
+		if bucketTime.Before(from) || !bucketTime.Before(to) {
+			return true
+		}
+		index := int(bucketTime.Sub(from) / step)
+		if index < len(result.Series) {
+			result.Series[index].Clicks += bucket.Clicks
+		}
+		result.Total += bucket.Clicks
+		for referrer, count := range bucket.Referrers {
+			result.Referrers[referrer] += count
+		}
+		for agent, count := range bucket.Agents {
+			result.Agents[agent] += count
+		}
+		return true
+	})
+
+	return result
+}
+
+// Keys returns all keys with at least one bucket.
+func (a *ClickAnalytics) Keys() []string {
+	var keys []string
+	a.series.Range(func(key, _ any) bool {
+		keys = append(keys, key.(string))
+		return true
+	})
+	slices.Sort(keys)
+	return keys
+}
+
+// Purge removes all buckets that are older than the retention window and returns the number of removed buckets.
+func (a *ClickAnalytics) Purge(now time.Time) int {
+	if a.retention <= 0 {
+		return 0
+	}
+	return a.PurgeBefore(now.Add(-a.retention))
+}
+
+// PurgeBefore removes all buckets starting before the given time and returns the number of removed buckets.
+func (a *ClickAnalytics) PurgeBefore(cutoff time.Time) int {
+	cutoffHour := cutoff.UTC().Truncate(time.Hour).Unix()
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	removed := 0
+	a.series.Range(func(key, buckets any) bool {
+		remaining := 0
+		buckets.(*keyBuckets).buckets.Range(func(hour, _ any) bool {
+			if hour.(int64) < cutoffHour {
+				buckets.(*keyBuckets).buckets.Delete(hour)
+				removed++
+			} else {
+				remaining++
+			}
+			return true
+		})
+		if remaining == 0 {
+			a.series.Delete(key)
+		}
+		return true
+	})
+	return removed
+}
+
+// Load restores the buckets from a file previously written by [ClickAnalytics.Flush]. Buckets outside the
+// retention window are dropped.
+func (a *ClickAnalytics) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var persisted analyticsFile
+	if err = gob.NewDecoder(bytes.NewReader(data)).Decode(&persisted); err != nil {
+		return err
+	}
+	if persisted.Version != analyticsFileVersion {
+		return fmt.Errorf("unsupported analytics file version %d", persisted.Version)
+	}
+
+	a.mutex.Lock()
+	for key, buckets := range persisted.Series {
+		restored := &keyBuckets{}
+		for hour, bucket := range buckets {
+			restored.buckets.Store(hour, newLiveBucket(bucket))
+		}
+		a.series.Store(key, restored)
+	}
+	a.mutex.Unlock()
+
+	a.Purge(time.Now())
+	return nil
+}
+
+// Flush writes all buckets to the given path, using the gob encoding to keep the file compact.
+func (a *ClickAnalytics) Flush(path string) error {
+	series := make(map[string]map[int64]*Bucket)
+	a.mutex.RLock()
+	a.series.Range(func(key, buckets any) bool {
+		snapshot := make(map[int64]*Bucket)
+		buckets.(*keyBuckets).buckets.Range(func(hour, bucket any) bool {
+			snapshot[hour.(int64)] = bucket.(*liveBucket).snapshot()
+			return true
+		})
+		series[key.(string)] = snapshot
+		return true
+	})
+	a.mutex.RUnlock()
+
+	buffer := &bytes.Buffer{}
+	err := gob.NewEncoder(buffer).Encode(&analyticsFile{
+		Version: analyticsFileVersion,
+		Series:  series,
+	})
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, buffer.Bytes())
+}
+
+// ReferrerHost reduces a referrer to its host name, to avoid recording full URLs.
+func ReferrerHost(referrer string) string {
+	if len(referrer) == 0 {
+		return DirectReferrer
+	}
+	parsed, err := url.Parse(referrer)
+	if err != nil || len(parsed.Hostname()) == 0 {
+		return DirectReferrer
+	}
+	return strings.ToLower(parsed.Hostname())
+}
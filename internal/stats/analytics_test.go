@@ -0,0 +1,106 @@
+package stats
+
+import (
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAnalyticsQuery(t *testing.T) {
+	analytics := NewClickAnalytics(0)
+	day := time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC)
+
+	analytics.Record("docs", day.Add(1*time.Hour), "https://News.example.org/article?id=1", AgentBrowser)
+	analytics.Record("docs", day.Add(1*time.Hour+30*time.Minute), "", AgentCli)
+	analytics.Record("docs", day.Add(26*time.Hour), "not a url", AgentBot)
+	analytics.Record("other", day.Add(1*time.Hour), "", AgentBrowser)
+
+	result := analytics.Query("docs", day, day.Add(3*24*time.Hour), GranularityDay)
+	if result.Total != 3 {
+		t.Errorf("expected 3 clicks in total, got %d", result.Total)
+	}
+	expectedSeries := []uint64{2, 1, 0}
+	if len(result.Series) != len(expectedSeries) {
+		t.Fatalf("expected %d buckets, got %d", len(expectedSeries), len(result.Series))
+	}
+	for i, expected := range expectedSeries {
+		if result.Series[i].Clicks != expected {
+			t.Errorf("bucket %d: expected %d clicks, got %d", i, expected, result.Series[i].Clicks)
+		}
+	}
+	if result.Referrers["news.example.org"] != 1 || result.Referrers[DirectReferrer] != 2 {
+		t.Errorf("unexpected referrers: %v", result.Referrers)
+	}
+
+	hourly := analytics.Query("docs", day, day.Add(2*time.Hour), GranularityHour)
+	if len(hourly.Series) != 2 || hourly.Series[1].Clicks != 2 || hourly.Total != 2 {
+		t.Errorf("unexpected hourly result: %+v", hourly)
+	}
+}
+
+func TestAnalyticsValueLimit(t *testing.T) {
+	analytics := NewClickAnalytics(0)
+	now := time.Now()
+
+	var wg sync.WaitGroup
+	for i := range maxValuesPerBucket + 10 {
+		wg.Go(func() {
+			analytics.Record("docs", now, "https://host"+strconv.Itoa(i)+".example.org", AgentBrowser)
+		})
+	}
+	wg.Wait()
+
+	result := analytics.Query("docs", now.Add(-time.Hour), now.Add(time.Hour), GranularityHour)
+	if result.Total != maxValuesPerBucket+10 || result.Agents[AgentBrowser] != result.Total {
+		t.Errorf("expected all clicks to be counted, got %+v", result)
+	}
+	if len(result.Referrers) != maxValuesPerBucket+1 || result.Referrers[OtherValue] != 10 {
+		t.Errorf("expected %d referrers and 10 other clicks, got %v", maxValuesPerBucket, result.Referrers)
+	}
+}
+
+func TestAnalyticsPurgeAndPersistence(t *testing.T) {
+	now := time.Now().UTC()
+	analytics := NewClickAnalytics(48 * time.Hour)
+	analytics.Record("docs", now.Add(-72*time.Hour), "", AgentBrowser)
+	analytics.Record("docs", now, "", AgentBrowser)
+	analytics.Record("old", now.Add(-72*time.Hour), "", AgentBrowser)
+
+	if removed := analytics.Purge(now); removed != 2 {
+		t.Errorf("expected 2 buckets to be purged, got %d", removed)
+	}
+	if keys := analytics.Keys(); len(keys) != 1 || keys[0] != "docs" {
+		t.Errorf("expected only 'docs' to remain, got %v", keys)
+	}
+
+	path := filepath.Join(t.TempDir(), "analytics.gob")
+	if err := analytics.Flush(path); err != nil {
+		t.Fatal(err)
+	}
+	restored := NewClickAnalytics(48 * time.Hour)
+	if err := restored.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	restored.Record("docs", now, "", AgentBrowser)
+	if total := restored.Query("docs", now.Add(-time.Hour), now.Add(time.Hour), GranularityHour).Total; total != 2 {
+		t.Errorf("expected 2 clicks after restoring, got %d", total)
+	}
+}
+
+func TestAgentClass(t *testing.T) {
+	tests := map[string]string{
+		"":           AgentUnknown,
+		"curl/8.4.0": AgentCli,
+		"Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)":    AgentBot,
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) Firefox/120.0":       AgentBrowser,
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) Mobile": AgentMobile,
+		"SomethingElse/1.0": AgentOther,
+	}
+	for userAgent, expected := range tests {
+		if actual := AgentClass(userAgent); actual != expected {
+			t.Errorf("%q: expected %s, got %s", userAgent, expected, actual)
+		}
+	}
+}
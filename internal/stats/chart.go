@@ -0,0 +1,56 @@
+package stats
+
+import "time"
+
+type (
+	// Chart contains the precomputed geometry of a bar chart, so it can be rendered as SVG by a template.
+	Chart struct {
+		Width  int
+		Height int
+		Max    uint64
+		Total  uint64
+		Bars   []ChartBar
+	}
+
+	ChartBar struct {
+		X      float64
+		Y      float64
+		Width  float64
+		Height float64
+		Time   time.Time
+		Clicks uint64
+	}
+)
+
+const chartBarGap = 0.2
+
+// NewChart lays out the points of a series as bars filling the given area. Bars of buckets without clicks
+// are kept with a height of zero, so the gaps remain visible.
+func NewChart(points []SeriesPoint, width int, height int) *Chart {
+	chart := &Chart{Width: width, Height: height}
+	if len(points) == 0 {
+		return chart
+	}
+
+	for _, point := range points {
+		chart.Max = max(chart.Max, point.Clicks)
+		chart.Total += point.Clicks
+	}
+
+	slotWidth := float64(width) / float64(len(points))
+	for i, point := range points {
+		barHeight := 0.0
+		if chart.Max > 0 {
+			barHeight = float64(point.Clicks) / float64(chart.Max) * float64(height)
+		}
+		chart.Bars = append(chart.Bars, ChartBar{
+			X:      float64(i)*slotWidth + slotWidth*chartBarGap/2,
+			Y:      float64(height) - barHeight,
+			Width:  slotWidth * (1 - chartBarGap),
+			Height: barHeight,
+			Time:   point.Time,
+			Clicks: point.Clicks,
+		})
+	}
+	return chart
+}
@@ -0,0 +1,286 @@
+package stats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fanonwue/go-short-link/internal/bot"
+	"github.com/fanonwue/go-short-link/internal/conf"
+	"github.com/fanonwue/go-short-link/internal/privacy"
+	"github.com/fanonwue/goutils/logging"
+)
+
+type (
+	// ClickCounter counts the clicks per redirect key. Counting is lock-free once a key has been seen,
+	// so it does not add contention to the request path.
+	ClickCounter struct {
+		counts     sync.Map
+		since      time.Time
+		flushMutex sync.Mutex
+	}
+
+	keyCounter struct {
+		count atomic.Uint64
+		// lastClick is the time of the last click in Unix nanoseconds
+		lastClick atomic.Int64
+	}
+
+	snapshotFile struct {
+		Since      time.Time            `json:"since"`
+		Counts     map[string]uint64    `json:"counts"`
+		LastClicks map[string]time.Time `json:"lastClicks,omitempty"`
+	}
+)
+
+var (
+	clicks    = NewClickCounter()
+	analytics = NewClickAnalytics(0)
+)
+
+func NewClickCounter() *ClickCounter {
+	return &ClickCounter{since: time.Now().UTC()}
+}
+
+// Clicks returns the shared click counter.
+func Clicks() *ClickCounter {
+	return clicks
+}
+
+// Analytics returns the shared time-bucketed analytics.
+func Analytics() *ClickAnalytics {
+	return analytics
+}
+
+func Enabled() bool {
+	return conf.Config().StatsEnabled
+}
+
+func AnalyticsEnabled() bool {
+	return Enabled() && conf.Config().AnalyticsEnabled
+}
+
+// RecordClick records a click of key, caused by the given request, in all enabled statistics. Clients that
+// opted out of tracking are only counted, but not included in the analytics. Automated clients are
+// not recorded at all, unless configured otherwise. HEAD requests do not follow the redirect, so they
+// are never counted as clicks.
+func RecordClick(key string, r *http.Request) {
+	if !Enabled() || r.Method == http.MethodHead || bot.Excluded(bot.FromRequest(r)) {
+		return
+	}
+	Clicks().Hit(key)
+	if AnalyticsEnabled() && privacy.TrackingAllowed(r) {
+		Analytics().Record(key, time.Now(), r.Referer(), AgentClass(r.UserAgent()))
+	}
+}
+
+// Hit increments the click count of the given key and records the time of the click.
+func (c *ClickCounter) Hit(key string) {
+	counter := c.counter(key)
+	counter.count.Add(1)
+	counter.lastClick.Store(time.Now().UnixNano())
+}
+
+// Count returns the click count of the given key.
+func (c *ClickCounter) Count(key string) uint64 {
+	counter, found := c.counts.Load(key)
+	if !found {
+		return 0
+	}
+	return counter.(*keyCounter).count.Load()
+}
+
+// Counts returns a copy of all click counts.
+func (c *ClickCounter) Counts() map[string]uint64 {
+	counts := make(map[string]uint64)
+	c.counts.Range(func(key, counter any) bool {
+		counts[key.(string)] = counter.(*keyCounter).count.Load()
+		return true
+	})
+	return counts
+}
+
+// LastClicks returns the time of the last click of every key that has been clicked since counting has started.
+func (c *ClickCounter) LastClicks() map[string]time.Time {
+	lastClicks := make(map[string]time.Time)
+	c.counts.Range(func(key, counter any) bool {
+		if nanos := counter.(*keyCounter).lastClick.Load(); nanos > 0 {
+			lastClicks[key.(string)] = time.Unix(0, nanos).UTC()
+		}
+		return true
+	})
+	return lastClicks
+}
+
+// Since returns the time at which counting has started.
+func (c *ClickCounter) Since() time.Time {
+	return c.since
+}
+
+func (c *ClickCounter) counter(key string) *keyCounter {
+	// Fast path, avoids an allocation for keys that have been counted already
+	if counter, found := c.counts.Load(key); found {
+		return counter.(*keyCounter)
+	}
+	counter, _ := c.counts.LoadOrStore(key, &keyCounter{})
+	return counter.(*keyCounter)
+}
+
+// Load restores the counts from a snapshot file previously written by [ClickCounter.Flush].
+func (c *ClickCounter) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var snapshot snapshotFile
+	if err = json.Unmarshal(data, &snapshot); err != nil {
+		return err
+	}
+
+	for key, count := range snapshot.Counts {
+		c.counter(key).count.Add(count)
+	}
+	for key, lastClick := range snapshot.LastClicks {
+		counter := c.counter(key)
+		// Only restore if there has not been a newer click in the meantime
+		nanos := lastClick.UnixNano()
+		counter.lastClick.CompareAndSwap(0, nanos)
+	}
+	if !snapshot.Since.IsZero() && snapshot.Since.Before(c.since) {
+		c.since = snapshot.Since
+	}
+	return nil
+}
+
+// Flush writes a snapshot of all counts to the given path. The file is replaced atomically, so a crash
+// during the write does not corrupt the previous snapshot.
+func (c *ClickCounter) Flush(path string) error {
+	c.flushMutex.Lock()
+	defer c.flushMutex.Unlock()
+
+	jsonBytes, err := json.Marshal(&snapshotFile{
+		Since:      c.since,
+		Counts:     c.Counts(),
+		LastClicks: c.LastClicks(),
+	})
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, jsonBytes)
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+
+	tempFile, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tempFile.Name()) }()
+
+	_, err = tempFile.Write(data)
+	if err == nil {
+		err = tempFile.Sync()
+	}
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tempFile.Name(), path)
+}
+
+// Setup restores persisted counts and starts the background job flushing them periodically.
+func Setup(ctx context.Context) {
+	if !Enabled() {
+		return
+	}
+
+	path := conf.Config().StatsFile
+	if len(path) == 0 {
+		logging.Info("Click statistics enabled, counts will not be persisted")
+	} else {
+		err := Clicks().Load(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			logging.Warnf("Could not load click statistics from %s: %v", path, err)
+		}
+		logging.Infof("Click statistics enabled, persisting counts to %s", path)
+	}
+
+	if AnalyticsEnabled() {
+		setupAnalytics()
+	}
+
+	go startFlushJob(ctx)
+}
+
+func setupAnalytics() {
+	analytics = NewClickAnalytics(conf.Config().AnalyticsRetention)
+	privacy.RegisterPurger("click analytics", func(cutoff time.Time) (int, error) {
+		return Analytics().PurgeBefore(cutoff), nil
+	})
+
+	path := conf.Config().AnalyticsFile
+	if len(path) == 0 {
+		logging.Info("Click analytics enabled, analytics will not be persisted")
+		return
+	}
+
+	err := Analytics().Load(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		logging.Warnf("Could not load click analytics from %s: %v", path, err)
+	}
+	logging.Infof("Click analytics enabled, persisting analytics to %s", path)
+}
+
+// Shutdown flushes the counts a final time.
+func Shutdown() {
+	if !Enabled() {
+		return
+	}
+	flushLog()
+}
+
+func startFlushJob(ctx context.Context) {
+	ticker := time.NewTicker(conf.Config().StatsFlushPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if AnalyticsEnabled() {
+				if removed := Analytics().Purge(time.Now()); removed > 0 {
+					logging.Debugf("Purged %d analytics buckets outside the retention window", removed)
+				}
+			}
+			flushLog()
+		}
+	}
+}
+
+func flushLog() {
+	if path := conf.Config().StatsFile; len(path) > 0 {
+		if err := Clicks().Flush(path); err != nil {
+			logging.Errorf("Could not persist click statistics: %v", err)
+		}
+	}
+	if path := conf.Config().AnalyticsFile; AnalyticsEnabled() && len(path) > 0 {
+		if err := Analytics().Flush(path); err != nil {
+			logging.Errorf("Could not persist click analytics: %v", err)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package stats
+
+import (
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/fanonwue/go-short-link/internal/conf"
+)
+
+func TestClickCounterPersistence(t *testing.T) {
+	counter := NewClickCounter()
+	counter.Hit("docs")
+	counter.Hit("docs")
+	counter.Hit("gh")
+
+	dir := filepath.Join(t.TempDir(), "stats")
+	path := filepath.Join(dir, "clicks.json")
+	if err := counter.Flush(path); err != nil {
+		t.Fatal(err)
+	}
+	// Flushing again replaces the previous snapshot
+	counter.Hit("gh")
+	if err := counter.Flush(path); err != nil {
+		t.Fatal(err)
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(dir, "*.tmp")); len(leftovers) > 0 {
+		t.Errorf("expected no temporary files to be left behind, got %v", leftovers)
+	}
+
+	restored := NewClickCounter()
+	restored.Hit("docs")
+	if err := restored.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]uint64{"docs": 3, "gh": 2}
+	if counts := restored.Counts(); !maps.Equal(counts, expected) {
+		t.Errorf("expected restored counts %v to be added to new clicks, got %v", expected, counts)
+	}
+	if lastClicks := restored.LastClicks(); len(lastClicks) != 2 {
+		t.Errorf("expected the last clicks of both keys to be restored, got %v", lastClicks)
+	}
+	if !restored.Since().Equal(counter.Since()) {
+		t.Errorf("expected counting to have started at %s, got %s", counter.Since(), restored.Since())
+	}
+}
+
+func TestRecordClick(t *testing.T) {
+	previous := conf.Config().StatsEnabled
+	conf.Config().StatsEnabled = true
+	t.Cleanup(func() { conf.Config().StatsEnabled = previous })
+
+	key := "record-click-test"
+	browser := "Mozilla/5.0 (X11; Linux x86_64; rv:120.0) Gecko/20100101 Firefox/120.0"
+	requests := []struct {
+		method    string
+		userAgent string
+		counted   bool
+	}{
+		{http.MethodGet, browser, true},
+		{http.MethodHead, browser, false},
+		{http.MethodGet, "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", false},
+		{http.MethodGet, "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)", false},
+	}
+
+	for _, request := range requests {
+		before := Clicks().Count(key)
+		r := httptest.NewRequest(request.method, "/"+key, nil)
+		r.Header.Set("User-Agent", request.userAgent)
+		RecordClick(key, r)
+		if counted := Clicks().Count(key) > before; counted != request.counted {
+			t.Errorf("%s %q: expected counted %t, got %t", request.method, request.userAgent, request.counted, counted)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fanonwue/go-short-link/internal/conf"
+	"github.com/fanonwue/go-short-link/internal/reqctx"
+	"github.com/fanonwue/go-short-link/internal/util"
+	"github.com/fanonwue/goutils/logging"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type Exporter string
+
+const (
+	ExporterNone     Exporter = "none"
+	ExporterOtlp     Exporter = "otlp"
+	ExporterOtlpGrpc Exporter = "otlp-grpc"
+	ExporterStdout   Exporter = "stdout"
+)
+
+const (
+	instrumentationName = "github.com/fanonwue/go-short-link"
+	defaultServiceName  = "go-short-link"
+	shutdownTimeout     = 5 * time.Second
+)
+
+var provider *sdktrace.TracerProvider
+
+func ParseExporter(value string) (Exporter, error) {
+	exporter := Exporter(strings.ToLower(strings.TrimSpace(value)))
+	switch exporter {
+	case "":
+		return ExporterNone, nil
+	case ExporterNone, ExporterOtlp, ExporterOtlpGrpc, ExporterStdout:
+		return exporter, nil
+	}
+	return ExporterNone, fmt.Errorf("unknown tracing exporter '%s'", value)
+}
+
+// Setup configures the global tracer provider. Unless an exporter is configured, the no-op provider of
+// OpenTelemetry stays in place, so spans cost next to nothing. The exporters are configured using the
+// standard OTEL_* environment variables (e.g. OTEL_EXPORTER_OTLP_ENDPOINT or OTEL_TRACES_SAMPLER).
+func Setup(ctx context.Context) {
+	name, err := ParseExporter(conf.Config().TracingExporter)
+	if err != nil {
+		logging.Warnf("Invalid %s, tracing is disabled: %v", util.PrefixedEnvVar("TRACING_EXPORTER"), err)
+	}
+	if name == ExporterNone {
+		return
+	}
+
+	exporter, err := createExporter(ctx, name)
+	if err != nil {
+		logging.Errorf("Could not create tracing exporter, tracing is disabled: %v", err)
+		return
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", defaultServiceName)),
+		resource.WithTelemetrySDK(),
+		// Attributes from OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES take precedence
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		logging.Warnf("Could not detect all tracing resource attributes: %v", err)
+	}
+
+	provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	logging.Infof("Tracing enabled, exporting spans using '%s'", name)
+}
+
+func createExporter(ctx context.Context, name Exporter) (sdktrace.SpanExporter, error) {
+	switch name {
+	case ExporterOtlp:
+		return otlptracehttp.New(ctx)
+	case ExporterOtlpGrpc:
+		return otlptracegrpc.New(ctx)
+	case ExporterStdout:
+		return stdouttrace.New()
+	}
+	return nil, fmt.Errorf("unsupported exporter '%s'", name)
+}
+
+// Shutdown exports all remaining spans.
+func Shutdown() {
+	if provider == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := provider.Shutdown(ctx); err != nil {
+		logging.Warnf("Error shutting down tracing: %v", err)
+	}
+}
+
+// Tracer returns the tracer used for all spans of the application.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Start creates a new span as a child of the span in ctx, if any.
+func Start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// End records err on the span, if it is not nil, and ends the span.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Middleware creates a server span for every request. It has to wrap the [http.ServeMux] directly: the
+// pattern is only known once the mux has routed the request, so the span is renamed after the pattern
+// when next returns.
+func Middleware(next http.Handler) http.Handler {
+	routed := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		span := trace.SpanFromContext(r.Context())
+		if id := reqctx.RequestId(r.Context()); len(id) > 0 {
+			span.SetAttributes(attribute.String("request.id", id))
+		}
+		next.ServeHTTP(w, r)
+		// The mux stores the matched pattern in the request it has been given
+		span.SetName(spanName("", r))
+	})
+	return otelhttp.NewHandler(routed, "http.server", otelhttp.WithSpanNameFormatter(spanName))
+}
+
+// Transport wraps base, creating a client span for every request.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	return otelhttp.NewTransport(base)
+}
+
+func spanName(_ string, r *http.Request) string {
+	if len(r.Pattern) == 0 {
+		return r.Method
+	}
+	// Patterns may start with a method, which is replaced by the method of the request
+	pattern := r.Pattern
+	if _, path, found := strings.Cut(pattern, " "); found {
+		pattern = strings.TrimSpace(path)
+	}
+	return r.Method + " " + pattern
+}
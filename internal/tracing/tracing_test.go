@@ -0,0 +1,63 @@
+package tracing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestParseExporter(t *testing.T) {
+	tests := map[string]Exporter{
+		"":           ExporterNone,
+		"none":       ExporterNone,
+		" OTLP ":     ExporterOtlp,
+		"otlp-grpc":  ExporterOtlpGrpc,
+		"stdout":     ExporterStdout,
+		"zipkin":     ExporterNone,
+		"otlp-http2": ExporterNone,
+	}
+	for value, expected := range tests {
+		exporter, err := ParseExporter(value)
+		if exporter != expected {
+			t.Errorf("%q: expected %s, got %s", value, expected, exporter)
+		}
+		if invalid := value == "zipkin" || value == "otlp-http2"; invalid != (err != nil) {
+			t.Errorf("%q: unexpected error %v", value, err)
+		}
+	}
+}
+
+func TestNoopByDefault(t *testing.T) {
+	Setup(t.Context())
+	if provider != nil {
+		t.Fatal("expected no tracer provider to be created without an exporter")
+	}
+	_, span := Start(t.Context(), "test")
+	defer span.End()
+	if span.IsRecording() || span.SpanContext().IsValid() {
+		t.Error("expected spans to be no-ops without an exporter")
+	}
+}
+
+func TestMiddlewareSpanName(t *testing.T) {
+	previous := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /_api/links/{key}", func(w http.ResponseWriter, r *http.Request) {})
+	handler := Middleware(mux)
+
+	for path, expected := range map[string]string{"/_api/links/docs": "GET /_api/links/{key}", "/unknown": "GET"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+		spans := recorder.Ended()
+		if name := spans[len(spans)-1].Name(); name != expected {
+			t.Errorf("%s: expected span name %q, got %q", path, expected, name)
+		}
+	}
+}
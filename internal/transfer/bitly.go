@@ -0,0 +1,81 @@
+package transfer
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+)
+
+var (
+	bitlyShortColumns  = []string{"link", "bitlink", "short link", "short url"}
+	bitlyLongColumns   = []string{"long url", "destination", "destination url", "original url"}
+	bitlyCustomColumns = []string{"custom bitlinks", "custom bitlink", "custom back halves"}
+	bitlyDomains       = []string{"bit.ly", "bitly.is", "j.mp"}
+)
+
+// importBitly reads a CSV export of bit.ly links. The columns are identified by their header, as the layout of the
+// export differs between plans. The back-half of each bitlink becomes the key, custom bitlinks are imported as
+// aliases of it.
+func importBitly(r io.Reader) ([]Entry, []Note, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, err
+	}
+	findColumn := func(names []string) int {
+		return slices.IndexFunc(header, func(column string) bool {
+			column = strings.ToLower(strings.TrimSpace(strings.NewReplacer("_", " ", "-", " ").Replace(column)))
+			return slices.Contains(names, column)
+		})
+	}
+	shortColumn, longColumn, customColumn := findColumn(bitlyShortColumns), findColumn(bitlyLongColumns), findColumn(bitlyCustomColumns)
+	if shortColumn < 0 || longColumn < 0 {
+		return nil, nil, errors.New("header is missing the bitlink or long URL column")
+	}
+
+	var entries []Entry
+	notes := &noteCollector{}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return entries, notes.notes, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		row, _ := reader.FieldPos(0)
+		if len(record) <= max(shortColumn, longColumn) {
+			notes.skip(row, "", "missing columns")
+			continue
+		}
+
+		key, host, err := keyFromShortUrl(record[shortColumn])
+		if err != nil {
+			notes.skip(row, record[shortColumn], "invalid bitlink: %v", err)
+			continue
+		}
+		if !slices.Contains(bitlyDomains, host) {
+			notes.add(row, key, "custom domain %s is not supported", host)
+		}
+		entries = append(entries, Entry{Key: key, Target: record[longColumn]})
+
+		if customColumn < 0 || customColumn >= len(record) {
+			continue
+		}
+		for _, custom := range strings.FieldsFunc(record[customColumn], func(r rune) bool { return strings.ContainsRune(",; ", r) }) {
+			customKey, _, err := keyFromShortUrl(custom)
+			if err != nil {
+				notes.add(row, key, "invalid custom bitlink %s: %v", custom, err)
+				continue
+			}
+			if customKey != key {
+				entries = append(entries, Entry{Key: customKey, Target: key})
+			}
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package transfer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+type (
+	// Note reports a feature of a single row of a foreign export that could not be imported.
+	Note struct {
+		// Row is the number of the row or record within the export, starting at 1
+		Row     int    `json:"row"`
+		Key     string `json:"key,omitempty"`
+		Message string `json:"message"`
+		// Skipped is true if the row has not been imported at all
+		Skipped bool `json:"skipped,omitempty"`
+	}
+
+	// importer converts the export of another link shortener into entries.
+	importer func(r io.Reader) ([]Entry, []Note, error)
+)
+
+const (
+	FormatYourls Format = "yourls"
+	FormatKutt   Format = "kutt"
+	FormatShlink Format = "shlink"
+	FormatBitly  Format = "bitly"
+)
+
+var (
+	importers = map[Format]importer{
+		FormatYourls: importYourls,
+		FormatKutt:   importKutt,
+		FormatShlink: importShlink,
+		FormatBitly:  importBitly,
+	}
+	// ImportFormats are all formats that can be imported, including the exports of other link shorteners
+	ImportFormats = slices.Concat(Formats, []Format{FormatYourls, FormatKutt, FormatShlink, FormatBitly})
+)
+
+// ParseImportFormat parses a format that can be imported, see [ImportFormats].
+func ParseImportFormat(value string) (Format, error) {
+	if format, err := ParseFormat(value); err == nil {
+		return format, nil
+	}
+	format := Format(strings.ToLower(strings.TrimSpace(value)))
+	if _, found := importers[format]; !found {
+		return "", fmt.Errorf("%w '%s', must be one of %v", ErrInvalidFormat, value, ImportFormats)
+	}
+	return format, nil
+}
+
+func (n Note) String() string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "row %d", n.Row)
+	if len(n.Key) > 0 {
+		fmt.Fprintf(&builder, " (%s)", n.Key)
+	}
+	builder.WriteString(": ")
+	if n.Skipped {
+		builder.WriteString("skipped, ")
+	}
+	builder.WriteString(n.Message)
+	return builder.String()
+}
+
+// DecodeReport works like [Decode], but supports the exports of other link shorteners as well. For those,
+// features that cannot be imported are reported per row.
+func DecodeReport(r io.Reader, format Format) ([]Entry, []Note, error) {
+	if importer, found := importers[format]; found {
+		return importer(r)
+	}
+	entries, err := Decode(r, format)
+	return entries, nil, err
+}
+
+// noteCollector collects the notes of all rows of an import.
+type noteCollector struct {
+	notes []Note
+}
+
+func (c *noteCollector) add(row int, key string, format string, args ...any) {
+	c.notes = append(c.notes, Note{Row: row, Key: key, Message: fmt.Sprintf(format, args...)})
+}
+
+func (c *noteCollector) skip(row int, key string, format string, args ...any) {
+	c.notes = append(c.notes, Note{Row: row, Key: key, Message: fmt.Sprintf(format, args...), Skipped: true})
+}
+
+// keyFromShortUrl returns the path of a short URL (like https://bit.ly/abc) as key, together with its host.
+func keyFromShortUrl(shortUrl string) (string, string, error) {
+	if !strings.Contains(shortUrl, "://") {
+		shortUrl = "https://" + shortUrl
+	}
+	parsed, err := url.Parse(shortUrl)
+	if err != nil {
+		return "", "", err
+	}
+	key := strings.Trim(parsed.Path, "/")
+	if len(key) == 0 {
+		return "", "", errors.New("short URL has no path")
+	}
+	return key, parsed.Host, nil
+}
@@ -0,0 +1,77 @@
+package transfer
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestImporters(t *testing.T) {
+	tests := []struct {
+		format   Format
+		input    string
+		expected []Entry
+		notes    []string
+	}{
+		{
+			format: FormatYourls,
+			input: "CREATE TABLE `yourls_url` (`keyword` varchar(100));\n" +
+				"INSERT INTO `yourls_url` (`keyword`, `url`, `title`) VALUES ('ozh','https://ozh.org/','Ozh\\'s site'),\n" +
+				"('q','https://example.com/?a=1;b=''2''',NULL),('empty','',NULL);\n" +
+				"INSERT INTO `yourls_options` VALUES (1,'version','1.9');",
+			expected: []Entry{{Key: "ozh", Target: "https://ozh.org/"}, {Key: "q", Target: "https://example.com/?a=1;b='2'"}},
+			notes:    []string{"row 3 (empty): skipped, missing URL"},
+		},
+		{
+			format: FormatKutt,
+			input: `{"limit":10,"data":[{"address":"docs","target":"https://example.com","password":true,"expire_in":null},` +
+				`{"address":"spam","target":"https://spam.example","banned":true}]}`,
+			expected: []Entry{{Key: "docs", Target: "https://example.com"}},
+			notes: []string{
+				"row 1 (docs): password protection is not supported, the link will be public",
+				"row 2 (spam): skipped, link has been banned",
+			},
+		},
+		{
+			format: FormatShlink,
+			input: `{"shortUrls":{"data":[{"shortCode":"abc","longUrl":"https://example.com",` +
+				`"deviceLongUrls":{"android":"https://play.example","ios":null},"meta":{"maxVisits":5}}]}}`,
+			expected: []Entry{{Key: "abc", Target: "https://example.com"}},
+			notes: []string{
+				"row 1 (abc): device-specific URLs (android) are not supported, all devices are redirected to the long URL",
+				"row 1 (abc): maximum number of visits (5) is not supported",
+			},
+		},
+		{
+			format: FormatBitly,
+			input: "Title,Bitlink,Long_URL,Custom Bitlinks,Tags\n" +
+				"Docs,https://bit.ly/3abc,https://example.com/docs,\"bit.ly/docs, bit.ly/manual\",\n" +
+				"Brand,go.example.com/x,https://example.com/x,,\n",
+			expected: []Entry{
+				{Key: "3abc", Target: "https://example.com/docs"},
+				{Key: "docs", Target: "3abc"},
+				{Key: "manual", Target: "3abc"},
+				{Key: "x", Target: "https://example.com/x"},
+			},
+			notes: []string{"row 3 (x): custom domain go.example.com is not supported"},
+		},
+	}
+
+	for _, test := range tests {
+		entries, notes, err := DecodeReport(strings.NewReader(test.input), test.format)
+		if err != nil {
+			t.Errorf("%s: %v", test.format, err)
+			continue
+		}
+		if !slices.Equal(entries, test.expected) {
+			t.Errorf("%s: expected entries %v, got %v", test.format, test.expected, entries)
+		}
+		var noteStrings []string
+		for _, note := range notes {
+			noteStrings = append(noteStrings, note.String())
+		}
+		if !slices.Equal(noteStrings, test.notes) {
+			t.Errorf("%s: expected notes %q, got %q", test.format, test.notes, noteStrings)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package transfer
+
+import (
+	"encoding/json"
+	"io"
+)
+
+type kuttLink struct {
+	Address  string  `json:"address"`
+	Target   string  `json:"target"`
+	Banned   bool    `json:"banned"`
+	Password bool    `json:"password"`
+	ExpireIn *string `json:"expire_in"`
+	Domain   *string `json:"domain"`
+}
+
+// importKutt reads links as returned by the links endpoint of the Kutt API (GET /api/v2/links). Both the paginated
+// response and a plain list of links are accepted.
+func importKutt(r io.Reader) ([]Entry, []Note, error) {
+	links, err := decodeList[kuttLink](r, "data")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var entries []Entry
+	notes := &noteCollector{}
+	for i, link := range links {
+		row := i + 1
+		switch {
+		case len(link.Address) == 0:
+			notes.skip(row, "", "missing address")
+			continue
+		case link.Banned:
+			notes.skip(row, link.Address, "link has been banned")
+			continue
+		}
+
+		if link.Password {
+			notes.add(row, link.Address, "password protection is not supported, the link will be public")
+		}
+		if link.ExpireIn != nil && len(*link.ExpireIn) > 0 {
+			notes.add(row, link.Address, "expiration (%s) is not supported, the link will not expire", *link.ExpireIn)
+		}
+		if link.Domain != nil && len(*link.Domain) > 0 {
+			notes.add(row, link.Address, "custom domain %s is not supported", *link.Domain)
+		}
+		entries = append(entries, Entry{Key: link.Address, Target: link.Target})
+	}
+	return entries, notes.notes, nil
+}
+
+// decodeList decodes a JSON list of T, which may also be wrapped in an object under the given field names
+// (e.g. {"data": [...]}).
+func decodeList[T any](r io.Reader, fields ...string) ([]T, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, field := range fields {
+		var wrapper map[string]json.RawMessage
+		if json.Unmarshal(data, &wrapper) != nil {
+			break
+		}
+		if inner, found := wrapper[field]; found {
+			data = inner
+		}
+	}
+
+	var list []T
+	err = json.Unmarshal(data, &list)
+	return list, err
+}
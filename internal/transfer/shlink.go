@@ -0,0 +1,63 @@
+package transfer
+
+import (
+	"io"
+	"maps"
+	"slices"
+	"strings"
+)
+
+type shlinkShortUrl struct {
+	ShortCode      string             `json:"shortCode"`
+	LongUrl        string             `json:"longUrl"`
+	DeviceLongUrls map[string]*string `json:"deviceLongUrls"`
+	Domain         *string            `json:"domain"`
+	Meta           struct {
+		ValidSince *string `json:"validSince"`
+		ValidUntil *string `json:"validUntil"`
+		MaxVisits  *int    `json:"maxVisits"`
+	} `json:"meta"`
+}
+
+// importShlink reads short URLs as returned by the Shlink REST API (GET /rest/v3/short-urls). Both the paginated
+// response and a plain list of short URLs are accepted.
+func importShlink(r io.Reader) ([]Entry, []Note, error) {
+	shortUrls, err := decodeList[shlinkShortUrl](r, "shortUrls", "data")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var entries []Entry
+	notes := &noteCollector{}
+	for i, shortUrl := range shortUrls {
+		row := i + 1
+		key := shortUrl.ShortCode
+		if len(key) == 0 {
+			notes.skip(row, "", "missing short code")
+			continue
+		}
+
+		var devices []string
+		for _, device := range slices.Sorted(maps.Keys(shortUrl.DeviceLongUrls)) {
+			if target := shortUrl.DeviceLongUrls[device]; target != nil && len(*target) > 0 {
+				devices = append(devices, device)
+			}
+		}
+		if len(devices) > 0 {
+			notes.add(row, key, "device-specific URLs (%s) are not supported, all devices are redirected to the long URL", strings.Join(devices, ", "))
+		}
+
+		meta := shortUrl.Meta
+		if meta.ValidSince != nil || meta.ValidUntil != nil {
+			notes.add(row, key, "validity period is not supported, the link will always be valid")
+		}
+		if meta.MaxVisits != nil {
+			notes.add(row, key, "maximum number of visits (%d) is not supported", *meta.MaxVisits)
+		}
+		if shortUrl.Domain != nil && len(*shortUrl.Domain) > 0 {
+			notes.add(row, key, "custom domain %s is not supported", *shortUrl.Domain)
+		}
+		entries = append(entries, Entry{Key: key, Target: shortUrl.LongUrl})
+	}
+	return entries, notes.notes, nil
+}
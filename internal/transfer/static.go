@@ -0,0 +1,355 @@
+package transfer
+
+import (
+	"archive/zip"
+	"bufio"
+	"fmt"
+	"html/template"
+	"io"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fanonwue/go-short-link/internal/policy"
+)
+
+type (
+	// StaticFormat is the format of a static server configuration that redirects like the application does.
+	StaticFormat string
+
+	StaticOptions struct {
+		// IgnoreCase matches the paths case-insensitively. The keys are expected to be lowercase already.
+		IgnoreCase bool
+		// RootKey is the key of the entry used for requests to the root path, or empty if root redirects are disabled
+		RootKey string
+	}
+
+	// SkippedEntry is an entry that could not be expressed in a static configuration.
+	SkippedEntry struct {
+		Key    string `json:"key"`
+		Reason string `json:"reason"`
+	}
+
+	staticRule struct {
+		// Path is the path to match, starting with a slash
+		Path   string
+		Target string
+	}
+
+	staticEncoder struct {
+		// unsafeKey and unsafeTarget are the characters that cannot be used in the configuration, in addition to
+		// the ones in [staticUnsafeKey] and [staticUnsafeTarget]
+		unsafeKey    string
+		unsafeTarget string
+		encode       func(w io.Writer, rules []staticRule, header []string, opts StaticOptions) error
+	}
+)
+
+const (
+	StaticNginx     StaticFormat = "nginx"
+	StaticApache    StaticFormat = "apache"
+	StaticApacheMap StaticFormat = "apache-map"
+	StaticCaddy     StaticFormat = "caddy"
+	StaticNetlify   StaticFormat = "netlify"
+	StaticHtml      StaticFormat = "html"
+
+	// staticUnsafeKey are the characters never used in keys of static configurations, in addition to whitespace.
+	// Keys containing '?' or '#' can never be matched, as those characters end the path.
+	staticUnsafeKey = "\"\\?#"
+	// staticUnsafeTarget are the characters never used in targets of static configurations, in addition to whitespace
+	staticUnsafeTarget = "\"\\"
+	// staticStatus is the status code used for all redirects, matching the status used by the application
+	staticStatus = 307
+)
+
+var (
+	StaticFormats = []StaticFormat{StaticNginx, StaticApache, StaticApacheMap, StaticCaddy, StaticNetlify, StaticHtml}
+
+	staticEncoders = map[StaticFormat]staticEncoder{
+		StaticNginx:     {unsafeTarget: "$", encode: encodeNginx},
+		StaticApache:    {unsafeTarget: "$%", encode: encodeApache},
+		StaticApacheMap: {encode: encodeApacheMap},
+		StaticCaddy:     {unsafeKey: "{}", unsafeTarget: "{}", encode: encodeCaddy},
+		StaticNetlify:   {unsafeKey: ":*", encode: encodeNetlify},
+		StaticHtml:      {encode: encodeHtml},
+	}
+
+	htmlPageTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="0; url={{.}}">
+<meta name="robots" content="noindex">
+<link rel="canonical" href="{{.}}">
+<title>Redirecting…</title>
+</head>
+<body>
+<p>Redirecting to <a href="{{.}}">{{.}}</a>.</p>
+</body>
+</html>
+`))
+)
+
+func ParseStaticFormat(value string) (StaticFormat, error) {
+	format := StaticFormat(strings.ToLower(strings.TrimSpace(value)))
+	if _, found := staticEncoders[format]; !found {
+		return "", fmt.Errorf("%w '%s', must be one of %v", ErrInvalidFormat, value, StaticFormats)
+	}
+	return format, nil
+}
+
+func (f StaticFormat) ContentType() string {
+	if f == StaticHtml {
+		return "application/zip"
+	}
+	return "text/plain; charset=utf-8"
+}
+
+// FileName returns the name the generated file is usually given.
+func (f StaticFormat) FileName() string {
+	switch f {
+	case StaticNginx:
+		return "short-links.nginx.conf"
+	case StaticApache:
+		return "short-links.apache.conf"
+	case StaticApacheMap:
+		return "short-links.map.txt"
+	case StaticCaddy:
+		return "short-links.caddy"
+	case StaticNetlify:
+		return "_redirects"
+	}
+	return "short-links.zip"
+}
+
+// EncodeStatic writes a static server configuration that redirects all entries of doc the same way the application
+// does. Aliases are resolved, as static configurations cannot refer to other entries. Entries that cannot be
+// expressed in the format are skipped and returned, they are listed in the generated file as well.
+func EncodeStatic(w io.Writer, format StaticFormat, doc Document, opts StaticOptions) ([]SkippedEntry, error) {
+	encoder, found := staticEncoders[format]
+	if !found {
+		return nil, fmt.Errorf("%w '%s', must be one of %v", ErrInvalidFormat, format, StaticFormats)
+	}
+
+	rules, skipped := staticRules(doc.Entries, encoder, opts)
+	header := []string{
+		fmt.Sprintf("Generated by go-short-link at %s from %s", doc.ExportedAt.UTC().Format(time.RFC3339), doc.Source),
+		fmt.Sprintf("%d redirects, %d entries skipped", len(rules), len(skipped)),
+	}
+	for _, entry := range skipped {
+		header = append(header, fmt.Sprintf("Skipped %s: %s", entry.Key, entry.Reason))
+	}
+
+	buffered := bufio.NewWriter(w)
+	if err := encoder.encode(buffered, rules, header, opts); err != nil {
+		return skipped, err
+	}
+	return skipped, buffered.Flush()
+}
+
+// staticRules resolves the entries into the rules of a static configuration, sorted by path.
+func staticRules(entries []Entry, encoder staticEncoder, opts StaticOptions) ([]staticRule, []SkippedEntry) {
+	mapping := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		mapping[entry.Key] = entry.Target
+	}
+
+	var rules []staticRule
+	var skipped []SkippedEntry
+	skip := func(key string, reason string, args ...any) {
+		skipped = append(skipped, SkippedEntry{Key: key, Reason: fmt.Sprintf(reason, args...)})
+	}
+
+	for _, entry := range entries {
+		key, target := entry.Key, entry.Target
+		if len(key) == 0 {
+			continue
+		}
+		if policy.IsAlias(target) {
+			aliasTarget, found := mapping[target]
+			if !found || policy.IsAlias(aliasTarget) {
+				skip(key, "alias of unknown key '%s'", target)
+				continue
+			}
+			target = aliasTarget
+		}
+
+		rulePath := "/" + key
+		if key == opts.RootKey {
+			rulePath = "/"
+		}
+		switch {
+		case strings.ContainsFunc(key, isUnsafeRune) || strings.ContainsAny(key, staticUnsafeKey+encoder.unsafeKey):
+			skip(key, "key contains whitespace or one of the unsupported characters %s", charList(staticUnsafeKey+encoder.unsafeKey))
+		case path.Clean(rulePath) != rulePath:
+			// Web servers clean the path before matching it, so the path would never match
+			skip(key, "key contains empty or relative path segments")
+		case strings.ContainsFunc(target, isUnsafeRune) || strings.ContainsAny(target, staticUnsafeTarget+encoder.unsafeTarget):
+			skip(key, "target contains whitespace or one of the unsupported characters %s", charList(staticUnsafeTarget+encoder.unsafeTarget))
+		default:
+			rules = append(rules, staticRule{Path: rulePath, Target: target})
+		}
+	}
+
+	slices.SortFunc(rules, func(a, b staticRule) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	slices.SortFunc(skipped, func(a, b SkippedEntry) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+	return rules, skipped
+}
+
+func charList(chars string) string {
+	return strings.Join(strings.Split(chars, ""), " ")
+}
+
+func isUnsafeRune(r rune) bool {
+	return r <= ' ' || r == 0x7f
+}
+
+// pathRegex returns a regular expression matching the path with an optional trailing slash.
+func pathRegex(rulePath string, opts StaticOptions) string {
+	pattern := "^" + regexp.QuoteMeta(strings.TrimSuffix(rulePath, "/")) + "/?$"
+	if opts.IgnoreCase && rulePath != "/" {
+		pattern = "(?i)" + pattern
+	}
+	return pattern
+}
+
+func writeComments(w io.Writer, lines ...string) error {
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(w, strings.TrimSpace("# "+line)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func encodeNginx(w io.Writer, rules []staticRule, header []string, opts StaticOptions) error {
+	header = append(header, "",
+		"Include this file in the http block and add the following to the server block:",
+		fmt.Sprintf("  if ($short_link_target) { return %d $short_link_target; }", staticStatus))
+	if err := writeComments(w, header...); err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprint(w, "map $uri $short_link_target {\n    default \"\";\n"); err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		// nginx does not support inline flags, case-insensitive matching is selected by the operator instead
+		operator := "~"
+		if opts.IgnoreCase {
+			operator = "~*"
+		}
+		pattern := strings.TrimPrefix(pathRegex(rule.Path, opts), "(?i)")
+		if _, err := fmt.Fprintf(w, "    \"%s%s\" \"%s\";\n", operator, pattern, rule.Target); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprint(w, "}\n")
+	return err
+}
+
+func encodeApache(w io.Writer, rules []staticRule, header []string, opts StaticOptions) error {
+	header = append(header, "", "Include this file in the server configuration or a virtual host.")
+	if err := writeComments(w, header...); err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		if _, err := fmt.Fprintf(w, "RedirectMatch %d \"%s\" \"%s\"\n", staticStatus, pathRegex(rule.Path, opts), rule.Target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeApacheMap writes a text file for RewriteMap. Lookups in it are case-sensitive, so the keys are lowercased by
+// the rewrite rule if the case is ignored.
+func encodeApacheMap(w io.Writer, rules []staticRule, header []string, opts StaticOptions) error {
+	lookup := "$1"
+	usage := []string{"", "Add the following to the server configuration or a virtual host:", "  RewriteEngine On",
+		"  RewriteMap short-links \"txt:/path/to/" + StaticApacheMap.FileName() + "\""}
+	if opts.IgnoreCase {
+		lookup = "${lowercase:$1}"
+		usage = append(usage, "  RewriteMap lowercase \"int:tolower\"")
+	}
+
+	// The root path cannot be looked up in the map, it gets its own rule instead
+	if index := slices.IndexFunc(rules, func(rule staticRule) bool { return rule.Path == "/" }); index >= 0 {
+		usage = append(usage, fmt.Sprintf("  RewriteRule \"^/$\" \"%s\" [R=%d,L,NE]", rules[index].Target, staticStatus))
+	}
+	usage = append(usage,
+		fmt.Sprintf("  RewriteCond \"${short-links:%s}\" \"^(.+)$\"", lookup),
+		fmt.Sprintf("  RewriteRule \"^/(.+?)/?$\" \"%%1\" [R=%d,L,NE]", staticStatus))
+
+	if err := writeComments(w, slices.Concat(header, usage)...); err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		if rule.Path == "/" {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "%s %s\n", strings.TrimPrefix(rule.Path, "/"), rule.Target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func encodeCaddy(w io.Writer, rules []staticRule, header []string, opts StaticOptions) error {
+	header = append(header, "", "Import this file in a site block, e.g. example.com { import "+StaticCaddy.FileName()+" }")
+	if err := writeComments(w, header...); err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprint(w, "map {path} {short_link_target} {\n"); err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		if _, err := fmt.Fprintf(w, "\t\"~%s\" \"%s\"\n", pathRegex(rule.Path, opts), rule.Target); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "\tdefault \"\"\n}\n\n"+
+		"@short_link expression `{short_link_target} != \"\"`\n"+
+		"redir @short_link {short_link_target} %d\n", staticStatus)
+	return err
+}
+
+// encodeNetlify writes a _redirects file. Netlify normalizes trailing slashes itself, and the redirects are forced
+// so that they apply even if a file with the same path exists.
+func encodeNetlify(w io.Writer, rules []staticRule, header []string, _ StaticOptions) error {
+	if err := writeComments(w, header...); err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		if _, err := fmt.Fprintf(w, "%s %s %d!\n", rule.Path, rule.Target, staticStatus); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeHtml writes a zip file containing an index.html with a meta refresh for every path, which can be served by
+// any static web server. As those match paths by file name, the case of the path is never ignored.
+func encodeHtml(w io.Writer, rules []staticRule, header []string, _ StaticOptions) error {
+	archive := zip.NewWriter(w)
+	if err := archive.SetComment(strings.Join(header, "\n")); err != nil {
+		return err
+	}
+
+	for _, rule := range rules {
+		file, err := archive.Create(path.Join(strings.TrimPrefix(rule.Path, "/"), "index.html"))
+		if err != nil {
+			return err
+		}
+		if err = htmlPageTemplate.Execute(file, rule.Target); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
@@ -0,0 +1,143 @@
+package transfer
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncodeStatic(t *testing.T) {
+	doc := Document{
+		ExportedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Source:     "test",
+		Entries: []Entry{
+			{Key: "docs", Target: "https://example.com/docs"},
+			{Key: "manual", Target: "docs"},
+			{Key: "broken", Target: "missing"},
+			{Key: "a.b/c", Target: "https://example.com/?q=$1"},
+			{Key: "__root", Target: "https://example.com"},
+		},
+	}
+	opts := StaticOptions{IgnoreCase: true, RootKey: "__root"}
+
+	tests := []struct {
+		format   StaticFormat
+		contains []string
+		skipped  []string
+	}{
+		{
+			format: StaticNginx,
+			contains: []string{
+				`"~*^/?$" "https://example.com";`,
+				`"~*^/docs/?$" "https://example.com/docs";`,
+				`"~*^/manual/?$" "https://example.com/docs";`,
+			},
+			skipped: []string{"a.b/c", "broken"},
+		},
+		{
+			format:   StaticApache,
+			contains: []string{`RedirectMatch 307 "(?i)^/docs/?$" "https://example.com/docs"`},
+			skipped:  []string{"a.b/c", "broken"},
+		},
+		{
+			format: StaticApacheMap,
+			contains: []string{
+				"\na.b/c https://example.com/?q=$1\n",
+				"\nmanual https://example.com/docs\n",
+				`RewriteRule "^/$" "https://example.com" [R=307,L,NE]`,
+				`RewriteCond "${short-links:${lowercase:$1}}" "^(.+)$"`,
+			},
+			skipped: []string{"broken"},
+		},
+		{
+			format:   StaticCaddy,
+			contains: []string{`"~(?i)^/a\.b/c/?$" "https://example.com/?q=$1"`},
+			skipped:  []string{"broken"},
+		},
+		{
+			format:   StaticNetlify,
+			contains: []string{"\n/ https://example.com 307!\n", "\n/manual https://example.com/docs 307!\n"},
+			skipped:  []string{"broken"},
+		},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		skipped, err := EncodeStatic(&buf, test.format, doc, opts)
+		if err != nil {
+			t.Errorf("%s: %v", test.format, err)
+			continue
+		}
+		output := buf.String()
+		for _, expected := range test.contains {
+			if !strings.Contains(output, expected) {
+				t.Errorf("%s: expected output to contain %q, got:\n%s", test.format, expected, output)
+			}
+		}
+		var skippedKeys []string
+		for _, entry := range skipped {
+			skippedKeys = append(skippedKeys, entry.Key)
+			if !strings.Contains(output, "# Skipped "+entry.Key+": ") {
+				t.Errorf("%s: skipped entry %s is not listed in the output", test.format, entry.Key)
+			}
+		}
+		if !slices.Equal(skippedKeys, test.skipped) {
+			t.Errorf("%s: expected skipped entries %v, got %v", test.format, test.skipped, skippedKeys)
+		}
+	}
+}
+
+func TestEncodeStaticHtml(t *testing.T) {
+	doc := Document{Entries: []Entry{
+		{Key: "docs", Target: "https://example.com/?a=1&b=<2>"},
+		{Key: "a/../b", Target: "https://example.com"},
+	}}
+
+	var buf bytes.Buffer
+	skipped, err := EncodeStatic(&buf, StaticHtml, doc, StaticOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(skipped) != 1 || skipped[0].Key != "a/../b" {
+		t.Errorf("expected a/../b to be skipped, got %v", skipped)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(archive.File) != 1 || archive.File[0].Name != "docs/index.html" {
+		t.Fatalf("expected only docs/index.html in the archive, got %v", archive.File)
+	}
+	file, err := archive.File[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := io.ReadAll(file)
+	if expected := `href="https://example.com/?a=1&amp;b=%3c2%3e"`; !strings.Contains(string(page), expected) {
+		t.Errorf("expected page to contain %q, got:\n%s", expected, page)
+	}
+}
+
+func TestEncodeStaticUnsafeKeys(t *testing.T) {
+	doc := Document{Entries: []Entry{
+		{Key: "docs", Target: "https://example.com/docs"},
+		{Key: "with space", Target: "https://example.com"},
+		{Key: "line\nbreak", Target: "https://example.com"},
+		{Key: "del\x7f", Target: "https://example.com"},
+	}}
+	for _, format := range StaticFormats {
+		var buf bytes.Buffer
+		skipped, err := EncodeStatic(&buf, format, doc, StaticOptions{})
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if len(skipped) != 3 {
+			t.Errorf("%s: expected keys with whitespace or control characters to be skipped, got %v", format, skipped)
+		}
+	}
+}
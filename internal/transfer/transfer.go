@@ -0,0 +1,265 @@
+// Package transfer encodes and decodes redirect mappings for exporting and importing them.
+package transfer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+type (
+	Format string
+
+	// Entry is a single entry of an export. The metadata fields are only set if the information is available,
+	// and are ignored when importing.
+	Entry struct {
+		Key       string     `json:"key" yaml:"key"`
+		Target    string     `json:"target" yaml:"target"`
+		Clicks    *uint64    `json:"clicks,omitempty" yaml:"clicks,omitempty"`
+		LastClick *time.Time `json:"lastClick,omitempty" yaml:"lastClick,omitempty"`
+	}
+
+	Document struct {
+		ExportedAt time.Time `json:"exportedAt" yaml:"exportedAt"`
+		// Source is the ID of the data source the mapping has been read from
+		Source  string  `json:"source" yaml:"source"`
+		Entries []Entry `json:"entries" yaml:"entries"`
+	}
+)
+
+const (
+	FormatCsv  Format = "csv"
+	FormatJson Format = "json"
+	FormatYaml Format = "yaml"
+)
+
+var (
+	Formats          = []Format{FormatCsv, FormatJson, FormatYaml}
+	ErrInvalidFormat = errors.New("invalid format")
+	ErrEmptyInput    = errors.New("the input is empty")
+	// ErrMissingEntries is returned for documents without an entries field
+	ErrMissingEntries = errors.New("the document has no entries field")
+	csvHeader         = []string{"key", "target", "clicks", "last_click"}
+)
+
+func ParseFormat(value string) (Format, error) {
+	format := Format(strings.ToLower(strings.TrimSpace(value)))
+	if format == "yml" {
+		format = FormatYaml
+	}
+	if !slices.Contains(Formats, format) {
+		return "", fmt.Errorf("%w '%s', must be one of %v", ErrInvalidFormat, value, Formats)
+	}
+	return format, nil
+}
+
+// FormatFromContentType determines the format from the media type of a Content-Type header.
+func FormatFromContentType(contentType string) (Format, bool) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "text/csv":
+		return FormatCsv, true
+	case "application/json":
+		return FormatJson, true
+	case "application/yaml", "application/x-yaml", "text/yaml":
+		return FormatYaml, true
+	}
+	return "", false
+}
+
+func (f Format) ContentType() string {
+	switch f {
+	case FormatCsv:
+		return "text/csv; charset=utf-8"
+	case FormatYaml:
+		return "application/yaml; charset=utf-8"
+	}
+	return "application/json; charset=utf-8"
+}
+
+// Encode writes the document to w. CSV and JSON are written entry by entry, so large mappings are not
+// buffered as a whole.
+func Encode(w io.Writer, format Format, doc Document) error {
+	switch format {
+	case FormatCsv:
+		return encodeCsv(w, doc)
+	case FormatYaml:
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(doc); err != nil {
+			return err
+		}
+		return encoder.Close()
+	}
+	return encodeJson(w, doc)
+}
+
+func encodeCsv(w io.Writer, doc Document) error {
+	writer := csv.NewWriter(w)
+	withMetadata := slices.ContainsFunc(doc.Entries, func(entry Entry) bool {
+		return entry.Clicks != nil
+	})
+
+	header := csvHeader[:2]
+	if withMetadata {
+		header = csvHeader
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for _, entry := range doc.Entries {
+		record := []string{entry.Key, entry.Target}
+		if withMetadata {
+			clicks, lastClick := "", ""
+			if entry.Clicks != nil {
+				clicks = strconv.FormatUint(*entry.Clicks, 10)
+			}
+			if entry.LastClick != nil {
+				lastClick = entry.LastClick.Format(time.RFC3339)
+			}
+			record = append(record, clicks, lastClick)
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func encodeJson(w io.Writer, doc Document) error {
+	header, err := json.Marshal(struct {
+		ExportedAt time.Time `json:"exportedAt"`
+		Source     string    `json:"source"`
+	}{doc.ExportedAt, doc.Source})
+	if err != nil {
+		return err
+	}
+
+	buffered := bufio.NewWriter(w)
+	// Reopen the header object to append the entries to it
+	_, _ = buffered.Write(header[:len(header)-1])
+	_, _ = buffered.WriteString(`,"entries":[`)
+	for i, entry := range doc.Entries {
+		if i > 0 {
+			_ = buffered.WriteByte(',')
+		}
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		_, _ = buffered.Write(data)
+	}
+	_, _ = buffered.WriteString("]}\n")
+	return buffered.Flush()
+}
+
+// Decode reads the entries from r. JSON and YAML input may either be a [Document] or a plain list of entries,
+// like the fallback file. Unknown fields are rejected, so that documents in other formats are not mistaken for
+// an empty import. CSV input may start with a header row naming the key and target columns; otherwise
+// the first two columns are used.
+func Decode(r io.Reader, format Format) ([]Entry, error) {
+	if format == FormatCsv {
+		return decodeCsv(r)
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	trimmed := bytes.TrimSpace(data)
+	isList := bytes.HasPrefix(trimmed, []byte("[")) ||
+		(bytes.HasPrefix(trimmed, []byte("-")) && !bytes.HasPrefix(trimmed, []byte("---")))
+	if isList {
+		err = decodeStrict(data, format, &entries)
+	} else {
+		var doc Document
+		err = decodeStrict(data, format, &doc)
+		if err == nil && doc.Entries == nil {
+			err = ErrMissingEntries
+		}
+		entries = doc.Entries
+	}
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// decodeStrict decodes a single JSON or YAML document, rejecting unknown fields, empty input and trailing data.
+func decodeStrict(data []byte, format Format, v any) error {
+	type decoder interface{ Decode(v any) error }
+	var dec decoder
+	if format == FormatYaml {
+		yamlDecoder := yaml.NewDecoder(bytes.NewReader(data))
+		yamlDecoder.KnownFields(true)
+		dec = yamlDecoder
+	} else {
+		jsonDecoder := json.NewDecoder(bytes.NewReader(data))
+		jsonDecoder.DisallowUnknownFields()
+		dec = jsonDecoder
+	}
+
+	if err := dec.Decode(v); errors.Is(err, io.EOF) {
+		return ErrEmptyInput
+	} else if err != nil {
+		return err
+	}
+	if err := dec.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		return errors.New("unexpected data after the document")
+	}
+	return nil
+}
+
+func decodeCsv(r io.Reader) ([]Entry, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	keyColumn, targetColumn := 0, 1
+	var entries []Entry
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if first && columnIndex(record, "key") >= 0 {
+			keyColumn, targetColumn = columnIndex(record, "key"), columnIndex(record, "target")
+			if targetColumn < 0 {
+				return nil, errors.New("header is missing the target column")
+			}
+			continue
+		}
+
+		line, _ := reader.FieldPos(0)
+		if len(record) <= max(keyColumn, targetColumn) {
+			return nil, fmt.Errorf("line %d: expected at least %d columns", line, max(keyColumn, targetColumn)+1)
+		}
+		entries = append(entries, Entry{Key: record[keyColumn], Target: record[targetColumn]})
+	}
+}
+
+func columnIndex(header []string, name string) int {
+	return slices.IndexFunc(header, func(column string) bool {
+		return strings.EqualFold(strings.TrimSpace(column), name)
+	})
+}
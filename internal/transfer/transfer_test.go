@@ -0,0 +1,87 @@
+package transfer
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRoundTrip(t *testing.T) {
+	clicks := uint64(3)
+	lastClick := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	doc := Document{
+		ExportedAt: lastClick,
+		Source:     "test",
+		Entries: []Entry{
+			{Key: "docs", Target: "https://example.com/docs", Clicks: &clicks, LastClick: &lastClick},
+			{Key: "quoted", Target: "https://example.com/?a=1,b=\"2\""},
+		},
+	}
+	expected := []Entry{{Key: "docs", Target: "https://example.com/docs"}, {Key: "quoted", Target: "https://example.com/?a=1,b=\"2\""}}
+
+	for _, format := range Formats {
+		out := &bytes.Buffer{}
+		if err := Encode(out, format, doc); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		entries, err := Decode(out, format)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		// Metadata is not imported
+		for i := range entries {
+			entries[i].Clicks, entries[i].LastClick = nil, nil
+		}
+		if !slices.Equal(entries, expected) {
+			t.Errorf("%s: expected %v, got %v", format, expected, entries)
+		}
+	}
+}
+
+func TestDecodeVariants(t *testing.T) {
+	tests := []struct {
+		format Format
+		input  string
+	}{
+		{FormatJson, `[{"key":"docs","target":"https://example.com"}]`},
+		{FormatYaml, "- key: docs\n  target: https://example.com\n"},
+		{FormatYaml, "---\nentries:\n  - key: docs\n    target: https://example.com\n"},
+		{FormatCsv, "docs,https://example.com\n"},
+		{FormatCsv, "Description,Target,Key\nSome link,https://example.com,docs\n"},
+	}
+
+	expected := []Entry{{Key: "docs", Target: "https://example.com"}}
+	for _, test := range tests {
+		entries, err := Decode(strings.NewReader(test.input), test.format)
+		if err != nil {
+			t.Errorf("%s %q: %v", test.format, test.input, err)
+		} else if !slices.Equal(entries, expected) {
+			t.Errorf("%s %q: expected %v, got %v", test.format, test.input, expected, entries)
+		}
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	tests := []struct {
+		format Format
+		input  string
+	}{
+		{FormatJson, ""},
+		{FormatJson, `{"links":[{"key":"docs","target":"https://example.com"}]}`},
+		{FormatJson, `{"source":"test"}`},
+		{FormatJson, `[{"key":"docs","url":"https://example.com"}]`},
+		{FormatJson, `{"entries":[]} {"entries":[]}`},
+		{FormatYaml, ""},
+		{FormatYaml, "---\n"},
+		{FormatYaml, "source: test\n"},
+		{FormatYaml, "links:\n  - key: docs\n    target: https://example.com\n"},
+	}
+
+	for _, test := range tests {
+		if entries, err := Decode(strings.NewReader(test.input), test.format); err == nil {
+			t.Errorf("%s %q: expected input to be rejected, got %v", test.format, test.input, entries)
+		}
+	}
+}
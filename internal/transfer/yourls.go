@@ -0,0 +1,213 @@
+package transfer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// sqlInsert is a single INSERT statement of an SQL dump.
+type sqlInsert struct {
+	table   string
+	columns []string
+	rows    [][]*string
+}
+
+var (
+	// insertPattern matches the start of an INSERT statement up to its VALUES keyword
+	insertPattern = regexp.MustCompile("(?is)INSERT\\s+(?:IGNORE\\s+)?INTO\\s+[`\"]?(\\w+)[`\"]?\\s*(\\([^)]*\\))?\\s*VALUES")
+	// yourlsColumns is the column order of the YOURLS url table, used if the dump does not name the columns
+	yourlsColumns = []string{"keyword", "url", "title", "timestamp", "ip", "clicks"}
+)
+
+// importYourls reads the url table from an SQL dump of a YOURLS database (e.g. created using mysqldump). The table
+// is recognized by its name ending in "url", so custom table prefixes are supported.
+func importYourls(r io.Reader) ([]Entry, []Note, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	inserts, err := parseSqlInserts(string(data))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var entries []Entry
+	notes := &noteCollector{}
+	row := 0
+	for _, insert := range inserts {
+		if !strings.HasSuffix(strings.ToLower(insert.table), "url") {
+			continue
+		}
+		columns := insert.columns
+		if len(columns) == 0 {
+			columns = yourlsColumns
+		}
+		keyColumn, urlColumn := slices.Index(columns, "keyword"), slices.Index(columns, "url")
+		if keyColumn < 0 || urlColumn < 0 {
+			return nil, nil, fmt.Errorf("table %s has no keyword or url column", insert.table)
+		}
+
+		for _, values := range insert.rows {
+			row++
+			if len(values) <= max(keyColumn, urlColumn) || values[keyColumn] == nil {
+				notes.skip(row, "", "missing keyword")
+				continue
+			}
+			key := *values[keyColumn]
+			if values[urlColumn] == nil || len(*values[urlColumn]) == 0 {
+				notes.skip(row, key, "missing URL")
+				continue
+			}
+			entries = append(entries, Entry{Key: key, Target: *values[urlColumn]})
+		}
+	}
+
+	if row == 0 {
+		return nil, nil, errors.New("no rows of a YOURLS url table found")
+	}
+	return entries, notes.notes, nil
+}
+
+// parseSqlInserts extracts all INSERT statements from an SQL dump. Only the value syntax written by common dump
+// tools is supported: quoted strings (with backslash escapes or doubled quotes), unquoted literals and NULL.
+func parseSqlInserts(dump string) ([]sqlInsert, error) {
+	var inserts []sqlInsert
+	for {
+		match := insertPattern.FindStringSubmatchIndex(dump)
+		if match == nil {
+			return inserts, nil
+		}
+
+		insert := sqlInsert{table: dump[match[2]:match[3]]}
+		if match[4] >= 0 {
+			for _, column := range strings.Split(strings.Trim(dump[match[4]:match[5]], "()"), ",") {
+				insert.columns = append(insert.columns, strings.ToLower(strings.Trim(strings.TrimSpace(column), "`\"")))
+			}
+		}
+
+		parser := sqlParser{input: dump, pos: match[1]}
+		rows, err := parser.parseRows()
+		if err != nil {
+			return nil, fmt.Errorf("INSERT INTO %s: %w", insert.table, err)
+		}
+		insert.rows = rows
+		inserts = append(inserts, insert)
+		dump = dump[parser.pos:]
+	}
+}
+
+type sqlParser struct {
+	input string
+	pos   int
+}
+
+func (p *sqlParser) skipSpace() {
+	for p.pos < len(p.input) && strings.ContainsRune(" \t\r\n", rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *sqlParser) expect(c byte) error {
+	p.skipSpace()
+	if p.pos >= len(p.input) || p.input[p.pos] != c {
+		return fmt.Errorf("expected '%c' at offset %d", c, p.pos)
+	}
+	p.pos++
+	return nil
+}
+
+// parseRows parses the tuples following VALUES up to the terminating semicolon.
+func (p *sqlParser) parseRows() ([][]*string, error) {
+	var rows [][]*string
+	for {
+		if err := p.expect('('); err != nil {
+			return nil, err
+		}
+		var values []*string
+		for {
+			value, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+			p.skipSpace()
+			if p.pos < len(p.input) && p.input[p.pos] == ',' {
+				p.pos++
+				continue
+			}
+			if err = p.expect(')'); err != nil {
+				return nil, err
+			}
+			break
+		}
+		rows = append(rows, values)
+
+		p.skipSpace()
+		if p.pos >= len(p.input) || p.input[p.pos] == ';' {
+			p.pos = min(p.pos+1, len(p.input))
+			return rows, nil
+		}
+		if err := p.expect(','); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *sqlParser) parseValue() (*string, error) {
+	p.skipSpace()
+	if p.pos >= len(p.input) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if quote := p.input[p.pos]; quote == '\'' || quote == '"' {
+		return p.parseString(quote)
+	}
+
+	start := p.pos
+	for p.pos < len(p.input) && !strings.ContainsRune(",) \t\r\n", rune(p.input[p.pos])) {
+		p.pos++
+	}
+	literal := p.input[start:p.pos]
+	if strings.EqualFold(literal, "NULL") {
+		return nil, nil
+	}
+	return &literal, nil
+}
+
+func (p *sqlParser) parseString(quote byte) (*string, error) {
+	var builder strings.Builder
+	p.pos++
+	for p.pos < len(p.input) {
+		c := p.input[p.pos]
+		p.pos++
+		switch {
+		case c == '\\' && p.pos < len(p.input):
+			escaped := p.input[p.pos]
+			p.pos++
+			switch escaped {
+			case 'n':
+				builder.WriteByte('\n')
+			case 'r':
+				builder.WriteByte('\r')
+			case 't':
+				builder.WriteByte('\t')
+			case '0':
+				builder.WriteByte(0)
+			default:
+				builder.WriteByte(escaped)
+			}
+		case c == quote && p.pos < len(p.input) && p.input[p.pos] == quote:
+			builder.WriteByte(quote)
+			p.pos++
+		case c == quote:
+			value := builder.String()
+			return &value, nil
+		default:
+			builder.WriteByte(c)
+		}
+	}
+	return nil, io.ErrUnexpectedEOF
+}
@@ -8,9 +8,14 @@ import (
 	"syscall"
 
 	"github.com/fanonwue/go-short-link/internal"
+	"github.com/fanonwue/go-short-link/internal/cli"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		os.Exit(cli.Run(os.Args[1:]))
+	}
+
 	appContext, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 	err := internal.Run(appContext)